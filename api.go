@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/logger"
+	"gps_clients/server_gps_service/models"
+)
+
+var apiServer *http.Server
+
+//startAPI запускает HTTP API управления, пустой адрес - API выключен
+func startAPI(addr string) {
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/info", apiInfo)
+	mux.HandleFunc("/api/sessions", apiSessions)
+	mux.HandleFunc("/api/limits", apiLimits)
+	mux.HandleFunc("/api/debug", apiDebug)
+	mux.HandleFunc("/api/reload", apiReload)
+
+	apiServer = &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		logger.Info("api run on %s", addr)
+		if err := apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("api: %v", err)
+		}
+	}()
+}
+
+func stopAPI() {
+	if apiServer != nil {
+		apiServer.Close()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+//apiInfo состояние устройств по всем портам
+func apiInfo(w http.ResponseWriter, r *http.Request) {
+	info := models.ServerInfo{Name: config.Get().ServiceName}
+	for _, s := range serverList() {
+		info.Ports = append(info.Ports, models.PortInfo{Name: s.Addr, Gps: s.GetGPSList()})
+	}
+	sort.Slice(info.Ports, func(i, j int) bool { return info.Ports[i].Name < info.Ports[j].Name })
+	writeJSON(w, info)
+}
+
+//apiSessions счетчики и подключение каждого устройства
+func apiSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, sessions.Stats())
+}
+
+//apiLimits срабатывания ограничений соединений по портам
+func apiLimits(w http.ResponseWriter, r *http.Request) {
+	hits := make(map[string]map[string]int64)
+	for _, s := range serverList() {
+		hits[s.Addr] = s.LimitHits()
+	}
+	writeJSON(w, hits)
+}
+
+//apiDebug GET - список устройств с отладкой, POST device=<id>&on=true|false - включение/выключение
+func apiDebug(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		device := r.FormValue("device")
+		if device == "" {
+			http.Error(w, "empty device", http.StatusBadRequest)
+			return
+		}
+		on, err := strconv.ParseBool(r.FormValue("on"))
+		if err != nil {
+			http.Error(w, "bad value on: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.SetDeviceDebug(device, on)
+		logger.With(logger.Fields{Device: device}).Info("debug set to %v", on)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, logger.DeviceDebug())
+}
+
+//apiReload POST - перечитать конфигурацию и реестр устройств;
+//422 с текстом ошибки, если конфигурация не применена (в т.ч. нужен перезапуск службы)
+func apiReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := reload(); err != nil {
+		logger.Error("reload failed: %v", err)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	logger.Info("reloaded by api")
+
+	ports := make(map[string]string)
+	for _, s := range serverList() {
+		ports[s.Addr] = s.Protocol
+	}
+	writeJSON(w, ports)
+}
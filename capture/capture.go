@@ -0,0 +1,196 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//Magic заголовок файла захвата
+const Magic = "GPSCAP1\n"
+
+//направление кадра
+const (
+	In  byte = 0
+	Out byte = 1
+)
+
+const maxFrame = 16 * 1024 * 1024
+
+//Frame кадр, принятый от трекера или отправленный ему
+type Frame struct {
+	Time   time.Time
+	Dir    byte
+	Remote string
+	Data   []byte
+}
+
+//Header параметры файла захвата
+type Header struct {
+	Protocol string
+	Port     string
+}
+
+//Writer запись кадров в файл захвата.
+//Формат: Magic, протокол и порт (1 байт длина + строка), далее кадры:
+//8 байт время (UnixNano), 1 байт направление, 1 байт длина + адрес, 4 байта длина + данные
+type Writer struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+func writeString(w io.Writer, s string) error {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	if _, err := w.Write([]byte{byte(len(s))}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+//Create создает файл захвата
+func Create(name string, h Header) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Writer{file: f, w: bufio.NewWriter(f)}
+	if _, err := w.w.WriteString(Magic); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := writeString(w.w, h.Protocol); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := writeString(w.w, h.Port); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+//Write записывает кадр
+func (w *Writer) Write(dir byte, remote string, data []byte) error {
+	defer w.mu.Unlock()
+	w.mu.Lock()
+
+	if w.file == nil {
+		return os.ErrClosed
+	}
+
+	b := make([]byte, 9)
+	binary.BigEndian.PutUint64(b, uint64(time.Now().UnixNano()))
+	b[8] = dir
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	if err := writeString(w.w, remote); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(data)))
+	if _, err := w.w.Write(b[:4]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+//Close закрывает файл
+func (w *Writer) Close() error {
+	defer w.mu.Unlock()
+	w.mu.Lock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.w.Flush()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.file = nil
+	return err
+}
+
+//Reader чтение файла захвата
+type Reader struct {
+	Header Header
+	r      *bufio.Reader
+}
+
+func readString(r *bufio.Reader) (string, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+//NewReader читает заголовок файла захвата
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != Magic {
+		return nil, errors.New("not a capture file")
+	}
+
+	res := &Reader{r: br}
+	var err error
+	if res.Header.Protocol, err = readString(br); err != nil {
+		return nil, err
+	}
+	if res.Header.Port, err = readString(br); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+//Next следующий кадр, в конце файла io.EOF
+func (r *Reader) Next() (Frame, error) {
+	var f Frame
+	b := make([]byte, 9)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return f, err
+	}
+	f.Time = time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+	f.Dir = b[8]
+
+	var err error
+	if f.Remote, err = readString(r.r); err != nil {
+		return f, io.ErrUnexpectedEOF
+	}
+	if _, err := io.ReadFull(r.r, b[:4]); err != nil {
+		return f, io.ErrUnexpectedEOF
+	}
+	n := binary.BigEndian.Uint32(b)
+	if n > maxFrame {
+		return f, fmt.Errorf("frame too large: %d", n)
+	}
+	f.Data = make([]byte, n)
+	if _, err := io.ReadFull(r.r, f.Data); err != nil {
+		return f, io.ErrUnexpectedEOF
+	}
+	return f, nil
+}
@@ -7,13 +7,16 @@ import (
 	"fmt"
 	"gps_clients/server_gps_service/hash"
 	"gps_clients/server_gps_service/models"
-	"gps_clients/server_gps_service/utils"
 	"strconv"
 	"time"
 )
 
 type Cargo models.ProtocolModel
 
+func (T *Cargo) Model() *models.ProtocolModel {
+	return (*models.ProtocolModel)(T)
+}
+
 func (T *Cargo) GetBadPacketByte() []byte {
 	return []byte{0, 0, 0, 0}
 }
@@ -26,7 +29,7 @@ func (T *Cargo) ReturnError(err string) error {
 func (T *Cargo) ParseData() error {
 	defer func() {
 		if recMes := recover(); recMes != nil {
-			utils.AddToLog(utils.GetProgramPath()+"-error.txt", recMes)
+			T.GPS.Log().Error("panic parse data: %v", recMes)
 		}
 	}()
 	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
@@ -48,6 +51,10 @@ func (T *Cargo) ParseData() error {
 			T.GPS.Name += string(T.Input[i])
 		}
 
+		if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+			return T.ReturnError(err.Error())
+		}
+
 		T.GPS.CountData = []byte{0, 0, 0, 1}
 		T.GPS.LastError = ""
 		return nil
@@ -181,90 +188,29 @@ func (T *Cargo) ParceGPSData8Codec(input []byte) error {
 
 		//posInInput = 34
 		//IO ELEMENT
-		posInInput++ //0 – данные созданы не по событию
-
-		countAllIO := int(input[posInInput])
-		posInInput++ //Общее кол-во передаваемых датчиков
-
-		for i := 0; i < countAllIO; i++ {
-			switch i {
-			case 0:
-				countIO := int(input[posInInput]) // Кол-во датчиков разрядности 1 байт
-				posInInput++
-				for i := 0; i < countIO; i++ {
-					id := int(input[posInInput])
-					posInInput++
-					d := int(input[posInInput])
-					posInInput++
-					gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-				}
-			case 1:
-				countIO := int(input[posInInput]) // Кол-во датчиков разрядности 2 байта
-				posInInput++
-				for i := 0; i < countIO; i++ {
-					id := int(input[posInInput])
-					posInInput++
-					data = input[posInInput : posInInput+2]
-					posInInput += 2
-					encodedStr = hex.EncodeToString(data)
-					d, err := strconv.ParseInt(encodedStr, 16, 16)
-					if err == nil {
-						switch id {
-						case 66:
-							gpsData.AccV = float64(d) / 1000
-						case 67:
-							gpsData.BatV = float64(d) / 1000
-						case 203:
-							gpsData.Dut2 = d
-							gpsData.UseDut = true
-						case 201:
-							gpsData.Dut1 = d
-							gpsData.UseDut = true
-						default:
-							gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-						}
-					} else {
-						T.GPS.LastError = "error parse io param 2b: " + err.Error()
-					}
-				}
-			case 2:
-				countIO := int(input[posInInput]) // Кол-во датчиков разрядности 4 байта
-				posInInput++
-				for i := 0; i < countIO; i++ {
-					id := int(input[posInInput])
-					posInInput++
-					data = input[posInInput : posInInput+4]
-					posInInput += 4
-					encodedStr = hex.EncodeToString(data)
-					d, err := strconv.ParseInt(encodedStr, 16, 64) //32
-					if err == nil {
-						switch id {
-						case 153:
-							gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Odometer=%.0f;", float64(d)*0.005))
-						default:
-							gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-						}
-					} else {
-						T.GPS.LastError = "error parse io param 4b: " + err.Error()
-					}
-				}
-			case 3:
-				countIO := int(input[posInInput]) // Кол-во датчиков разрядности 8 байт
-				posInInput++
-				for i := 0; i < countIO; i++ {
-					id := int(input[posInInput])
-					posInInput++
-					data = input[posInInput : posInInput+8]
-					posInInput += 8
-					encodedStr = hex.EncodeToString(data)
-					d, err := strconv.ParseInt(encodedStr, 16, 64)
-					if err == nil {
-						gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-					} else {
-						T.GPS.LastError = "error parse io param 8b: " + err.Error()
-					}
-				}
+		posInInput += 2 //Event IO ID и общее кол-во датчиков
+
+		posInInput, err = ioCodec8.parse(input, posInInput, func(id int, v []byte) {
+			d := ioValue(v)
+			switch {
+			case id == 66 && len(v) == 2:
+				gpsData.AccV = float64(d) / 1000
+			case id == 67 && len(v) == 2:
+				gpsData.BatV = float64(d) / 1000
+			case id == 203 && len(v) == 2:
+				gpsData.Dut2 = d
+				gpsData.UseDut = true
+			case id == 201 && len(v) == 2:
+				gpsData.Dut1 = d
+				gpsData.UseDut = true
+			case id == 153 && len(v) == 4:
+				gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Odometer=%.0f;", float64(d)*0.005))
+			default:
+				gpsData.OtherID = append(gpsData.OtherID, ioParam(id, v))
 			}
+		})
+		if err != nil {
+			return T.ReturnError(err.Error())
 		}
 
 		err = T.GPS.Chk(gpsData, T.ChkPar)
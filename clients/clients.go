@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gps_clients/server_gps_service/models"
+)
+
+//Parser разбор пакетов протокола трекера
+type Parser interface {
+	ParseData() error
+	GetBadPacketByte() []byte
+	Model() *models.ProtocolModel
+}
+
+//HTTPParser разбор протокола поверх HTTP: порт обслуживает HTTP-сервер,
+//запрос передается разборщику перед каждым ParseData
+type HTTPParser interface {
+	Parser
+	SetRequest(r *http.Request)
+}
+
+//Flusher разборщик, собирающий точку из нескольких пакетов: Flush записывает
+//собранное к закрытию соединения
+type Flusher interface {
+	Flush() error
+}
+
+//DefaultProtocol протокол порта, если не указан в настройках
+const DefaultProtocol = "gryphonpro"
+
+//New создает разборщик протокола по имени
+func New(protocol string) (Parser, error) {
+	switch strings.ToLower(protocol) {
+	case "teltonika":
+		return &Teltonika{}, nil
+	case "bitrek":
+		return &Bitrek{}, nil
+	case "cargo":
+		return &Cargo{}, nil
+	case "gryphonpro":
+		return &GryphonPro{}, nil
+	case "gryphonm01":
+		return &GryphonM01{}, nil
+	case "wialon":
+		return &Wialon{}, nil
+	case "gt06":
+		return &GT06{}, nil
+	case "queclink":
+		return &Queclink{}, nil
+	case "galileosky":
+		return &Galileosky{}, nil
+	case "navtelecom":
+		return &Navtelecom{}, nil
+	case "egts":
+		return &EGTS{}, nil
+	case "meitrack":
+		return &Meitrack{}, nil
+	case "ruptela":
+		return &Ruptela{}, nil
+	case "osmand":
+		return &OsmAnd{}, nil
+	case "h02", "tk103":
+		return &H02{}, nil
+	case "nmea":
+		return &NMEA{}, nil
+	default:
+		return nil, fmt.Errorf("unknown protocol %s", protocol)
+	}
+}
@@ -0,0 +1,426 @@
+package clients
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gps_clients/server_gps_service/hash"
+	"gps_clients/server_gps_service/models"
+)
+
+//EGTS протокол ГОСТ Р 54619 / ГОСТ 33472: транспортный пакет (заголовок с CRC8, данные с CRC16),
+//в данных записи сервисов авторизации и телематики. Номера исходящих пакетов и записей
+//ведутся на соединение, поэтому модель встроена в структуру.
+type EGTS struct {
+	models.ProtocolModel
+	pid uint16
+	rn  uint16
+}
+
+//типы пакетов, сервисы, подзаписи и коды EGTS
+const (
+	egtsPTResponse = 0
+	egtsPTAppData  = 1
+
+	egtsAuthService     = 1
+	egtsTeledataService = 2
+
+	egtsSRRecordResponse = 0
+	egtsSRTermIdentity   = 1
+	egtsSRAuthInfo       = 7
+	egtsSRResultCode     = 9
+	egtsSRPosData        = 16
+	egtsSRExtPosData     = 17
+	egtsSRLiquidLevel    = 27
+
+	egtsPCOk          = 0
+	egtsPCUnsService  = 131
+	egtsHeadSize      = 11
+	egtsHeadRouteSize = 16
+)
+
+//egtsEpoch начало отсчета времени EGTS
+var egtsEpoch = time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func (T *EGTS) Model() *models.ProtocolModel {
+	return &T.ProtocolModel
+}
+
+//GetBadPacketByte ответ с ошибкой требует номер пакета, поэтому не отправляется; терминал повторит пакет
+func (T *EGTS) GetBadPacketByte() []byte {
+	return []byte{}
+}
+
+func (T *EGTS) ReturnError(err string) error {
+	T.GPS.LastError = err
+	return errors.New(T.GPS.LastError)
+}
+
+func (T *EGTS) ParseData() error {
+	defer func() {
+		if recMes := recover(); recMes != nil {
+			T.GPS.Log().Error("panic parse data: %v", recMes)
+		}
+	}()
+	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
+	T.GPS.LastInfo = ""
+	T.GPS.LastError = "no data"
+	T.GPS.CountData = nil
+
+	var records models.Records
+
+	addRecord := func(gpsData models.GPSData, fix, hasSat bool) {
+		chk := T.ChkPar
+		if fix && !hasSat {
+			//без EGTS_SR_EXT_POS_DATA число спутников неизвестно, достаточно признака достоверности
+			chk.Sat = 0
+		}
+		T.GPS.AddRecord(&records, gpsData, fix, chk)
+	}
+
+	//в одном чтении может прийти несколько пакетов, каждый подтверждается отдельно
+	input := T.Input
+	for len(input) > 0 {
+		pid, pt, sfrd, rest, err := egtsFrame(input)
+		if err != nil {
+			return T.ReturnError(err.Error())
+		}
+		input = rest
+
+		switch pt {
+		case egtsPTResponse:
+			//подтверждение пакета сервера (кода результата авторизации)
+			T.GPS.LastInfo = "response"
+			T.GPS.LastError = ""
+			continue
+		case egtsPTAppData:
+		default:
+			return T.ReturnError(fmt.Sprintf("unsupported packet type %d", pt))
+		}
+
+		//ответ: номер принятого пакета, результат и записи EGTS_SR_RECORD_RESPONSE
+		answer := make([]byte, 3)
+		binary.LittleEndian.PutUint16(answer, pid)
+		var login bool
+
+		for len(sfrd) > 0 {
+			if len(sfrd) < 7 {
+				return T.ReturnError("bad record length")
+			}
+			rl := int(binary.LittleEndian.Uint16(sfrd[0:2]))
+			rn := binary.LittleEndian.Uint16(sfrd[2:4])
+			rfl := sfrd[4]
+			pos := 5
+
+			//необязательные OID, EVID, TM по 4 байта, затем SST и RST
+			hl := pos + 2
+			for _, bit := range []byte{0x01, 0x02, 0x04} {
+				if rfl&bit != 0 {
+					hl += 4
+				}
+			}
+			if len(sfrd) < hl {
+				return T.ReturnError(fmt.Sprintf("error record header length: %d, have %d", hl, len(sfrd)))
+			}
+
+			var oid string
+			if rfl&0x01 != 0 {
+				oid = strconv.FormatUint(uint64(binary.LittleEndian.Uint32(sfrd[pos:])), 10)
+				pos += 4
+			}
+			if rfl&0x02 != 0 {
+				pos += 4 //EVID
+			}
+			if rfl&0x04 != 0 {
+				pos += 4 //TM
+			}
+			sst := sfrd[pos]
+			pos += 2
+			if len(sfrd) < pos+rl {
+				return T.ReturnError(fmt.Sprintf("error record length: %d, have %d", rl, len(sfrd)-pos))
+			}
+			rd := sfrd[pos : pos+rl]
+			sfrd = sfrd[pos+rl:]
+
+			status := byte(egtsPCOk)
+			switch sst {
+			case egtsAuthService:
+				ok, err := T.auth(rd)
+				if err != nil {
+					return T.ReturnError(err.Error())
+				}
+				login = login || ok
+			case egtsTeledataService:
+				//без авторизации устройство определяется по OID записи; после нее OID - идентификатор терминала
+				if T.GPS.Name == "" && oid != "" {
+					T.GPS.Name = oid
+					if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+						return T.ReturnError(err.Error())
+					}
+				}
+				if T.GPS.Name == "" {
+					return T.ReturnError("teledata before authorization")
+				}
+				if err := egtsTeledata(rd, addRecord); err != nil {
+					return T.ReturnError(err.Error())
+				}
+			default:
+				status = egtsPCUnsService
+			}
+
+			answer = append(answer, T.record(sst, []byte{egtsSRRecordResponse, 3, 0, byte(rn), byte(rn >> 8), status})...)
+		}
+
+		T.GPS.CountData = append(T.GPS.CountData, T.packet(egtsPTResponse, answer)...)
+		if login {
+			//результат авторизации отдельным пакетом сервиса авторизации
+			T.GPS.CountData = append(T.GPS.CountData,
+				T.packet(egtsPTAppData, T.record(egtsAuthService, []byte{egtsSRResultCode, 1, 0, egtsPCOk}))...)
+		}
+	}
+
+	if err := T.GPS.SaveRecords(T.Path, records); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//egtsFrame первый транспортный пакет входа: номер, тип, данные и остаток
+func egtsFrame(input []byte) (pid uint16, pt byte, sfrd, rest []byte, err error) {
+	if len(input) < egtsHeadSize {
+		return 0, 0, nil, nil, fmt.Errorf("short packet %x", input)
+	}
+	if input[0] != 0x01 {
+		return 0, 0, nil, nil, fmt.Errorf("unsupported protocol version %d", input[0])
+	}
+	//флаги: биты 3-4 - шифрование, бит 2 - сжатие
+	if input[2]&0x1C != 0 {
+		return 0, 0, nil, nil, fmt.Errorf("unsupported encryption or compression, flags %02x", input[2])
+	}
+	hl := int(input[3])
+	if hl != egtsHeadSize && hl != egtsHeadRouteSize {
+		return 0, 0, nil, nil, fmt.Errorf("bad header length %d", hl)
+	}
+	if len(input) < hl {
+		return 0, 0, nil, nil, fmt.Errorf("short packet %x", input)
+	}
+	if crc := hash.CheckSumCRC8(input[:hl-1]); crc != input[hl-1] {
+		return 0, 0, nil, nil, fmt.Errorf("error header crc: origCRC= %02x, dataCRC= %02x", input[hl-1], crc)
+	}
+
+	fdl := int(binary.LittleEndian.Uint16(input[5:7]))
+	pid = binary.LittleEndian.Uint16(input[7:9])
+	pt = input[9]
+	end := hl
+	if fdl > 0 {
+		end = hl + fdl + 2
+	}
+	if len(input) < end {
+		return 0, 0, nil, nil, fmt.Errorf("error length: %d, have %d", fdl, len(input)-hl)
+	}
+	sfrd = input[hl : hl+fdl]
+	if fdl > 0 {
+		origCRC := binary.LittleEndian.Uint16(input[hl+fdl:])
+		if dataCRC := hash.CheckSumCRC16CCITT(sfrd); origCRC != dataCRC {
+			return 0, 0, nil, nil, fmt.Errorf("error crc sum: origCRC= %04x, dataCRC= %04x", origCRC, dataCRC)
+		}
+	}
+	return pid, pt, sfrd, input[end:], nil
+}
+
+//packet транспортный пакет сервера
+func (T *EGTS) packet(pt byte, sfrd []byte) []byte {
+	b := []byte{0x01, 0x00, 0x00, egtsHeadSize, 0x00, byte(len(sfrd)), byte(len(sfrd) >> 8),
+		byte(T.pid), byte(T.pid >> 8), pt}
+	T.pid++
+	b = append(b, hash.CheckSumCRC8(b))
+	b = append(b, sfrd...)
+	crc := hash.CheckSumCRC16CCITT(sfrd)
+	return append(b, byte(crc), byte(crc>>8))
+}
+
+//record запись сервиса service с подзаписями rd
+func (T *EGTS) record(service byte, rd []byte) []byte {
+	b := []byte{byte(len(rd)), byte(len(rd) >> 8), byte(T.rn), byte(T.rn >> 8), 0x00, service, service}
+	T.rn++
+	return append(b, rd...)
+}
+
+//auth подзаписи сервиса авторизации; ok - получен идентификатор терминала
+func (T *EGTS) auth(rd []byte) (ok bool, err error) {
+	for len(rd) > 0 {
+		if len(rd) < 3 {
+			return false, errors.New("bad subrecord length")
+		}
+		srt := rd[0]
+		srl := int(binary.LittleEndian.Uint16(rd[1:3]))
+		if len(rd) < 3+srl {
+			return false, fmt.Errorf("error subrecord %d length: %d, have %d", srt, srl, len(rd)-3)
+		}
+		srd := rd[3 : 3+srl]
+		rd = rd[3+srl:]
+
+		switch srt {
+		case egtsSRTermIdentity:
+			name, err := egtsTermIdentity(srd)
+			if err != nil {
+				return false, err
+			}
+			if T.GPS.Name != "" && T.GPS.Name != name {
+				return false, fmt.Errorf("terminal %s on connection of %s", name, T.GPS.Name)
+			}
+			T.GPS.Name = name
+			if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+				return false, err
+			}
+			T.GPS.LastInfo = "authorization"
+			T.GPS.LastError = ""
+			ok = true
+		case egtsSRAuthInfo:
+			//имя пользователя и пароль не проверяются
+			T.GPS.LastInfo = "auth info " + strings.SplitN(string(srd), "\x00", 2)[0]
+			T.GPS.LastError = ""
+		}
+	}
+	return ok, nil
+}
+
+//egtsTermIdentity EGTS_SR_TERM_IDENTITY: TID и флаги необязательных полей; имя - IMEI, если передан, иначе TID
+func egtsTermIdentity(b []byte) (string, error) {
+	if len(b) < 5 {
+		return "", errors.New("bad term identity length")
+	}
+	name := strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[0:4])), 10)
+	flags := b[4]
+	pos := 5
+	if flags&0x01 != 0 {
+		pos += 2 //HDID
+	}
+	if flags&0x02 != 0 {
+		if len(b) < pos+15 {
+			return "", errors.New("bad term identity length")
+		}
+		if imei := strings.Trim(string(b[pos:pos+15]), "\x000 "); imei != "" {
+			name = string(b[pos : pos+15])
+		}
+	}
+	return name, nil
+}
+
+//egtsTeledata подзаписи сервиса телематики; каждая EGTS_SR_POS_DATA - новая точка
+func egtsTeledata(rd []byte, addRecord func(models.GPSData, bool, bool)) error {
+	var gpsData models.GPSData
+	var has, fix, hasSat bool
+
+	flush := func() {
+		if has {
+			addRecord(gpsData, fix, hasSat)
+		}
+		gpsData = models.GPSData{}
+		has, fix, hasSat = false, false, false
+	}
+
+	for len(rd) > 0 {
+		if len(rd) < 3 {
+			return errors.New("bad subrecord length")
+		}
+		srt := rd[0]
+		srl := int(binary.LittleEndian.Uint16(rd[1:3]))
+		if len(rd) < 3+srl {
+			return fmt.Errorf("error subrecord %d length: %d, have %d", srt, srl, len(rd)-3)
+		}
+		srd := rd[3 : 3+srl]
+		rd = rd[3+srl:]
+
+		switch srt {
+		case egtsSRPosData:
+			if len(srd) < 21 {
+				return errors.New("bad pos data length")
+			}
+			flush()
+			has = true
+			gpsData.DateTime = egtsEpoch.Add(time.Duration(binary.LittleEndian.Uint32(srd[0:4])) * time.Second).Local()
+
+			//координаты: доля от 90 и 180 градусов в 0xFFFFFFFF
+			gpsData.Lat = float64(binary.LittleEndian.Uint32(srd[4:8])) * 90 / 0xFFFFFFFF
+			gpsData.Lng = float64(binary.LittleEndian.Uint32(srd[8:12])) * 180 / 0xFFFFFFFF
+
+			//флаги: 7 - есть высота, 6 - западная долгота, 5 - южная широта, 0 - координаты достоверны
+			flg := srd[12]
+			fix = flg&0x01 != 0
+			if flg&0x20 != 0 {
+				gpsData.Lat = -gpsData.Lat
+			}
+			if flg&0x40 != 0 {
+				gpsData.Lng = -gpsData.Lng
+			}
+
+			//скорость: биты 0-13 в 0.1 км/ч, 14 - знак высоты, 15 - старший бит курса
+			spd := binary.LittleEndian.Uint16(srd[13:15])
+			gpsData.Speed = int64(spd&0x3FFF) / 10
+			gpsData.Angle = int64(srd[15]) | int64(spd>>15)<<8
+
+			odm := uint32(srd[16]) | uint32(srd[17])<<8 | uint32(srd[18])<<16
+			gpsData.OtherID = append(gpsData.OtherID,
+				fmt.Sprintf("Mileage=%.1f;", float64(odm)/10),
+				fmt.Sprintf("Inputs=%d;", srd[19]),
+				fmt.Sprintf("Event=%d;", srd[20]))
+
+			if flg&0x80 != 0 && len(srd) >= 24 {
+				gpsData.Alt = int64(uint32(srd[21]) | uint32(srd[22])<<8 | uint32(srd[23])<<16)
+				if spd&0x4000 != 0 {
+					gpsData.Alt = -gpsData.Alt
+				}
+			}
+
+		case egtsSRExtPosData:
+			if !has || len(srd) < 1 {
+				continue
+			}
+			//флаги наличия: 0 - VDOP, 1 - HDOP, 2 - PDOP, 3 - спутники, 4 - навигационные системы
+			flg := srd[0]
+			pos := 1
+			if flg&0x01 != 0 {
+				pos += 2
+			}
+			if flg&0x02 != 0 && len(srd) >= pos+2 {
+				gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("HDOP=%.2f;", float64(binary.LittleEndian.Uint16(srd[pos:]))/100))
+				pos += 2
+			}
+			if flg&0x04 != 0 {
+				pos += 2
+			}
+			if flg&0x08 != 0 && len(srd) > pos {
+				gpsData.Sat = int64(srd[pos])
+				hasSat = true
+			}
+
+		case egtsSRLiquidLevel:
+			if !has || len(srd) < 7 {
+				continue
+			}
+			//флаги: биты 0-2 - номер датчика, 3 - в данных не значение, а сырые данные, 6 - ошибка
+			if srd[0]&0x48 != 0 {
+				continue
+			}
+			v := int64(binary.LittleEndian.Uint32(srd[3:7]))
+			switch n := srd[0] & 0x07; n {
+			case 1:
+				gpsData.Dut1 = v
+				gpsData.UseDut = true
+			case 2:
+				gpsData.Dut2 = v
+				gpsData.UseDut = true
+			default:
+				gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("LLS%d=%d;", n, v))
+			}
+		}
+	}
+	flush()
+	return nil
+}
@@ -0,0 +1,139 @@
+package clients
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/hash"
+)
+
+const egtsIMEI = "868204005647838"
+
+//egtsFrameBytes транспортный пакет с CRC8 заголовка и CRC16 данных
+func egtsFrameBytes(pid uint16, pt byte, sfrd []byte) []byte {
+	b := []byte{0x01, 0x00, 0x00, egtsHeadSize, 0x00, byte(len(sfrd)), byte(len(sfrd) >> 8), byte(pid), byte(pid >> 8), pt}
+	b = append(b, hash.CheckSumCRC8(b))
+	b = append(b, sfrd...)
+	crc := hash.CheckSumCRC16CCITT(sfrd)
+	return append(b, byte(crc), byte(crc>>8))
+}
+
+//egtsTermRecord запись терминала; OID в заголовке, если oid не 0
+func egtsTermRecord(rn uint16, oid uint32, sst byte, rd []byte) []byte {
+	b := []byte{byte(len(rd)), byte(len(rd) >> 8), byte(rn), byte(rn >> 8), 0x00}
+	if oid != 0 {
+		b[4] = 0x01
+		b = append(b, byte(oid), byte(oid>>8), byte(oid>>16), byte(oid>>24))
+	}
+	b = append(b, sst, sst)
+	return append(b, rd...)
+}
+
+func egtsSubrecord(srt byte, srd []byte) []byte {
+	return append([]byte{srt, byte(len(srd)), byte(len(srd) >> 8)}, srd...)
+}
+
+//egtsLogin EGTS_SR_TERM_IDENTITY: TID 100500 и IMEI
+func egtsLogin(pid, rn uint16, oid uint32) []byte {
+	srd := []byte{0x94, 0x88, 0x01, 0x00, 0x02}
+	srd = append(srd, egtsIMEI...)
+	return egtsFrameBytes(pid, egtsPTAppData, egtsTermRecord(rn, oid, egtsAuthService, egtsSubrecord(egtsSRTermIdentity, srd)))
+}
+
+//egtsPosData точка 55.752 N 37.6175 W: 60 км/ч, курс 300, пробег 123.4 км, входы 5, высота 150, 8 спутников
+func egtsPosData(pid, rn uint16, oid uint32, tm time.Time) []byte {
+	b := make([]byte, 24)
+	binary.LittleEndian.PutUint32(b[0:], uint32(tm.Sub(egtsEpoch)/time.Second))
+	binary.LittleEndian.PutUint32(b[4:], uint32(math.Round(55.752/90*0xFFFFFFFF)))
+	binary.LittleEndian.PutUint32(b[8:], uint32(math.Round(37.6175/180*0xFFFFFFFF)))
+	b[12] = 0x81 | 0x40
+	binary.LittleEndian.PutUint16(b[13:], 600|1<<15)
+	b[15] = 300 & 0xFF
+	b[16], b[17] = 0xD2, 0x04 //ODM 1234
+	b[19] = 5
+	b[21] = 150
+	rd := append(egtsSubrecord(egtsSRPosData, b), egtsSubrecord(egtsSRExtPosData, []byte{0x08, 8})...)
+	return egtsFrameBytes(pid, egtsPTAppData, egtsTermRecord(rn, oid, egtsTeledataService, rd))
+}
+
+//egtsResponse пакет сервера pid: подтверждение пакета rpid, запись srn с результатом записи rn
+func egtsResponse(pid, rpid, srn, rn uint16, sst, status byte) []byte {
+	sfrd := []byte{byte(rpid), byte(rpid >> 8), egtsPCOk}
+	sfrd = append(sfrd, egtsTermRecord(srn, 0, sst, egtsSubrecord(egtsSRRecordResponse, []byte{byte(rn), byte(rn >> 8), status}))...)
+	return egtsFrameBytes(pid, egtsPTResponse, sfrd)
+}
+
+func TestEGTSParse(t *testing.T) {
+	tm := time.Date(2025, 9, 18, 10, 20, 30, 0, time.UTC)
+	concat := func(b ...[]byte) []byte { return bytes.Join(b, nil) }
+
+	badHeader := egtsLogin(1, 0, 0)
+	badHeader[7] ^= 0xFF
+	badData := egtsLogin(1, 0, 0)
+	badData[len(badData)-3] ^= 0xFF
+
+	tests := []struct {
+		name  string
+		input []byte
+		err   bool
+		dev   string
+		ack   []byte
+		point bool
+	}{
+		//OID записи - идентификатор терминала, имя устройства из IMEI EGTS_SR_TERM_IDENTITY
+		{name: "auth by imei", input: concat(egtsLogin(1, 0, 100500), egtsPosData(2, 1, 100500, tm)), dev: egtsIMEI,
+			ack: concat(
+				egtsResponse(0, 1, 0, 0, egtsAuthService, egtsPCOk),
+				egtsFrameBytes(1, egtsPTAppData, egtsTermRecord(1, 0, egtsAuthService, egtsSubrecord(egtsSRResultCode, []byte{egtsPCOk}))),
+				egtsResponse(2, 2, 2, 1, egtsTeledataService, egtsPCOk),
+			), point: true},
+		//без авторизации устройство по OID
+		{name: "teledata by oid", input: egtsPosData(1, 0, 100500, tm), dev: "100500",
+			ack: egtsResponse(0, 1, 0, 0, egtsTeledataService, egtsPCOk), point: true},
+		{name: "teledata before auth", input: egtsPosData(1, 0, 0, tm), err: true},
+		{name: "bad header crc", input: badHeader, err: true},
+		{name: "bad data crc", input: badData, err: true},
+		//флаги OID, EVID, TM без самих полей
+		{name: "short record header", input: egtsFrameBytes(1, egtsPTAppData, []byte{0, 0, 0, 0, 0x07, 1, 2, 3, 4}), err: true},
+		{name: "short record header oid", input: egtsFrameBytes(1, egtsPTAppData, []byte{0, 0, 0, 0, 0x01, 1, 2}), err: true},
+	}
+	for _, tt := range tests {
+		T := &EGTS{}
+		T.Path = t.TempDir() + "/"
+		T.Input = tt.input
+		err := T.ParseData()
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if T.GPS.Name != tt.dev {
+			t.Errorf("%s: name %q, want %q", tt.name, T.GPS.Name, tt.dev)
+		}
+		if string(T.GPS.CountData) != string(tt.ack) {
+			t.Errorf("%s: ack\n%s\nwant\n%s", tt.name, hex.EncodeToString(T.GPS.CountData), hex.EncodeToString(tt.ack))
+		}
+		if !tt.point {
+			continue
+		}
+
+		d := T.GPS.GpsD
+		if !d.DateTime.Equal(tm) || math.Abs(d.Lat-55.752) > 1e-6 || math.Abs(d.Lng+37.6175) > 1e-6 ||
+			d.Speed != 60 || d.Angle != 300 || d.Alt != 150 || d.Sat != 8 {
+			t.Errorf("%s: record %+v", tt.name, d)
+		}
+		if other := strings.Join(d.OtherID, ""); other != "Mileage=123.4;Inputs=5;Event=0;" {
+			t.Errorf("%s: other %q", tt.name, other)
+		}
+	}
+}
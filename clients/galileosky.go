@@ -0,0 +1,236 @@
+package clients
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gps_clients/server_gps_service/hash"
+	"gps_clients/server_gps_service/models"
+)
+
+//Galileosky двоичный протокол с тегами: 0x01, длина (бит 15 - есть данные в архиве), теги, CRC16-MODBUS.
+//Ответ - 0x02 и контрольная сумма принятого пакета.
+type Galileosky models.ProtocolModel
+
+func (T *Galileosky) Model() *models.ProtocolModel {
+	return (*models.ProtocolModel)(T)
+}
+
+//GetBadPacketByte отрицательного ответа в протоколе нет, неподтвержденный пакет трекер повторит
+func (T *Galileosky) GetBadPacketByte() []byte {
+	return []byte{}
+}
+
+func (T *Galileosky) ReturnError(err string) error {
+	T.GPS.LastError = err
+	return errors.New(T.GPS.LastError)
+}
+
+//galileoTagSize размер значения тега в байтах
+func galileoTagSize(tag byte) int {
+	switch {
+	case tag == 0x01, tag == 0x02, tag == 0x35, tag == 0x43, tag == 0x49,
+		tag >= 0x88 && tag <= 0x8C, tag >= 0xA0 && tag <= 0xAF, tag >= 0xC4 && tag <= 0xD2, tag == 0xD5:
+		return 1
+	case tag == 0x04, tag == 0x10, tag == 0x21, tag == 0x34, tag == 0x40, tag == 0x41, tag == 0x42,
+		tag == 0x45, tag == 0x46, tag == 0x48, tag >= 0x50 && tag <= 0x59, tag >= 0x60 && tag <= 0x62,
+		tag >= 0x70 && tag <= 0x79, tag >= 0xB0 && tag <= 0xB9, tag >= 0xD6 && tag <= 0xDA:
+		return 2
+	case tag == 0x5D, tag >= 0x63 && tag <= 0x6F, tag >= 0x80 && tag <= 0x87:
+		return 3
+	case tag == 0x20, tag == 0x33, tag == 0x44, tag == 0x47, tag == 0x5A, tag == 0x90,
+		tag >= 0xC0 && tag <= 0xC3, tag == 0xD3, tag == 0xD4, tag >= 0xDB && tag <= 0xDF,
+		tag >= 0xE2 && tag <= 0xE9, tag >= 0xF0 && tag <= 0xF9:
+		return 4
+	case tag == 0x30:
+		return 9
+	case tag == 0x03:
+		return 15
+	case tag == 0x5C:
+		return 68
+	}
+	return 0
+}
+
+func (T *Galileosky) ParseData() error {
+	defer func() {
+		if recMes := recover(); recMes != nil {
+			T.GPS.Log().Error("panic parse data: %v", recMes)
+		}
+	}()
+	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
+	T.GPS.LastInfo = ""
+	T.GPS.LastError = "no data"
+
+	input := T.Input
+	if len(input) < 5 {
+		return T.ReturnError(fmt.Sprintf("short packet %x", input))
+	}
+	if input[0] != 0x01 {
+		return T.ReturnError(fmt.Sprintf("bad header %x", input[0]))
+	}
+
+	lenPacket := int(binary.LittleEndian.Uint16(input[1:3]) & 0x7FFF)
+	archive := input[2]&0x80 != 0
+	if len(input) != lenPacket+5 {
+		return T.ReturnError(fmt.Sprintf("error length: %d != %d", lenPacket, len(input)-5))
+	}
+
+	origCRC := binary.LittleEndian.Uint16(input[3+lenPacket:])
+	if dataCRC := hash.CheckSumCRC16Modbus(input[:3+lenPacket]); origCRC != dataCRC {
+		return T.ReturnError(fmt.Sprintf("error crc sum: origCRC= %d, dataCRC= %d", origCRC, dataCRC))
+	}
+
+	T.GPS.CountData = append([]byte{0x02}, input[3+lenPacket:]...)
+
+	return T.ParceTags(input[3:3+lenPacket], archive)
+}
+
+//ParceTags разбор записей; новая запись начинается с повтора уже встреченного тега
+func (T *Galileosky) ParceTags(input []byte, archive bool) error {
+	T.GPS.LastError = ""
+
+	var records models.Records
+
+	var gpsData models.GPSData
+	var hasTime, hasCoord, fix bool
+	seen := make(map[byte]bool)
+
+	flush := func() {
+		defer func() {
+			gpsData = models.GPSData{}
+			hasTime, hasCoord, fix = false, false, false
+			seen = make(map[byte]bool)
+		}()
+		if !hasTime || !hasCoord {
+			//заголовочный пакет или запись без навигации
+			return
+		}
+		if archive {
+			gpsData.OtherID = append(gpsData.OtherID, "Archive=1;")
+		}
+
+		T.GPS.AddRecord(&records, gpsData, fix, T.ChkPar)
+	}
+
+	pos := 0
+	for pos < len(input) {
+		tag := input[pos]
+		pos++
+
+		size := galileoTagSize(tag)
+		if tag == 0xEA {
+			//массив пользователя: длина 1 байт и данные
+			size = 1 + int(input[pos])
+		}
+		if size == 0 {
+			return T.ReturnError(fmt.Sprintf("unknown tag 0x%02x", tag))
+		}
+		if pos+size > len(input) {
+			return T.ReturnError(fmt.Sprintf("error length tag 0x%02x", tag))
+		}
+		v := input[pos : pos+size]
+		pos += size
+
+		if seen[tag] {
+			flush()
+		}
+		seen[tag] = true
+
+		var d uint32
+		switch size {
+		case 1:
+			d = uint32(v[0])
+		case 2:
+			d = uint32(binary.LittleEndian.Uint16(v))
+		case 3:
+			d = uint32(v[0]) | uint32(v[1])<<8 | uint32(v[2])<<16
+		case 4:
+			d = binary.LittleEndian.Uint32(v)
+		}
+
+		switch {
+		case tag == 0x03:
+			name := strings.TrimRight(string(v), "\x00 ")
+			if T.GPS.Name == "" {
+				T.GPS.Name = name
+				if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+					return T.ReturnError(err.Error())
+				}
+			} else if T.GPS.Name != name {
+				return T.ReturnError(fmt.Sprintf("imei %s on connection of %s", name, T.GPS.Name))
+			}
+		case tag == 0x01 || tag == 0x02 || tag == 0x04 || tag == 0x10 || tag == 0x21:
+			//версии, ID устройства, номер записи, миллисекунды
+		case tag == 0x20:
+			gpsData.DateTime = time.Unix(int64(d), 0).In(time.UTC)
+			hasTime = true
+		case tag == 0x30:
+			//младшие 4 бита - спутники, старшие - признак достоверности (0 - координаты верны)
+			gpsData.Sat = int64(v[0] & 0x0F)
+			fix = v[0]>>4 == 0
+			gpsData.Lat = float64(int32(binary.LittleEndian.Uint32(v[1:5]))) / 1000000
+			gpsData.Lng = float64(int32(binary.LittleEndian.Uint32(v[5:9]))) / 1000000
+			hasCoord = true
+		case tag == 0x33:
+			gpsData.Speed = int64(binary.LittleEndian.Uint16(v[0:2]) / 10)
+			gpsData.Angle = int64(binary.LittleEndian.Uint16(v[2:4]) / 10)
+		case tag == 0x34:
+			gpsData.Alt = int64(int16(d))
+		case tag == 0x41:
+			gpsData.AccV = float64(d) / 1000
+		case tag == 0x42:
+			gpsData.BatV = float64(d) / 1000
+		case tag == 0x43:
+			gpsData.TempC = float64(int8(d))
+			gpsData.UseTempC = true
+		case tag == 0x45:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Outputs=%d;", d))
+		case tag == 0x46:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Inputs=%d;", d))
+		case tag >= 0x50 && tag <= 0x57:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("AIN%d=%d;", tag-0x50, d))
+		case tag == 0x60:
+			//ДУТ RS485 0 и 1, как Dut1/Dut2 остальных протоколов
+			gpsData.Dut1 = int64(d)
+			gpsData.UseDut = true
+		case tag == 0x61:
+			gpsData.Dut2 = int64(d)
+			gpsData.UseDut = true
+		case tag == 0x62:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("RS485_2=%d;", d))
+		case tag >= 0x63 && tag <= 0x6F:
+			//уровень 2 байта и температура 1 байт
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("RS485_%d=%d;", tag-0x60, binary.LittleEndian.Uint16(v[0:2])))
+		case tag == 0x90:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("iButton=%08X;", d))
+		case tag == 0xC0:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("CANFuel=%.1f;", float64(d)/2))
+		case tag == 0xC1:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("CANFuelLevel=%.1f;CANTemp=%d;CANRPM=%.f;",
+				float64(v[0])*0.4, int(v[1])-40, float64(binary.LittleEndian.Uint16(v[2:4]))*0.125))
+		case tag == 0xC2:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("CANMileage=%d;", d*5))
+		case tag == 0xD4:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Mileage=%d;", d))
+		case tag == 0xEA || tag == 0x5C:
+			//массивы без разбора
+		default:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", tag, d))
+		}
+	}
+	flush()
+
+	if T.GPS.Name == "" {
+		return T.ReturnError("no imei before data")
+	}
+
+	if err := T.GPS.SaveRecords(T.Path, records); err != nil {
+		return err
+	}
+
+	return nil
+}
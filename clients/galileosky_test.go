@@ -0,0 +1,90 @@
+package clients
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/hash"
+)
+
+//galileoPacket пакет с заголовком 0x01, длиной и CRC16-MODBUS по теговой части body
+func galileoPacket(t *testing.T, archive bool, body string) []byte {
+	tags, err := hex.DecodeString(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := uint16(len(tags))
+	if archive {
+		n |= 0x8000
+	}
+	b := append([]byte{0x01, byte(n), byte(n >> 8)}, tags...)
+	crc := hash.CheckSumCRC16Modbus(b)
+	return append(b, byte(crc), byte(crc>>8))
+}
+
+const (
+	//заголовочный пакет как в документации: версии, IMEI 868204005647838, ID устройства
+	galileoHead = "0182" + "0210" + "03383638323034303035363437383338" + "043200"
+	//запись 18.09.2025 10:20:30 UTC: 8 спутников, 55.752 37.6175, 60 км/ч, курс 180, высота 150,
+	//питание 13.8 В, батарея 4.1 В, -5 C, пробег 10000 м
+	galileoRecord = "20eedccb68" + "3008" + "40b55203" + "5cff3d02" + "335d020807" + "349600" +
+		"41e835" + "420410" + "43fb" + "d410270000"
+	//через 10 секунд, координаты недостоверны
+	galileoNoFix = "20f8dccb68" + "3018" + "40b55203" + "5cff3d02"
+)
+
+func TestGalileosky(t *testing.T) {
+	T := &Galileosky{Path: t.TempDir() + "/"}
+
+	head := galileoPacket(t, false, galileoHead)
+	T.Input = head
+	if err := T.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	//ответ - 0x02 и CRC принятого пакета
+	if ack := hex.EncodeToString(T.GPS.CountData); ack != "02"+hex.EncodeToString(head[len(head)-2:]) {
+		t.Fatalf("ack %s", ack)
+	}
+	if T.GPS.Name != "868204005647838" {
+		t.Fatalf("name %q", T.GPS.Name)
+	}
+
+	data := galileoPacket(t, true, galileoRecord+galileoNoFix)
+	T.Input = data
+	if err := T.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	if ack := hex.EncodeToString(T.GPS.CountData); ack != "02"+hex.EncodeToString(data[len(data)-2:]) {
+		t.Fatalf("ack %s", ack)
+	}
+	if T.GPS.LastError != "no gps fix" {
+		t.Fatalf("last record error %q", T.GPS.LastError)
+	}
+	d := T.GPS.GpsD
+	//время сохраняется в UTC независимо от часового пояса сервера
+	if d.DateTime != time.Date(2025, 9, 18, 10, 20, 30, 0, time.UTC) || d.Sat != 8 ||
+		d.Lat != 55.752 || d.Lng != 37.6175 || d.Speed != 60 || d.Angle != 180 || d.Alt != 150 {
+		t.Fatalf("record %+v", d)
+	}
+	if d.AccV != 13.8 || d.BatV != 4.1 || !d.UseTempC || d.TempC != -5 {
+		t.Fatalf("sensors %+v", d)
+	}
+	if len(d.OtherID) != 2 || d.OtherID[0] != "Mileage=10000;" || d.OtherID[1] != "Archive=1;" {
+		t.Fatalf("other %v", d.OtherID)
+	}
+
+	//неверная CRC
+	data[len(data)-1] ^= 0xFF
+	T.Input = data
+	if err := T.ParseData(); err == nil {
+		t.Fatal("bad crc accepted")
+	}
+
+	//данные без IMEI на новом соединении
+	T = &Galileosky{Path: t.TempDir() + "/"}
+	T.Input = galileoPacket(t, false, galileoRecord)
+	if err := T.ParseData(); err == nil {
+		t.Fatal("data before imei accepted")
+	}
+}
@@ -13,6 +13,10 @@ import (
 
 type GryphonM01 models.ProtocolModel
 
+func (T *GryphonM01) Model() *models.ProtocolModel {
+	return (*models.ProtocolModel)(T)
+}
+
 func (T *GryphonM01) GetBadPacketByte() []byte {
 	return []byte(string("ok;"))
 }
@@ -25,7 +29,7 @@ func (T *GryphonM01) ReturnError(err string) error {
 func (T *GryphonM01) ParseData() error {
 	defer func() {
 		if recMes := recover(); recMes != nil {
-			utils.AddToLog(utils.GetProgramPath()+"-error.txt", recMes)
+			T.GPS.Log().Error("panic parse data: %v", recMes)
 		}
 	}()
 	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
@@ -43,6 +47,9 @@ func (T *GryphonM01) ParseData() error {
 	}
 
 	T.GPS.Name = v
+	if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+		return T.ReturnError(err.Error())
+	}
 
 	v, ok = dataMap["d"]
 	if ok {
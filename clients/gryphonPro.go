@@ -10,11 +10,14 @@ import (
 	"time"
 
 	"gps_clients/server_gps_service/models"
-	"gps_clients/server_gps_service/utils"
 )
 
 type GryphonPro models.ProtocolModel
 
+func (T *GryphonPro) Model() *models.ProtocolModel {
+	return (*models.ProtocolModel)(T)
+}
+
 func (T *GryphonPro) GetBadPacketByte() []byte {
 	b, _ := hex.DecodeString("AA14FF15")
 	return b
@@ -28,7 +31,7 @@ func (T *GryphonPro) ReturnError(err string) error {
 func (T *GryphonPro) ParseData() error {
 	defer func() {
 		if recMes := recover(); recMes != nil {
-			utils.AddToLog(utils.GetProgramPath()+"-error.txt", recMes)
+			T.GPS.Log().Error("panic parse data: %v", recMes)
 		}
 	}()
 	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
@@ -59,14 +62,17 @@ func (T *GryphonPro) ParseData() error {
 				T.GPS.Name += string(buf[i] + 48)
 			}
 		}
+		if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+			return T.ReturnError(err.Error())
+		}
 	case "aa0014bb":
-		fmt.Println("GPS")
+		T.GPS.Log().Debug("gps data")
 		return T.ParceGPSData()
 	case "aa0014cc":
-		fmt.Println("ODP")
+		T.GPS.Log().Debug("odp data")
 		return T.ParceODPData()
 	default:
-		fmt.Println(tDP)
+		T.GPS.Log().Warn("unknown packet type %s", tDP)
 
 	}
 
@@ -273,7 +279,7 @@ func (T *GryphonPro) ParceODPData() error {
 				dt = dt.AddDate(0, 0, 7168)
 			}
 		} else {
-			fmt.Println(err)
+			T.GPS.Log().Warn("error parse odp time: %v", err)
 		}
 		sb.WriteString(dt.Format("02.01.2006 15:04:05;"))
 
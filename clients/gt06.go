@@ -0,0 +1,234 @@
+package clients
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gps_clients/server_gps_service/hash"
+	"gps_clients/server_gps_service/models"
+)
+
+//GT06 двоичный протокол Concox/JimiIoT (GT06, GT06N, JM01 и совместимые)
+type GT06 models.ProtocolModel
+
+//типы пакетов GT06
+const (
+	gt06Login  = 0x01
+	gt06GPS    = 0x12 //GPS + LBS
+	gt06Status = 0x13 //heartbeat, состояние терминала
+	gt06Alarm  = 0x16 //GPS + LBS + состояние + тревога
+	gt06GPS2   = 0x22 //GPS + LBS + ACC + пробег (GT06N, JM01)
+	gt06Alarm2 = 0x26
+)
+
+func (T *GT06) Model() *models.ProtocolModel {
+	return (*models.ProtocolModel)(T)
+}
+
+//GetBadPacketByte отрицательного ответа в протоколе нет, пакет без подтверждения устройство повторит
+func (T *GT06) GetBadPacketByte() []byte {
+	return []byte{}
+}
+
+func (T *GT06) ReturnError(err string) error {
+	T.GPS.LastError = err
+	return errors.New(T.GPS.LastError)
+}
+
+func (T *GT06) ParseData() error {
+	defer func() {
+		if recMes := recover(); recMes != nil {
+			T.GPS.Log().Error("panic parse data: %v", recMes)
+		}
+	}()
+	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
+	T.GPS.LastInfo = ""
+	T.GPS.LastError = "no data"
+	T.GPS.CountData = nil
+
+	var records models.Records
+
+	//в одном чтении может прийти несколько пакетов, каждый подтверждается отдельно
+	input := T.Input
+	for len(input) > 0 {
+		data, long, rest, err := gt06Frame(input)
+		if err != nil {
+			return T.ReturnError(err.Error())
+		}
+		input = rest
+
+		proto := data[0]
+		body := data[1 : len(data)-2]
+		serial := data[len(data)-2:]
+
+		if T.GPS.Name == "" && proto != gt06Login {
+			return T.ReturnError(fmt.Sprintf("packet 0x%02x before login", proto))
+		}
+
+		switch proto {
+		case gt06Login:
+			if len(body) < 8 {
+				return T.ReturnError("bad login length")
+			}
+			name := hex.EncodeToString(body[:8])
+			if name[0] == '0' {
+				name = name[1:]
+			}
+			if T.GPS.Name != "" && T.GPS.Name != name {
+				return T.ReturnError(fmt.Sprintf("login %s on connection of %s", name, T.GPS.Name))
+			}
+			T.GPS.Name = name
+			if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+				return T.ReturnError(err.Error())
+			}
+			T.GPS.LastError = ""
+
+		case gt06GPS, gt06GPS2:
+			gpsData, fix, err := gt06GPSData(body)
+			if err != nil {
+				return T.ReturnError(err.Error())
+			}
+			if len(body) >= 26 {
+				gpsData.OtherID = append(gpsData.OtherID, gt06LBS(body[18:26]))
+			}
+			if proto == gt06GPS2 && len(body) >= 29 {
+				gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("ACC=%d;", body[26]))
+				if len(body) >= 33 {
+					gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Mileage=%d;", binary.BigEndian.Uint32(body[29:33])))
+				}
+			}
+			T.GPS.AddRecord(&records, gpsData, fix, T.ChkPar)
+
+		case gt06Alarm, gt06Alarm2:
+			gpsData, fix, err := gt06GPSData(body)
+			if err != nil {
+				return T.ReturnError(err.Error())
+			}
+			//длина LBS включает свой байт
+			pos := 18
+			if len(body) > pos && body[pos] >= 9 && len(body) >= pos+9 {
+				gpsData.OtherID = append(gpsData.OtherID, gt06LBS(body[pos+1:pos+9]))
+				pos += int(body[pos])
+			} else {
+				pos++
+			}
+			if len(body) < pos+4 {
+				return T.ReturnError("bad alarm length")
+			}
+			gpsData.OtherID = append(gpsData.OtherID, gt06StatusInfo(body[pos:]))
+			T.GPS.AddRecord(&records, gpsData, fix, T.ChkPar)
+
+		case gt06Status:
+			if len(body) < 3 {
+				return T.ReturnError("bad status length")
+			}
+			T.GPS.LastInfo = "status " + gt06StatusInfo(body)
+			T.GPS.LastError = ""
+
+		default:
+			return T.ReturnError(fmt.Sprintf("unsupported packet type 0x%02x", proto))
+		}
+
+		T.GPS.CountData = append(T.GPS.CountData, gt06Ack(long, proto, serial)...)
+	}
+
+	if err := T.GPS.SaveRecords(T.Path, records); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//gt06Frame первый пакет входа: данные от типа пакета до серийного номера включительно и остаток.
+//0x7878 - длина 1 байт, 0x7979 - 2 байта; CRC-ITU считается от длины до серийного номера.
+func gt06Frame(input []byte) (data []byte, long bool, rest []byte, err error) {
+	if len(input) < 5 {
+		return nil, false, nil, fmt.Errorf("short packet %x", input)
+	}
+
+	var n, head int
+	switch {
+	case input[0] == 0x78 && input[1] == 0x78:
+		n, head = int(input[2]), 3
+	case input[0] == 0x79 && input[1] == 0x79:
+		n, head, long = int(binary.BigEndian.Uint16(input[2:4])), 4, true
+	default:
+		return nil, false, nil, fmt.Errorf("bad start bits %x", input[:2])
+	}
+
+	end := head + n + 2
+	if n < 5 || len(input) < end {
+		return nil, false, nil, fmt.Errorf("error length: %d, have %d", n, len(input)-head)
+	}
+	if input[end-2] != 0x0D || input[end-1] != 0x0A {
+		return nil, false, nil, fmt.Errorf("bad stop bits %x", input[end-2:end])
+	}
+
+	origCRC := binary.BigEndian.Uint16(input[head+n-2:])
+	if dataCRC := hash.CheckSumCRCITU(input[2 : head+n-2]); origCRC != dataCRC {
+		return nil, false, nil, fmt.Errorf("error crc sum: origCRC= %04x, dataCRC= %04x", origCRC, dataCRC)
+	}
+
+	return input[head : head+n-2], long, input[end:], nil
+}
+
+//gt06Ack подтверждение пакета с его типом и серийным номером
+func gt06Ack(long bool, proto byte, serial []byte) []byte {
+	b := []byte{0x78, 0x78, 0x05, proto}
+	if long {
+		b = []byte{0x79, 0x79, 0x00, 0x05, proto}
+	}
+	b = append(b, serial...)
+	crc := hash.CheckSumCRCITU(b[2:])
+	return append(b, byte(crc>>8), byte(crc), 0x0D, 0x0A)
+}
+
+//gt06GPSData время и GPS: 6 байт даты UTC, спутники, широта, долгота, скорость, курс и флаги
+func gt06GPSData(b []byte) (gpsData models.GPSData, fix bool, err error) {
+	if len(b) < 18 {
+		return gpsData, false, errors.New("bad gps length")
+	}
+
+	gpsData.DateTime = time.Date(2000+int(b[0]), time.Month(b[1]), int(b[2]),
+		int(b[3]), int(b[4]), int(b[5]), 0, time.UTC).Local()
+
+	gpsData.Sat = int64(b[6] & 0x0F)
+
+	//координаты в минутах * 30000
+	gpsData.Lat = float64(binary.BigEndian.Uint32(b[7:11])) / 1800000
+	gpsData.Lng = float64(binary.BigEndian.Uint32(b[11:15])) / 1800000
+	gpsData.Speed = int64(b[15])
+
+	//биты курса: 12 - координаты определены, 11 - западная долгота, 10 - северная широта, 0-9 - курс
+	cs := binary.BigEndian.Uint16(b[16:18])
+	gpsData.Angle = int64(cs & 0x03FF)
+	if cs&0x0400 == 0 {
+		gpsData.Lat = -gpsData.Lat
+	}
+	if cs&0x0800 != 0 {
+		gpsData.Lng = -gpsData.Lng
+	}
+	return gpsData, cs&0x1000 != 0, nil
+}
+
+//gt06LBS базовая станция: MCC 2 байта, MNC 1, LAC 2, Cell ID 3
+func gt06LBS(b []byte) string {
+	return fmt.Sprintf("MCC=%d;MNC=%d;LAC=%d;CellID=%d;",
+		binary.BigEndian.Uint16(b[0:2]), b[2],
+		binary.BigEndian.Uint16(b[3:5]),
+		uint32(b[5])<<16|uint32(b[6])<<8|uint32(b[7]))
+}
+
+//gt06StatusInfo состояние терминала: флаги, уровень напряжения 0-6, уровень GSM 0-4, тревога
+func gt06StatusInfo(b []byte) string {
+	info := b[0]
+	s := fmt.Sprintf("ACC=%d;Charge=%d;Relay=%d;Voltage=%d;GSM=%d;",
+		info>>1&1, info>>2&1, info>>7&1, b[1], b[2])
+	if len(b) > 3 {
+		s += fmt.Sprintf("Alarm=%d;", b[3])
+	}
+	return s
+}
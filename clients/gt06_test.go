@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+//пакеты из документации протокола GT06
+const (
+	gt06LoginPacket     = "78780D01012345678901234500018CDD0D0A"
+	gt06HeartbeatPacket = "78780A134004040001000FDCEE0D0A"
+	//CRC примера в документации (8081) не сходится, здесь пересчитан
+	gt06GPSPacket = "78781F120B081D112E10CC027AC7EB0C46584900148F01CC00287D001FB8000373770D0A"
+)
+
+func gt06Parse(t *testing.T, T *GT06, packet string) error {
+	b, err := hex.DecodeString(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	T.Input = b
+	return T.ParseData()
+}
+
+func TestGT06(t *testing.T) {
+	T := &GT06{Path: t.TempDir() + "/"}
+
+	if err := gt06Parse(t, T, gt06GPSPacket); err == nil {
+		t.Fatal("gps packet before login accepted")
+	}
+
+	tests := []struct {
+		packet string
+		ack    string
+	}{
+		{gt06LoginPacket, "787805010001d9dc0d0a"},
+		{gt06HeartbeatPacket, "78780513000f008f0d0a"},
+		{gt06GPSPacket, "787805120003903f0d0a"},
+		//несколько пакетов в одном чтении
+		{gt06HeartbeatPacket + gt06LoginPacket, "78780513000f008f0d0a787805010001d9dc0d0a"},
+	}
+	for _, tt := range tests {
+		if err := gt06Parse(t, T, tt.packet); err != nil {
+			t.Fatalf("%s: %v", tt.packet, err)
+		}
+		if ack := hex.EncodeToString(T.GPS.CountData); ack != tt.ack {
+			t.Errorf("%s: ack %s, want %s", tt.packet, ack, tt.ack)
+		}
+	}
+
+	if T.GPS.Name != "123456789012345" {
+		t.Fatalf("name %q", T.GPS.Name)
+	}
+	d := T.GPS.GpsD
+	if !d.DateTime.Equal(time.Date(2011, 8, 29, 17, 46, 16, 0, time.UTC)) || d.Sat != 12 ||
+		d.Speed != 0 || d.Angle != 143 {
+		t.Fatalf("record %+v", d)
+	}
+	if d.Lat < 23.11166 || d.Lat > 23.11167 || d.Lng < 114.40928 || d.Lng > 114.40929 {
+		t.Fatalf("position %v %v", d.Lat, d.Lng)
+	}
+	if T.GPS.LastInfo != "status ACC=0;Charge=0;Relay=0;Voltage=4;GSM=4;Alarm=0;" {
+		t.Fatalf("status %q", T.GPS.LastInfo)
+	}
+
+	//неверная CRC
+	bad := gt06LoginPacket[:len(gt06LoginPacket)-8] + "0000" + "0D0A"
+	if err := gt06Parse(t, T, bad); err == nil {
+		t.Fatal("bad crc accepted")
+	}
+}
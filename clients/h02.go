@@ -0,0 +1,353 @@
+package clients
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gps_clients/server_gps_service/models"
+	"gps_clients/server_gps_service/utils"
+)
+
+//H02 протоколы трекеров H02 (Sinotrack, Coban и т.п.) и TK103 на одном порту:
+//текст *HQ,<id>,V1,...#, двоичный вариант $<id BCD>... и TK103 (<id><команда><данные>).
+//Координаты в формате DDMM.MMMM с полушарием, время UTC.
+type H02 models.ProtocolModel
+
+//биты статуса H02 (4 байта): активный уровень 0, кроме зажигания
+const (
+	h02Vibration = 1 << 0
+	h02SOS       = 1 << 1
+	h02Overspeed = 1 << 2
+	h02FuelCut   = 1 << 9
+	h02Ign       = 1 << 10 //ACC, 1 - включено
+	h02SOS2      = 1 << 18
+	h02PowerCut  = 1 << 19
+)
+
+//tk103Alarms тревоги сообщения BO01
+var tk103Alarms = map[byte]string{
+	'0': "PowerOff",
+	'1': "Accident",
+	'2': "SOS",
+	'3': "AntiTheft",
+	'4': "LowSpeed",
+	'5': "Overspeed",
+	'6': "Geofence",
+}
+
+func (T *H02) Model() *models.ProtocolModel {
+	return (*models.ProtocolModel)(T)
+}
+
+//GetBadPacketByte отрицательного ответа в протоколе нет
+func (T *H02) GetBadPacketByte() []byte {
+	return []byte{}
+}
+
+func (T *H02) ReturnError(err string) error {
+	T.GPS.LastError = err
+	return errors.New(T.GPS.LastError)
+}
+
+func (T *H02) chkName(name string) error {
+	if name == "" {
+		return errors.New("empty id")
+	}
+	if T.GPS.Name == "" {
+		T.GPS.Name = name
+		return T.ChkPar.ChkName(T.GPS.Name)
+	}
+	if T.GPS.Name != name {
+		return fmt.Errorf("id %s on connection of %s", name, T.GPS.Name)
+	}
+	return nil
+}
+
+func (T *H02) ParseData() error {
+	defer func() {
+		if recMes := recover(); recMes != nil {
+			T.GPS.Log().Error("panic parse data: %v", recMes)
+		}
+	}()
+	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
+	T.GPS.LastInfo = ""
+	T.GPS.LastError = "no data"
+	T.GPS.CountData = nil
+
+	var records models.Records
+
+	addRecord := func(gpsData models.GPSData, fix bool) {
+		chk := T.ChkPar
+		if fix {
+			//число спутников протокол не передает
+			chk.Sat = 0
+		}
+		T.GPS.AddRecord(&records, gpsData, fix, chk)
+	}
+
+	input := T.Input
+	for len(input) > 0 {
+		switch input[0] {
+		case '\r', '\n', ' ':
+			input = input[1:]
+
+		case '*':
+			end := bytes.IndexByte(input, '#')
+			if end < 0 {
+				return T.ReturnError(fmt.Sprintf("no end of message %q", input))
+			}
+			msg := string(input[1:end])
+			input = input[end+1:]
+
+			v := strings.Split(msg, ",")
+			if len(v) < 3 {
+				return T.ReturnError("bad message " + msg)
+			}
+			if err := T.chkName(v[1]); err != nil {
+				return T.ReturnError(err.Error())
+			}
+
+			switch v[2] {
+			case "V1", "V6":
+				gpsData, fix, err := h02Position(v[3:])
+				if err != nil {
+					return T.ReturnError(err.Error() + ": " + msg)
+				}
+				addRecord(gpsData, fix)
+			case "NBR", "LINK":
+				//сигнал связи: базовые станции или уровень сигнала и заряд, без координат
+				T.GPS.LastInfo = "heartbeat " + v[2]
+				T.GPS.LastError = ""
+			case "V4":
+				//ответ на команду сервера
+				T.GPS.LastInfo = "answer " + strings.Join(v[3:], ",")
+				T.GPS.LastError = ""
+			default:
+				return T.ReturnError("unsupported message " + msg)
+			}
+
+		case '$':
+			//длина двоичного сообщения зависит от модели, одно сообщение на чтение
+			name, gpsData, fix, err := h02Binary(input)
+			input = nil
+			if err != nil {
+				return T.ReturnError(err.Error())
+			}
+			if err := T.chkName(name); err != nil {
+				return T.ReturnError(err.Error())
+			}
+			addRecord(gpsData, fix)
+
+		case '(':
+			end := bytes.IndexByte(input, ')')
+			if end < 0 {
+				return T.ReturnError(fmt.Sprintf("no end of message %q", input))
+			}
+			msg := string(input[1:end])
+			input = input[end+1:]
+
+			if len(msg) < 16 {
+				return T.ReturnError("bad message " + msg)
+			}
+			id, cmd, data := msg[:12], msg[12:16], msg[16:]
+			if err := T.chkName(id); err != nil {
+				return T.ReturnError(err.Error())
+			}
+
+			switch cmd {
+			case "BP00":
+				//рукопожатие
+				T.GPS.CountData = append(T.GPS.CountData, "("+id+"AP01HSO)"...)
+				T.GPS.LastInfo = "heartbeat " + cmd
+				T.GPS.LastError = ""
+			case "BP05":
+				//вход: IMEI и точка
+				if len(data) < 15 {
+					return T.ReturnError("bad message " + msg)
+				}
+				T.GPS.CountData = append(T.GPS.CountData, "("+id+"AP05)"...)
+				gpsData, fix, err := tk103Position(data[15:])
+				if err != nil {
+					return T.ReturnError(err.Error() + ": " + msg)
+				}
+				addRecord(gpsData, fix)
+			case "BR00", "BR01", "BR02":
+				gpsData, fix, err := tk103Position(data)
+				if err != nil {
+					return T.ReturnError(err.Error() + ": " + msg)
+				}
+				addRecord(gpsData, fix)
+			case "BO01":
+				//тревога: код и точка
+				if len(data) < 1 {
+					return T.ReturnError("bad message " + msg)
+				}
+				T.GPS.CountData = append(T.GPS.CountData, "("+id+"AS01"+data[:1]+")"...)
+				gpsData, fix, err := tk103Position(data[1:])
+				if err != nil {
+					return T.ReturnError(err.Error() + ": " + msg)
+				}
+				alarm, ok := tk103Alarms[data[0]]
+				if !ok {
+					alarm = data[:1]
+				}
+				gpsData.OtherID = append(gpsData.OtherID, "Alarm="+alarm+";")
+				addRecord(gpsData, fix)
+			default:
+				return T.ReturnError("unsupported message " + msg)
+			}
+
+		default:
+			return T.ReturnError(fmt.Sprintf("unknown message %q", input))
+		}
+	}
+
+	if err := T.GPS.SaveRecords(T.Path, records); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//h02Position точка V1: ЧЧММСС, A/V, широта, N/S, долгота, E/W, скорость (узлы), курс, ДДММГГ, статус hex
+func h02Position(v []string) (gpsData models.GPSData, fix bool, err error) {
+	if len(v) < 10 {
+		return gpsData, false, errors.New("bad length")
+	}
+	gpsData.DateTime, err = time.Parse("020106 150405", v[8]+" "+v[0])
+	if err != nil {
+		return gpsData, false, err
+	}
+	fix = v[1] == "A"
+	if gpsData.Lat, err = utils.ConvertCoordHemi(v[2], v[3]); err != nil {
+		return gpsData, false, err
+	}
+	if gpsData.Lng, err = utils.ConvertCoordHemi(v[4], v[5]); err != nil {
+		return gpsData, false, err
+	}
+	speed, _ := strconv.ParseFloat(v[6], 64)
+	gpsData.Speed = int64(math.Round(speed * 1.852))
+	course, _ := strconv.ParseFloat(v[7], 64)
+	gpsData.Angle = int64(course)
+
+	status, err := strconv.ParseUint(v[9], 16, 32)
+	if err != nil {
+		return gpsData, false, fmt.Errorf("bad status %q", v[9])
+	}
+	gpsData.OtherID = append(gpsData.OtherID, h02Status(uint32(status))...)
+	return gpsData, fix, nil
+}
+
+//h02Binary двоичное сообщение: $, ID 5 байт, ЧЧММСС, ДДММГГ, широта DDMM.MMMM 4 байта, заряд батареи,
+//долгота DDDMM.MMMM 4,5 байта и флаги (0x02 - достоверно, 0x04 - N, 0x08 - E), скорость (узлы) и курс
+//по 3 цифры, статус 4 байта; все поля кроме заряда и статуса в BCD
+func h02Binary(b []byte) (name string, gpsData models.GPSData, fix bool, err error) {
+	if len(b) < 29 {
+		return "", gpsData, false, fmt.Errorf("short binary message %x", b)
+	}
+	h := hex.EncodeToString(b[:25])
+	name = h[2:12]
+
+	gpsData.DateTime, err = time.Parse("020106 150405", h[18:24]+" "+h[12:18])
+	if err != nil {
+		return name, gpsData, false, err
+	}
+
+	flags := b[21] & 0x0F
+	fix = flags&0x02 != 0
+	ns, ew := "S", "W"
+	if flags&0x04 != 0 {
+		ns = "N"
+	}
+	if flags&0x08 != 0 {
+		ew = "E"
+	}
+	if gpsData.Lat, err = utils.ConvertCoordHemi(h[24:28]+"."+h[28:32], ns); err != nil {
+		return name, gpsData, false, err
+	}
+	if gpsData.Lng, err = utils.ConvertCoordHemi(h[34:39]+"."+h[39:43], ew); err != nil {
+		return name, gpsData, false, err
+	}
+
+	speed, err := strconv.Atoi(h[44:47])
+	if err != nil {
+		return name, gpsData, false, fmt.Errorf("bad speed %s", h[44:47])
+	}
+	gpsData.Speed = int64(math.Round(float64(speed) * 1.852))
+	course, err := strconv.Atoi(h[47:50])
+	if err != nil {
+		return name, gpsData, false, fmt.Errorf("bad course %s", h[47:50])
+	}
+	gpsData.Angle = int64(course)
+
+	gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Battery=%d;", b[16]))
+	status := uint32(b[25])<<24 | uint32(b[26])<<16 | uint32(b[27])<<8 | uint32(b[28])
+	gpsData.OtherID = append(gpsData.OtherID, h02Status(status)...)
+	return name, gpsData, fix, nil
+}
+
+//h02Status зажигание, отсечка топлива и тревога из статуса
+func h02Status(status uint32) []string {
+	res := []string{fmt.Sprintf("Status=%08X;", status)}
+
+	ign := 0
+	if status&h02Ign != 0 {
+		ign = 1
+	}
+	res = append(res, fmt.Sprintf("Ign=%d;", ign))
+
+	fuelCut := 0
+	if status&h02FuelCut == 0 {
+		fuelCut = 1
+	}
+	res = append(res, fmt.Sprintf("FuelCut=%d;", fuelCut))
+
+	switch {
+	case status&h02SOS == 0 || status&h02SOS2 == 0:
+		res = append(res, "Alarm=SOS;")
+	case status&h02Vibration == 0:
+		res = append(res, "Alarm=Vibration;")
+	case status&h02Overspeed == 0:
+		res = append(res, "Alarm=Overspeed;")
+	case status&h02PowerCut == 0:
+		res = append(res, "Alarm=PowerCut;")
+	}
+	return res
+}
+
+//tk103Position точка TK103: ГГММДД, A/V, широта DDMM.MMMM N/S, долгота DDDMM.MMMM E/W, скорость км/ч (5 знаков),
+//ЧЧММСС, курс (6 знаков), 8 флагов (питание, зажигание, вход, выход, ...), L и пробег в hex
+func tk103Position(s string) (gpsData models.GPSData, fix bool, err error) {
+	if len(s) < 53 {
+		return gpsData, false, errors.New("bad length")
+	}
+	gpsData.DateTime, err = time.Parse("060102 150405", s[0:6]+" "+s[33:39])
+	if err != nil {
+		return gpsData, false, err
+	}
+	fix = s[6] == 'A'
+	if gpsData.Lat, err = utils.ConvertCoordHemi(s[7:16], s[16:17]); err != nil {
+		return gpsData, false, err
+	}
+	if gpsData.Lng, err = utils.ConvertCoordHemi(s[17:27], s[27:28]); err != nil {
+		return gpsData, false, err
+	}
+	speed, _ := strconv.ParseFloat(s[28:33], 64)
+	gpsData.Speed = int64(math.Round(speed))
+	course, _ := strconv.ParseFloat(s[39:45], 64)
+	gpsData.Angle = int64(course)
+
+	gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Power=%c;Ign=%c;In1=%c;Out1=%c;", s[45], s[46], s[47], s[48]))
+	if len(s) > 54 && s[53] == 'L' {
+		if mileage, err := strconv.ParseUint(s[54:], 16, 64); err == nil {
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Mileage=%d;", mileage))
+		}
+	}
+	return gpsData, fix, nil
+}
@@ -0,0 +1,109 @@
+package clients
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestH02(t *testing.T) {
+	//двоичное сообщение: ID 4106000826, 10.08.15 14:54:52, 2240.5518 N, батарея 100, 11358.3238 E (флаги 0xE),
+	//скорость 0, курс 90, статус FFFFFBFF
+	binary, err := hex.DecodeString("24" + "4106000826" + "145452" + "100815" + "22405518" + "64" + "113583238E" + "000090" + "FFFFFBFF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		input    string
+		id       string
+		ack      string
+		tm       time.Time
+		lat, lng float64
+	}{
+		{
+			//пример из документации H02
+			name:  "v1",
+			input: "*HQ,865205030330012,V1,145452,A,2240.55181,N,11358.32389,E,0.00,0,100815,FFFFFBFF#",
+			id:    "865205030330012",
+			tm:    time.Date(2015, 8, 10, 14, 54, 52, 0, time.UTC),
+			lat:   22.6758635,
+			lng:   113.9720648,
+		},
+		{
+			name:  "v1 south west",
+			input: "*HQ,865205030330012,V1,145452,A,2240.55181,S,11358.32389,W,0.00,0,100815,FFFFFBFF#",
+			id:    "865205030330012",
+			tm:    time.Date(2015, 8, 10, 14, 54, 52, 0, time.UTC),
+			lat:   -22.6758635,
+			lng:   -113.9720648,
+		},
+		{
+			name:  "binary",
+			input: string(binary),
+			id:    "4106000826",
+			tm:    time.Date(2015, 8, 10, 14, 54, 52, 0, time.UTC),
+			lat:   22.6758633,
+			lng:   113.9720633,
+		},
+		{
+			//пример TK103 с пробегом
+			name:  "tk103",
+			input: "(027044702512BR00080612A2232.9828N11404.9297E000.0022828000.0000000000L000946BB)",
+			id:    "027044702512",
+			tm:    time.Date(2008, 6, 12, 2, 28, 28, 0, time.UTC),
+			lat:   22.5497133,
+			lng:   114.0821617,
+		},
+		{
+			name:  "tk103 alarm",
+			input: "(027044702512BO012080612A2232.9828N11404.9297E000.0022828000.0000000000L000946BB)",
+			id:    "027044702512",
+			ack:   "(027044702512AS012)",
+			tm:    time.Date(2008, 6, 12, 2, 28, 28, 0, time.UTC),
+			lat:   22.5497133,
+			lng:   114.0821617,
+		},
+	}
+	for _, tt := range tests {
+		T := &H02{Path: t.TempDir() + "/"}
+		T.Input = []byte(tt.input)
+		if err := T.ParseData(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		d := T.GPS.GpsD
+		if T.GPS.Name != tt.id || string(T.GPS.CountData) != tt.ack || T.GPS.LastError != "" {
+			t.Errorf("%s: id %q, ack %q, error %q", tt.name, T.GPS.Name, T.GPS.CountData, T.GPS.LastError)
+		}
+		if !d.DateTime.Equal(tt.tm) || d.Lat != tt.lat || d.Lng != tt.lng {
+			t.Errorf("%s: record %v %f %f", tt.name, d.DateTime, d.Lat, d.Lng)
+		}
+	}
+}
+
+//TestH02BadCoordinates неразобранные координаты и полушарие - ошибка, точка не сохраняется
+func TestH02BadCoordinates(t *testing.T) {
+	binary, err := hex.DecodeString("24" + "4106000826" + "145452" + "100815" + "2A405518" + "64" + "113583238E" + "000090" + "FFFFFBFF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []string{
+		"*HQ,865205030330012,V1,145452,A,22A0.55181,N,11358.32389,E,0.00,0,100815,FFFFFBFF#",
+		"*HQ,865205030330012,V1,145452,A,2240.55181,N,,E,0.00,0,100815,FFFFFBFF#",
+		"*HQ,865205030330012,V1,145452,A,2240.55181,X,11358.32389,E,0.00,0,100815,FFFFFBFF#",
+		string(binary),
+		"(027044702512BR00080612A2232.9828N1140-.9297E000.0022828000.0000000000L000946BB)",
+		"(027044702512BR00080612A2232.9828N11404.9297?000.0022828000.0000000000L000946BB)",
+	}
+	for _, input := range tests {
+		T := &H02{Path: t.TempDir() + "/"}
+		T.Input = []byte(input)
+		if err := T.ParseData(); err == nil {
+			t.Errorf("%q: accepted %+v", input, T.GPS.GpsD)
+		}
+		if !T.GPS.GpsD.DateTime.IsZero() {
+			t.Errorf("%q: saved %+v", input, T.GPS.GpsD)
+		}
+	}
+}
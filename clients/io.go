@@ -0,0 +1,82 @@
+package clients
+
+import "fmt"
+
+//ioGroups формат блока датчиков Teltonika и совместимых протоколов (Bitrek, Cargo, Ruptela):
+//группы значений по 1, 2, 4 и 8 байт, в каждой группе количество датчиков и пары ID - значение (big endian)
+type ioGroups struct {
+	idSize    int  //размер ID датчика: 1 или 2 байта
+	countSize int  //размер количества датчиков в группе: 1 или 2 байта
+	varGroup  bool //после 8-байтовой группы идет группа значений переменной длины (Codec 8E)
+}
+
+var (
+	ioCodec8     = ioGroups{idSize: 1, countSize: 1}
+	ioCodec8E    = ioGroups{idSize: 2, countSize: 2, varGroup: true}
+	ioRuptelaExt = ioGroups{idSize: 2, countSize: 1}
+)
+
+//parse разбирает группы с позиции pos, для каждого датчика вызывает fn; возвращает позицию после блока.
+//Группы читаются всегда, независимо от общего количества датчиков в заголовке записи.
+func (g ioGroups) parse(input []byte, pos int, fn func(id int, v []byte)) (int, error) {
+	read := func(size int) ([]byte, error) {
+		if pos+size > len(input) {
+			return nil, fmt.Errorf("io element out of packet at %d", pos)
+		}
+		v := input[pos : pos+size]
+		pos += size
+		return v, nil
+	}
+
+	sizes := []int{1, 2, 4, 8}
+	if g.varGroup {
+		sizes = append(sizes, 0)
+	}
+	for _, size := range sizes {
+		b, err := read(g.countSize)
+		if err != nil {
+			return pos, err
+		}
+		count := int(ioValue(b))
+		for i := 0; i < count; i++ {
+			b, err := read(g.idSize)
+			if err != nil {
+				return pos, err
+			}
+			id := int(ioValue(b))
+
+			l := size
+			if size == 0 {
+				//длина значения 2 байта
+				b, err := read(2)
+				if err != nil {
+					return pos, err
+				}
+				l = int(ioValue(b))
+			}
+			v, err := read(l)
+			if err != nil {
+				return pos, err
+			}
+			fn(id, v)
+		}
+	}
+	return pos, nil
+}
+
+//ioValue беззнаковое значение big endian до 8 байт
+func ioValue(b []byte) int64 {
+	var d uint64
+	for _, v := range b {
+		d = d<<8 | uint64(v)
+	}
+	return int64(d)
+}
+
+//ioParam датчик без отдельного поля записи: "id N=значение;", длинное значение в hex
+func ioParam(id int, v []byte) string {
+	if len(v) > 8 {
+		return fmt.Sprintf("id %d=%x;", id, v)
+	}
+	return fmt.Sprintf("id %d=%d;", id, ioValue(v))
+}
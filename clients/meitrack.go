@@ -0,0 +1,362 @@
+package clients
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gps_clients/server_gps_service/models"
+)
+
+//Meitrack текстовый протокол трекеров Meitrack MVT/T:
+//$$<флаг><длина>,<IMEI>,<команда>,<данные>*<контрольная сумма>\r\n.
+//Длина считается от первой запятой до \r\n включительно, контрольная сумма - сумма байт от $$ до * включительно.
+type Meitrack models.ProtocolModel
+
+//mtEvents названия кодов событий
+var mtEvents = map[int]string{
+	1:  "SOS",
+	2:  "Input2Active",
+	3:  "Input3Active",
+	4:  "Input4Active",
+	5:  "Input5Active",
+	9:  "SOSRelease",
+	10: "Input2Inactive",
+	11: "Input3Inactive",
+	12: "Input4Inactive",
+	13: "Input5Inactive",
+	17: "LowBattery",
+	18: "LowPower",
+	19: "Speeding",
+	20: "GeoIn",
+	21: "GeoOut",
+	22: "PowerOn",
+	23: "PowerOff",
+	24: "GPSLost",
+	25: "GPSRecovery",
+	28: "GPSAntennaCut",
+	29: "Reboot",
+	31: "Heartbeat",
+	36: "Tow",
+	41: "Stop",
+	42: "Start",
+	44: "GSMJamming",
+}
+
+//mtEpoch начало отсчета времени в CCE
+var mtEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func (T *Meitrack) Model() *models.ProtocolModel {
+	return (*models.ProtocolModel)(T)
+}
+
+//GetBadPacketByte отрицательного ответа в протоколе нет
+func (T *Meitrack) GetBadPacketByte() []byte {
+	return []byte{}
+}
+
+func (T *Meitrack) ReturnError(err string) error {
+	T.GPS.LastError = err
+	return errors.New(T.GPS.LastError)
+}
+
+func (T *Meitrack) ParseData() (err error) {
+	defer func() {
+		if recMes := recover(); recMes != nil {
+			T.GPS.Log().Error("panic parse data: %v", recMes)
+			//пакет без подтверждения, трекер повторит
+			T.GPS.CountData = nil
+			err = T.ReturnError(fmt.Sprintf("panic parse data: %v", recMes))
+		}
+	}()
+	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
+	T.GPS.LastInfo = ""
+	T.GPS.LastError = "no data"
+	T.GPS.CountData = nil
+
+	var records models.Records
+
+	addRecord := func(gpsData models.GPSData, fix bool) {
+		T.GPS.AddRecord(&records, gpsData, fix, T.ChkPar)
+	}
+
+	//в одном чтении может прийти несколько сообщений
+	input := T.Input
+	for len(input) > 0 {
+		flag, name, cmd, data, rest, err := mtFrame(input)
+		if err != nil {
+			return T.ReturnError(err.Error())
+		}
+		input = rest
+
+		if T.GPS.Name == "" {
+			T.GPS.Name = name
+			if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+				return T.ReturnError(err.Error())
+			}
+		} else if T.GPS.Name != name {
+			return T.ReturnError(fmt.Sprintf("message of %s on connection of %s", name, T.GPS.Name))
+		}
+
+		switch cmd {
+		case "AAA":
+			gpsData, fix, err := mtAAA(strings.Split(string(data), ","))
+			if err != nil {
+				return T.ReturnError(err.Error())
+			}
+			addRecord(gpsData, fix)
+
+		case "CCE":
+			//подтверждение, чтобы трекер удалил отправленные записи из буфера
+			if err := mtCCE(data, addRecord); err != nil {
+				return T.ReturnError(err.Error())
+			}
+			T.GPS.CountData = append(T.GPS.CountData, mtPacket(flag, name, "CCE")...)
+
+		default:
+			//ответы на команды сервера
+			T.GPS.LastInfo = "skip " + cmd
+			T.GPS.LastError = ""
+		}
+	}
+
+	if err := T.GPS.SaveRecords(T.Path, records); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//mtFrame первое сообщение входа: флаг, IMEI, команда, данные после команды (без запятой и *) и остаток
+func mtFrame(input []byte) (flag byte, name, cmd string, data, rest []byte, err error) {
+	if len(input) < 4 || input[0] != '$' || input[1] != '$' {
+		return 0, "", "", nil, nil, fmt.Errorf("bad header %q", input[:minInt(len(input), 4)])
+	}
+	flag = input[2]
+	comma := bytes.IndexByte(input, ',')
+	if comma < 3 {
+		return 0, "", "", nil, nil, fmt.Errorf("bad message %q", input)
+	}
+	n, err := strconv.Atoi(string(input[3:comma]))
+	if err != nil {
+		return 0, "", "", nil, nil, fmt.Errorf("bad length %q", input[3:comma])
+	}
+	end := comma + n
+	if n < 5 || len(input) < end {
+		return 0, "", "", nil, nil, fmt.Errorf("error length: %d, have %d", n, len(input)-comma)
+	}
+	if input[end-5] != '*' || input[end-2] != '\r' || input[end-1] != '\n' {
+		return 0, "", "", nil, nil, fmt.Errorf("bad end of message %q", input[end-5:end])
+	}
+
+	orig, err := strconv.ParseUint(string(input[end-4:end-2]), 16, 8)
+	if err != nil {
+		return 0, "", "", nil, nil, fmt.Errorf("bad checksum %q", input[end-4:end-2])
+	}
+	if sum := mtChecksum(input[:end-4]); byte(orig) != sum {
+		return 0, "", "", nil, nil, fmt.Errorf("error checksum: orig= %02X, data= %02X", orig, sum)
+	}
+
+	//IMEI, команда и данные; в CCE данные двоичные
+	body := input[comma+1 : end-5]
+	v := bytes.SplitN(body, []byte(","), 3)
+	if len(v) < 2 {
+		return 0, "", "", nil, nil, fmt.Errorf("bad message %q", body)
+	}
+	name, cmd = string(v[0]), string(v[1])
+	if name == "" {
+		return 0, "", "", nil, nil, errors.New("empty imei")
+	}
+	if len(v) == 3 {
+		data = v[2]
+	}
+	return flag, name, cmd, data, input[end:], nil
+}
+
+func mtChecksum(b []byte) byte {
+	var sum byte
+	for _, v := range b {
+		sum += v
+	}
+	return sum
+}
+
+//mtPacket сообщение сервера @@<флаг><длина>,<IMEI>,<команда>*<контрольная сумма>\r\n
+func mtPacket(flag byte, name, cmd string) []byte {
+	body := "," + name + "," + cmd + "*"
+	b := []byte(fmt.Sprintf("@@%c%d%s", flag, len(body)+4, body))
+	return append(b, fmt.Sprintf("%02X\r\n", mtChecksum(b))...)
+}
+
+//mtEvent событие записи: название или код
+func mtEvent(code int) string {
+	if name, ok := mtEvents[code]; ok {
+		return "Event=" + name + ";"
+	}
+	return fmt.Sprintf("Event=%d;", code)
+}
+
+//mtAAA отчет AAA: событие, широта, долгота, время UTC ггММддЧЧммсс, A/V, спутники, GSM,
+//скорость, курс, HDOP, высота, пробег м, время работы, базовая станция, входы/выходы, АЦП, ...
+func mtAAA(v []string) (gpsData models.GPSData, fix bool, err error) {
+	if len(v) < 16 {
+		return gpsData, false, fmt.Errorf("bad AAA length %d", len(v))
+	}
+
+	event, _ := strconv.Atoi(v[0])
+	gpsData.Lat, _ = strconv.ParseFloat(v[1], 64)
+	gpsData.Lng, _ = strconv.ParseFloat(v[2], 64)
+	t, err := time.Parse("060102150405", v[3])
+	if err != nil {
+		return gpsData, false, fmt.Errorf("bad time %s", v[3])
+	}
+	gpsData.DateTime = t.Local()
+	fix = v[4] == "A"
+	gpsData.Sat, _ = strconv.ParseInt(v[5], 10, 64)
+	gpsData.Speed, _ = strconv.ParseInt(v[7], 10, 64)
+	gpsData.Angle, _ = strconv.ParseInt(v[8], 10, 64)
+	gpsData.Alt, _ = strconv.ParseInt(v[10], 10, 64)
+
+	gpsData.OtherID = append(gpsData.OtherID, mtEvent(event), "GSM="+v[6]+";", "HDOP="+v[9]+";")
+	if v[11] != "" {
+		gpsData.OtherID = append(gpsData.OtherID, "Mileage="+v[11]+";")
+	}
+
+	//состояние портов: 2 hex цифры выходов и 2 входов
+	if io, err := strconv.ParseUint(v[14], 16, 16); err == nil {
+		gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Outputs=%d;Inputs=%d;", io>>8, io&0xFF))
+	}
+
+	//АЦП: AD1|AD2|AD3|батарея|внешнее питание в hex
+	adc := strings.Split(v[15], "|")
+	if len(adc) >= 5 {
+		if bat, err := strconv.ParseUint(adc[3], 16, 16); err == nil {
+			gpsData.BatV = float64(bat) * 3 * 2 / 1024
+		}
+		if pwr, err := strconv.ParseUint(adc[4], 16, 16); err == nil {
+			gpsData.AccV = float64(pwr) * 3 * 16 / 1024
+		}
+	}
+	return gpsData, fix, nil
+}
+
+//mtCCE двоичный отчет CCE: остаток буфера 4 байта, число пакетов 2 байта, затем пакеты:
+//длина 2 байта (без самого поля длины), число параметров 2 байта и группы параметров по 1, 2, 4 и N байт.
+//Следующий пакет ищется по длине, неизвестные данные в конце пакета пропускаются.
+func mtCCE(b []byte, addRecord func(models.GPSData, bool)) error {
+	if len(b) < 6 {
+		return fmt.Errorf("short CCE message: %d bytes", len(b))
+	}
+	count := int(binary.LittleEndian.Uint16(b[4:6]))
+	pos := 6
+
+	for i := 0; i < count; i++ {
+		if len(b) < pos+2 {
+			return fmt.Errorf("short CCE packet %d", i+1)
+		}
+		end := pos + 2 + int(binary.LittleEndian.Uint16(b[pos:]))
+		if end > len(b) {
+			return fmt.Errorf("error length CCE packet %d: %d, have %d", i+1, end-pos-2, len(b)-pos-2)
+		}
+		gpsData, hasTime, hasCoord, fix, err := mtCCEPacket(b[pos+2 : end])
+		if err != nil {
+			return fmt.Errorf("CCE packet %d: %v", i+1, err)
+		}
+		pos = end
+
+		if hasTime && hasCoord {
+			addRecord(gpsData, fix)
+		}
+	}
+	return nil
+}
+
+//mtCCEPacket пакет CCE без поля длины: число параметров и группы параметров
+func mtCCEPacket(p []byte) (gpsData models.GPSData, hasTime, hasCoord, fix bool, err error) {
+	if len(p) < 2 {
+		return gpsData, false, false, false, errors.New("short packet")
+	}
+	pos := 2
+
+	for group, size := range []int{1, 2, 4, 0} {
+		if pos >= len(p) {
+			return gpsData, false, false, false, fmt.Errorf("no group %d", group+1)
+		}
+		n := int(p[pos])
+		pos++
+		for j := 0; j < n; j++ {
+			if pos >= len(p) {
+				return gpsData, false, false, false, fmt.Errorf("short group %d", group+1)
+			}
+			id := p[pos]
+			pos++
+			if size == 0 {
+				//параметры переменной длины
+				if pos >= len(p) || pos+1+int(p[pos]) > len(p) {
+					return gpsData, false, false, false, fmt.Errorf("short parameter 0x%02x", id)
+				}
+				pos += 1 + int(p[pos])
+				continue
+			}
+			if pos+size > len(p) {
+				return gpsData, false, false, false, fmt.Errorf("short parameter 0x%02x", id)
+			}
+			v := p[pos : pos+size]
+			pos += size
+
+			var d uint32
+			switch size {
+			case 1:
+				d = uint32(v[0])
+			case 2:
+				d = uint32(binary.LittleEndian.Uint16(v))
+			case 4:
+				d = binary.LittleEndian.Uint32(v)
+			}
+
+			switch id {
+			case 0x01:
+				gpsData.OtherID = append(gpsData.OtherID, mtEvent(int(d)))
+			case 0x02:
+				gpsData.Lat = float64(int32(d)) / 1000000
+				hasCoord = true
+			case 0x03:
+				gpsData.Lng = float64(int32(d)) / 1000000
+			case 0x04:
+				gpsData.DateTime = mtEpoch.Add(time.Duration(d) * time.Second).Local()
+				hasTime = true
+			case 0x05:
+				fix = d == 1
+			case 0x06:
+				gpsData.Sat = int64(d)
+			case 0x07:
+				gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("GSM=%d;", d))
+			case 0x08:
+				gpsData.Speed = int64(d)
+			case 0x09:
+				gpsData.Angle = int64(d)
+			case 0x0A:
+				gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("HDOP=%.1f;", float64(d)/10))
+			case 0x0B:
+				gpsData.Alt = int64(int16(d))
+			case 0x0C:
+				gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Mileage=%d;", d))
+			case 0x14:
+				gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Outputs=%d;", d))
+			case 0x15:
+				gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Inputs=%d;", d))
+			case 0x19:
+				gpsData.BatV = float64(d) / 100
+			case 0x1A:
+				gpsData.AccV = float64(d) / 100
+			default:
+				gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
+			}
+		}
+	}
+	return gpsData, hasTime, hasCoord, fix, nil
+}
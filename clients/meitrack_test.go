@@ -0,0 +1,108 @@
+package clients
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mtIMEI = "862170010187175"
+
+//mtMessage сообщение трекера $$<флаг><длина>,<IMEI>,<команда>,<данные>*<сумма>\r\n
+func mtMessage(flag byte, cmd string, data []byte) []byte {
+	body := "," + mtIMEI + "," + cmd + "," + string(data) + "*"
+	b := []byte(fmt.Sprintf("$$%c%d%s", flag, len(body)+4, body))
+	return append(b, fmt.Sprintf("%02X\r\n", mtChecksum(b))...)
+}
+
+//mtCCEData данные CCE: остаток буфера, число пакетов и пакеты с полем длины
+func mtCCEData(packets ...[]byte) []byte {
+	b := []byte{0, 0, 0, 0, byte(len(packets)), 0}
+	for _, p := range packets {
+		b = append(b, byte(len(p)), byte(len(p)>>8))
+		b = append(b, p...)
+	}
+	return b
+}
+
+//mtCCEFix пакет CCE: событие, спутники, скорость; курс, высота; координаты, время; пробег, батарея, питание
+func mtCCEFix(tm time.Time, extra ...byte) []byte {
+	p := []byte{8, 0}
+	p = append(p, 4, 0x01, 35, 0x05, 1, 0x06, 9, 0x08, 60)
+	p = append(p, 4, 0x09, 180, 0, 0x0B, 150, 0, 0x19, 0x9A, 0x01, 0x1A, 0x64, 0x05)
+	u := func(v uint32) []byte {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, v)
+		return b
+	}
+	p = append(p, 4, 0x02)
+	p = append(p, u(55752000)...)
+	p = append(p, 0x03)
+	p = append(p, u(37617500)...)
+	p = append(p, 0x04)
+	p = append(p, u(uint32(tm.Sub(mtEpoch)/time.Second))...)
+	p = append(p, 0x0C)
+	p = append(p, u(10000)...)
+	p = append(p, 0)
+	return append(p, extra...)
+}
+
+func TestMeitrack(t *testing.T) {
+	tm := time.Date(2025, 9, 18, 10, 20, 30, 0, time.UTC)
+	aaa := mtMessage('A', "AAA", []byte("35,55.752000,37.617500,250918102030,A,9,22,60,180,1.0,150,10000,3600,250|1|E166|A08B,0401,0000|0000|0000|019A|0981,"))
+
+	T := &Meitrack{Path: t.TempDir() + "/"}
+	T.Input = aaa
+	if err := T.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	d := T.GPS.GpsD
+	if T.GPS.Name != mtIMEI || len(T.GPS.CountData) != 0 || !d.DateTime.Equal(tm) || d.Lat != 55.752 || d.Lng != 37.6175 ||
+		d.Sat != 9 || d.Speed != 60 || d.Angle != 180 || d.Alt != 150 {
+		t.Fatalf("AAA record %+v", d)
+	}
+	if other := strings.Join(d.OtherID, ""); !strings.HasPrefix(other, "Event=35;GSM=22;HDOP=1.0;Mileage=10000;Outputs=4;Inputs=1;") {
+		t.Fatalf("AAA other %v", d.OtherID)
+	}
+
+	//второй пакет с неизвестными байтами в конце: следующий ищется по длине
+	cce := mtMessage('B', "CCE", mtCCEData(mtCCEFix(tm.Add(time.Second), 0xEE, 0xEE), mtCCEFix(tm.Add(2*time.Second))))
+	T.Input = cce
+	if err := T.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	if ack := string(T.GPS.CountData); ack != string(mtPacket('B', mtIMEI, "CCE")) || !strings.HasPrefix(ack, "@@B25,"+mtIMEI+",CCE*") {
+		t.Fatalf("CCE ack %q", ack)
+	}
+	d = T.GPS.GpsD
+	if !d.DateTime.Equal(tm.Add(2*time.Second)) || d.Lat != 55.752 || d.Lng != 37.6175 || d.Sat != 9 ||
+		d.Speed != 60 || d.Angle != 180 || d.Alt != 150 || d.BatV != 4.1 || d.AccV != 13.8 {
+		t.Fatalf("CCE record %+v", d)
+	}
+
+	//второй пакет длиной 64 байта, данных нет
+	beyond := append(mtCCEData(mtCCEFix(tm)), 0x40, 0)
+	beyond[4] = 2
+
+	bad := []struct {
+		name string
+		data []byte
+	}{
+		{"short message", []byte{0, 0, 0}},
+		{"no packets", []byte{0, 0, 0, 0, 2, 0}},
+		{"packet beyond message", beyond},
+		//длина пакета меньше параметров в нем
+		{"short parameter", mtCCEData(mtCCEFix(tm)[:30])},
+	}
+	for _, tt := range bad {
+		T := &Meitrack{Path: t.TempDir() + "/"}
+		T.Input = mtMessage('C', "CCE", tt.data)
+		if err := T.ParseData(); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		} else if len(T.GPS.CountData) != 0 {
+			t.Errorf("%s: ack %q", tt.name, T.GPS.CountData)
+		}
+	}
+}
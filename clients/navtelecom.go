@@ -0,0 +1,345 @@
+package clients
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"gps_clients/server_gps_service/hash"
+	"gps_clients/server_gps_service/models"
+)
+
+//Navtelecom протокол NTCB/FLEX трекеров Навтелеком (Смарт, Сигнал).
+//Рукопожатие в пакетах NTCB: идентификация *>S и согласование набора полей *>FLEX,
+//далее сообщения FLEX ~A (массив записей), ~T (тревожная) и ~C (текущее состояние).
+//Согласованный набор полей хранится на соединение, поэтому в отличие от остальных
+//протоколов модель встроена в структуру.
+type Navtelecom struct {
+	models.ProtocolModel
+	//fields номера полей FLEX (с 1) в порядке передачи
+	fields []int
+	//recSize размер одной записи в байтах
+	recSize int
+}
+
+const (
+	ntcbHeadSize = 16
+	//flexProtocol код протокола FLEX в *>FLEX
+	flexProtocol = 0xB0
+	//flexVersion10 версия протокола и структуры FLEX 1.0
+	flexVersion10 = 0x0A
+)
+
+//flexFieldSize размеры полей FLEX 1.0 в байтах, индекс - номер поля минус 1
+var flexFieldSize = []int{
+	4, 2, 4, 1, 1, 1, 1, 1, 4, 4, 4, 4, 4, 2, 4, 4, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1,
+	1, 1, 4, 4, 2, 2, 4, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2, 4,
+	2, 1, 4, 2, 2, 2, 2, 2, 1, 1, 1, 2, 4, 2, 1,
+}
+
+func (T *Navtelecom) Model() *models.ProtocolModel {
+	return &T.ProtocolModel
+}
+
+//GetBadPacketByte отрицательного ответа в протоколе нет, неподтвержденное сообщение трекер повторит
+func (T *Navtelecom) GetBadPacketByte() []byte {
+	return []byte{}
+}
+
+func (T *Navtelecom) ReturnError(err string) error {
+	T.GPS.LastError = err
+	return errors.New(T.GPS.LastError)
+}
+
+func (T *Navtelecom) ParseData() error {
+	defer func() {
+		if recMes := recover(); recMes != nil {
+			T.GPS.Log().Error("panic parse data: %v", recMes)
+		}
+	}()
+	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
+	T.GPS.LastInfo = ""
+	T.GPS.LastError = "no data"
+	T.GPS.CountData = nil
+
+	var records models.Records
+
+	//в одном чтении может прийти несколько сообщений, каждое подтверждается отдельно
+	input := T.Input
+	for len(input) > 0 {
+		switch {
+		case bytes.HasPrefix(input, []byte("@NTC")):
+			rest, err := T.ntcb(input)
+			if err != nil {
+				return T.ReturnError(err.Error())
+			}
+			input = rest
+
+		case input[0] == '~':
+			if T.GPS.Name == "" {
+				return T.ReturnError("flex message before identification")
+			}
+			if T.fields == nil {
+				return T.ReturnError("flex message before negotiation")
+			}
+			if len(input) < 2 {
+				return T.ReturnError(fmt.Sprintf("short packet %x", input))
+			}
+
+			//заголовок сообщения до записей
+			var head, count int
+			switch input[1] {
+			case 'A':
+				if len(input) < 3 {
+					return T.ReturnError(fmt.Sprintf("short packet %x", input))
+				}
+				head, count = 3, int(input[2])
+			case 'T':
+				head, count = 6, 1
+			case 'C':
+				head, count = 2, 1
+			default:
+				return T.ReturnError(fmt.Sprintf("unsupported flex message ~%c", input[1]))
+			}
+
+			end := head + count*T.recSize + 1
+			if len(input) < end {
+				return T.ReturnError(fmt.Sprintf("error length: %d, have %d", end, len(input)))
+			}
+			if crc := hash.CheckSumCRC8(input[:end-1]); crc != input[end-1] {
+				return T.ReturnError(fmt.Sprintf("error crc sum: origCRC= %02x, dataCRC= %02x", input[end-1], crc))
+			}
+
+			for i := 0; i < count; i++ {
+				gpsData, fix := T.record(input[head+i*T.recSize : head+(i+1)*T.recSize])
+				switch input[1] {
+				case 'T':
+					gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Alarm=%d;", binary.LittleEndian.Uint32(input[2:6])))
+				case 'C':
+					gpsData.OtherID = append(gpsData.OtherID, "Current=1;")
+				}
+				T.GPS.AddRecord(&records, gpsData, fix, T.ChkPar)
+			}
+
+			//подтверждение: заголовок сообщения (с количеством или индексом события) и CRC8
+			ack := append([]byte{}, input[:head]...)
+			T.GPS.CountData = append(T.GPS.CountData, append(ack, hash.CheckSumCRC8(ack))...)
+			input = input[end:]
+
+		default:
+			return T.ReturnError(fmt.Sprintf("bad header %x", input[0]))
+		}
+	}
+
+	if err := T.GPS.SaveRecords(T.Path, records); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//ntcb разбор пакета NTCB: @NTC, ID получателя, ID отправителя, длина данных,
+//XOR данных, XOR заголовка. Ответ уходит с переставленными ID.
+func (T *Navtelecom) ntcb(input []byte) (rest []byte, err error) {
+	if len(input) < ntcbHeadSize {
+		return nil, fmt.Errorf("short packet %x", input)
+	}
+	n := int(binary.LittleEndian.Uint16(input[12:14]))
+	if len(input) < ntcbHeadSize+n {
+		return nil, fmt.Errorf("error length: %d, have %d", n, len(input)-ntcbHeadSize)
+	}
+	if sum := ntcbXor(input[:15]); sum != input[15] {
+		return nil, fmt.Errorf("error header sum: orig= %02x, data= %02x", input[15], sum)
+	}
+	body := input[ntcbHeadSize : ntcbHeadSize+n]
+	if sum := ntcbXor(body); sum != input[14] {
+		return nil, fmt.Errorf("error data sum: orig= %02x, data= %02x", input[14], sum)
+	}
+	idr, ids := input[4:8], input[8:12]
+
+	var answer []byte
+	switch {
+	case bytes.HasPrefix(body, []byte("*>S:")):
+		name := strings.TrimRight(string(body[4:]), "\x00 ")
+		if name == "" {
+			return nil, errors.New("empty imei")
+		}
+		if T.GPS.Name != "" && T.GPS.Name != name {
+			return nil, fmt.Errorf("imei %s on connection of %s", name, T.GPS.Name)
+		}
+		T.GPS.Name = name
+		if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+			return nil, err
+		}
+		T.GPS.LastError = ""
+		T.GPS.LastInfo = "identification"
+		answer = []byte("*<S")
+
+	case bytes.HasPrefix(body, []byte("*>FLEX")):
+		if T.GPS.Name == "" {
+			return nil, errors.New("flex negotiation before identification")
+		}
+		//протокол, версия протокола, версия структуры, число бит в битовом поле, битовое поле
+		if len(body) < 10 {
+			return nil, errors.New("bad flex negotiation length")
+		}
+		if body[6] != flexProtocol {
+			return nil, fmt.Errorf("unsupported protocol 0x%02x", body[6])
+		}
+		bits := int(body[9])
+		if len(body) < 10+(bits+7)/8 {
+			return nil, errors.New("bad flex bitfield length")
+		}
+		fields, size, err := flexFields(body[10:], bits)
+		if err != nil {
+			return nil, err
+		}
+		T.fields, T.recSize = fields, size
+		T.GPS.LastError = ""
+		T.GPS.LastInfo = fmt.Sprintf("flex fields %d, record %d bytes", len(fields), size)
+		//поддерживается FLEX 1.0, более новая версия понижается
+		answer = append([]byte("*<FLEX"), flexProtocol, minByte(body[7], flexVersion10), minByte(body[8], flexVersion10))
+
+	default:
+		return nil, fmt.Errorf("unsupported ntcb message %q", body[:minInt(len(body), 6)])
+	}
+
+	T.GPS.CountData = append(T.GPS.CountData, ntcbPacket(ids, idr, answer)...)
+	return input[ntcbHeadSize+n:], nil
+}
+
+//ntcbPacket пакет NTCB с данными body
+func ntcbPacket(idr, ids []byte, body []byte) []byte {
+	b := []byte("@NTC")
+	b = append(b, idr...)
+	b = append(b, ids...)
+	b = append(b, byte(len(body)), byte(len(body)>>8), ntcbXor(body))
+	b = append(b, ntcbXor(b))
+	return append(b, body...)
+}
+
+func ntcbXor(b []byte) byte {
+	var sum byte
+	for _, v := range b {
+		sum ^= v
+	}
+	return sum
+}
+
+//flexFields номера включенных полей и размер записи; старший бит первого байта - поле 1
+func flexFields(bitfield []byte, bits int) (fields []int, size int, err error) {
+	fields = []int{}
+	for i := 0; i < bits; i++ {
+		if bitfield[i/8]&(0x80>>uint(i%8)) == 0 {
+			continue
+		}
+		if i >= len(flexFieldSize) {
+			return nil, 0, fmt.Errorf("unsupported flex field %d", i+1)
+		}
+		fields = append(fields, i+1)
+		size += flexFieldSize[i]
+	}
+	return fields, size, nil
+}
+
+//record разбор записи FLEX по согласованному набору полей.
+//Без поля 8 (навигационный статус) достоверность определяется по полю 9 (время последних
+//достоверных координат) или, без него, по наличию времени и координат.
+func (T *Navtelecom) record(b []byte) (gpsData models.GPSData, fix bool) {
+	var hasNav, hasValidTime, hasLat, hasLng bool
+	var validTime uint32
+	pos := 0
+	for _, f := range T.fields {
+		v := b[pos : pos+flexFieldSize[f-1]]
+		pos += len(v)
+
+		var d uint32
+		switch len(v) {
+		case 1:
+			d = uint32(v[0])
+		case 2:
+			d = uint32(binary.LittleEndian.Uint16(v))
+		case 4:
+			d = binary.LittleEndian.Uint32(v)
+		}
+
+		switch {
+		case f == 1:
+			//номер записи
+		case f == 2:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Event=%d;", d))
+		case f == 3:
+			gpsData.DateTime = time.Unix(int64(d), 0).In(time.UTC)
+		case f == 7:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("GSM=%d;", d))
+		case f == 8:
+			//бит 1 - координаты достоверны, биты 2-7 - спутники
+			fix = d&0x02 != 0
+			gpsData.Sat = int64(d >> 2)
+			hasNav = true
+		case f == 9:
+			validTime, hasValidTime = d, true
+		case f == 10:
+			//широта и долгота в 1/10000 минуты
+			gpsData.Lat = float64(int32(d)) / 600000
+			hasLat = true
+		case f == 11:
+			gpsData.Lng = float64(int32(d)) / 600000
+			hasLng = true
+		case f == 12:
+			gpsData.Alt = int64(int32(d)) / 10
+		case f == 13:
+			gpsData.Speed = int64(math.Float32frombits(d))
+		case f == 14:
+			gpsData.Angle = int64(d)
+		case f == 15:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Mileage=%.3f;", math.Float32frombits(d)))
+		case f == 19:
+			gpsData.AccV = float64(d) / 1000
+		case f == 20:
+			gpsData.BatV = float64(d) / 1000
+		case f >= 21 && f <= 28:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("AIN%d=%d;", f-20, d))
+		case f == 29:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Inputs=%d;", d))
+		case f == 31:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Outputs=%d;", d))
+		case f == 38:
+			//ДУТ RS485 1 и 2, как Dut1/Dut2 остальных протоколов
+			gpsData.Dut1 = int64(d)
+			gpsData.UseDut = true
+		case f == 39:
+			gpsData.Dut2 = int64(d)
+			gpsData.UseDut = true
+		default:
+			gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", f, d))
+		}
+	}
+
+	if !hasNav {
+		fix = !gpsData.DateTime.IsZero() && hasLat && hasLng && (gpsData.Lat != 0 || gpsData.Lng != 0)
+		if hasValidTime {
+			//координаты записи - последние достоверные, если получены в ее время
+			fix = fix && int64(validTime) == gpsData.DateTime.Unix()
+		}
+	}
+	return gpsData, fix
+}
+
+func minByte(a, b byte) byte {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
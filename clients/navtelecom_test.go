@@ -0,0 +1,132 @@
+package clients
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/hash"
+)
+
+var (
+	ntcbServer = []byte{0x00, 0x00, 0x00, 0x00}
+	ntcbDevice = []byte{0x01, 0x00, 0x00, 0x00}
+)
+
+//flexNegotiation тело *>FLEX FLEX 1.0 с полями fields
+func flexNegotiation(fields ...int) []byte {
+	bitfield := make([]byte, 10)
+	for _, f := range fields {
+		bitfield[(f-1)/8] |= 0x80 >> uint((f-1)%8)
+	}
+	b := append([]byte("*>FLEX"), flexProtocol, flexVersion10, flexVersion10, byte(len(flexFieldSize)))
+	return append(b, bitfield...)
+}
+
+//flexRecord запись из значений полей в порядке fields
+func flexRecord(fields []int, values map[int]uint32) []byte {
+	var b []byte
+	for _, f := range fields {
+		v := make([]byte, 4)
+		binary.LittleEndian.PutUint32(v, values[f])
+		b = append(b, v[:flexFieldSize[f-1]]...)
+	}
+	return b
+}
+
+//flexArray сообщение ~A с записями и CRC8
+func flexArray(recs ...[]byte) []byte {
+	b := []byte{'~', 'A', byte(len(recs))}
+	for _, r := range recs {
+		b = append(b, r...)
+	}
+	return append(b, hash.CheckSumCRC8(b))
+}
+
+//navtelecomLogin идентификация и согласование полей на новом соединении
+func navtelecomLogin(t *testing.T, fields ...int) *Navtelecom {
+	T := &Navtelecom{}
+	T.Path = t.TempDir() + "/"
+	T.Input = append(ntcbPacket(ntcbDevice, ntcbServer, []byte("*>S:861785007534659")),
+		ntcbPacket(ntcbDevice, ntcbServer, flexNegotiation(fields...))...)
+	if err := T.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	want := append(ntcbPacket(ntcbServer, ntcbDevice, []byte("*<S")),
+		ntcbPacket(ntcbServer, ntcbDevice, []byte{'*', '<', 'F', 'L', 'E', 'X', flexProtocol, flexVersion10, flexVersion10})...)
+	if !bytes.Equal(T.GPS.CountData, want) {
+		t.Fatalf("handshake answer %x, want %x", T.GPS.CountData, want)
+	}
+	if T.GPS.Name != "861785007534659" || len(T.fields) != len(fields) {
+		t.Fatalf("name %q, fields %v", T.GPS.Name, T.fields)
+	}
+	return T
+}
+
+func TestNavtelecom(t *testing.T) {
+	tm := time.Date(2025, 9, 18, 10, 20, 30, 0, time.UTC)
+	unix := uint32(tm.Unix())
+	//55.752 37.6175 в 1/10000 минуты
+	lat, lng := uint32(33451200), uint32(22570500)
+
+	tests := []struct {
+		name   string
+		fields []int
+		values map[int]uint32
+		fix    bool
+	}{
+		{"nav status", []int{1, 3, 8, 10, 11, 13, 14, 19, 20},
+			map[int]uint32{3: unix, 8: 9<<2 | 2, 10: lat, 11: lng, 13: math.Float32bits(60.5), 14: 180, 19: 13800, 20: 4100}, true},
+		{"nav status invalid", []int{3, 8, 10, 11}, map[int]uint32{3: unix, 8: 9 << 2, 10: lat, 11: lng}, false},
+		//без поля 8: время последних достоверных координат
+		{"valid time", []int{3, 9, 10, 11}, map[int]uint32{3: unix, 9: unix, 10: lat, 11: lng}, true},
+		{"old valid time", []int{3, 9, 10, 11}, map[int]uint32{3: unix, 9: unix - 60, 10: lat, 11: lng}, false},
+		//без полей 8 и 9: время и координаты
+		{"coordinates", []int{3, 10, 11}, map[int]uint32{3: unix, 10: lat, 11: lng}, true},
+		{"no coordinates", []int{3, 10, 11}, map[int]uint32{3: unix}, false},
+		{"no time", []int{10, 11}, map[int]uint32{10: lat, 11: lng}, false},
+	}
+	for _, tt := range tests {
+		T := navtelecomLogin(t, tt.fields...)
+		T.Input = flexArray(flexRecord(tt.fields, tt.values))
+		if err := T.ParseData(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		ack := []byte{'~', 'A', 1}
+		if want := append(ack, hash.CheckSumCRC8(ack)); !bytes.Equal(T.GPS.CountData, want) {
+			t.Errorf("%s: ack %x, want %x", tt.name, T.GPS.CountData, want)
+		}
+		if fix := T.GPS.LastError == ""; fix != tt.fix {
+			t.Errorf("%s: error %q, want fix %v", tt.name, T.GPS.LastError, tt.fix)
+			continue
+		}
+		if !tt.fix {
+			continue
+		}
+		d := T.GPS.GpsD
+		if d.DateTime != tm || math.Abs(d.Lat-55.752) > 1e-9 || math.Abs(d.Lng-37.6175) > 1e-9 {
+			t.Errorf("%s: record %+v", tt.name, d)
+		}
+		if tt.name == "nav status" && (d.Sat != 9 || d.Speed != 60 || d.Angle != 180 || d.AccV != 13.8 || d.BatV != 4.1) {
+			t.Errorf("%s: record %+v", tt.name, d)
+		}
+	}
+
+	//неверная CRC8
+	T := navtelecomLogin(t, 3, 10, 11)
+	T.Input = flexArray(flexRecord([]int{3, 10, 11}, map[int]uint32{3: unix, 10: lat, 11: lng}))
+	T.Input[len(T.Input)-1] ^= 0xFF
+	if err := T.ParseData(); err == nil {
+		t.Fatal("bad crc accepted")
+	}
+	//FLEX без согласования
+	T = &Navtelecom{}
+	T.Path = t.TempDir() + "/"
+	T.Input = ntcbPacket(ntcbDevice, ntcbServer, []byte("*>S:861785007534659"))
+	T.Input = append(T.Input, flexArray()...)
+	if err := T.ParseData(); err == nil {
+		t.Fatal("flex message before negotiation accepted")
+	}
+}
@@ -0,0 +1,269 @@
+package clients
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gps_clients/server_gps_service/models"
+	"gps_clients/server_gps_service/utils"
+)
+
+//NMEA поток предложений NMEA 0183 по TCP: первой строкой идет ID устройства, затем
+//$xxRMC, $xxGGA и $xxGSA. Предложения одной точки (по времени UTC) объединяются в одну запись,
+//остальные предложения пропускаются. Точка записывается по приходу всех трех предложений,
+//со сменой времени, в конце чтения при наличии RMC и GGA и при закрытии соединения (Flush).
+//Строки могут приходить частями, хвост хранится на соединение.
+type NMEA struct {
+	models.ProtocolModel
+	buf []byte
+	fix nmeaFix
+}
+
+//nmeaFix точка, собираемая из RMC, GGA и GSA
+type nmeaFix struct {
+	time          string //время UTC hhmmss.ss
+	rmc, gga, gsa bool
+	bad           bool //координаты не разобраны, точка отбрасывается
+	active        bool //RMC: статус A
+	quality       bool //GGA: качество решения не 0
+	sat           int64
+	hdop          string
+	pdop, vdop    string
+	gpsData       models.GPSData
+}
+
+//nmeaMaxLine ограничение на недочитанную строку, предложение NMEA не длиннее 82 символов
+const nmeaMaxLine = 1024
+
+func (T *NMEA) Model() *models.ProtocolModel {
+	return &T.ProtocolModel
+}
+
+//GetBadPacketByte ответов в протоколе нет
+func (T *NMEA) GetBadPacketByte() []byte {
+	return []byte{}
+}
+
+func (T *NMEA) ReturnError(err string) error {
+	T.GPS.LastError = err
+	return errors.New(T.GPS.LastError)
+}
+
+func (T *NMEA) ParseData() error {
+	defer func() {
+		if recMes := recover(); recMes != nil {
+			T.GPS.Log().Error("panic parse data: %v", recMes)
+		}
+	}()
+	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
+	T.GPS.LastInfo = ""
+	T.GPS.LastError = "no data"
+	T.GPS.CountData = nil
+
+	var records models.Records
+	flush := func() { T.flush(&records) }
+
+	T.buf = append(T.buf, T.Input...)
+	end := bytes.LastIndexByte(T.buf, '\n')
+	if end < 0 {
+		if len(T.buf) > nmeaMaxLine {
+			T.buf = nil
+			return T.ReturnError("line too long")
+		}
+		T.GPS.LastInfo = "partial line"
+		T.GPS.LastError = ""
+		return nil
+	}
+	lines := strings.Split(string(T.buf[:end]), "\n")
+	T.buf = append([]byte(nil), T.buf[end+1:]...)
+
+	//ошибочные строки пропускаются, последняя ошибка возвращается после сохранения
+	var lastErr string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if T.GPS.Name == "" {
+			if strings.HasPrefix(line, "$") {
+				return T.ReturnError("no id line before " + line)
+			}
+			T.GPS.Name = line
+			if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+				return T.ReturnError(err.Error())
+			}
+			T.GPS.LastInfo = "id " + T.GPS.Name
+			T.GPS.LastError = ""
+			continue
+		}
+
+		f, err := nmeaSentence(line)
+		if err != nil {
+			lastErr = err.Error()
+			continue
+		}
+		if len(f[0]) != 5 {
+			continue
+		}
+
+		switch f[0][2:] {
+		case "RMC":
+			//RMC,hhmmss.ss,A/V,lat,N/S,lon,E/W,скорость (узлы),курс,ddmmyy,...
+			if len(f) < 10 || len(f[1]) < 6 {
+				lastErr = "bad length " + line
+				continue
+			}
+			dt, err := time.Parse("020106 150405", f[9]+" "+f[1][:6])
+			if err != nil {
+				lastErr = "bad time " + line
+				continue
+			}
+			if T.fix.time != f[1] {
+				flush()
+				T.fix.time = f[1]
+			}
+			T.fix.rmc = true
+			T.fix.active = f[2] == "A"
+			T.fix.gpsData.DateTime = dt
+			if err := nmeaCoord(&T.fix.gpsData, f[3:7]); err != nil {
+				T.fix.bad = true
+				lastErr = err.Error() + " in " + line
+				continue
+			}
+			val, _ := strconv.ParseFloat(f[7], 64)
+			val *= 1.852 //mile\h to k\h
+			T.fix.gpsData.Speed = int64(val)
+			val, _ = strconv.ParseFloat(f[8], 64)
+			T.fix.gpsData.Angle = int64(val)
+		case "GGA":
+			//GGA,hhmmss.ss,lat,N/S,lon,E/W,качество,спутники,HDOP,высота,M,...
+			if len(f) < 10 {
+				lastErr = "bad length " + line
+				continue
+			}
+			if T.fix.time != f[1] {
+				flush()
+				T.fix.time = f[1]
+			}
+			T.fix.gga = true
+			T.fix.quality = f[6] != "" && f[6] != "0"
+			if err := nmeaCoord(&T.fix.gpsData, f[2:6]); err != nil {
+				T.fix.bad = true
+				lastErr = err.Error() + " in " + line
+				continue
+			}
+			T.fix.sat, _ = strconv.ParseInt(f[7], 10, 64)
+			if f[8] != "" {
+				T.fix.hdop = f[8]
+			}
+			val, _ := strconv.ParseFloat(f[9], 64)
+			T.fix.gpsData.Alt = int64(val)
+		case "GSA":
+			//GSA,A/M,тип 1-3,12 номеров спутников,PDOP,HDOP,VDOP; времени нет, относится к текущей точке
+			if len(f) < 18 {
+				lastErr = "bad length " + line
+				continue
+			}
+			if T.fix.time == "" || T.fix.gsa {
+				continue
+			}
+			T.fix.gsa = true
+			T.fix.pdop, T.fix.vdop = f[15], f[17]
+			if T.fix.hdop == "" {
+				T.fix.hdop = f[16]
+			}
+		default:
+			continue
+		}
+
+		if T.fix.rmc && T.fix.gga && T.fix.gsa {
+			flush()
+		}
+	}
+
+	//GSA передают не все устройства: точка с RMC и GGA записывается в конце чтения
+	if T.fix.rmc && T.fix.gga {
+		flush()
+	}
+
+	if err := T.GPS.SaveRecords(T.Path, records); err != nil {
+		return err
+	}
+
+	if lastErr != "" {
+		return T.ReturnError(lastErr)
+	}
+	return nil
+}
+
+//flush записывает собранную точку; без RMC нет даты, такая точка и точка
+//с неразобранными координатами пропускаются
+func (T *NMEA) flush(records *models.Records) {
+	f := T.fix
+	T.fix = nmeaFix{}
+	if !f.rmc || f.bad {
+		return
+	}
+	gpsData := f.gpsData
+	gpsData.Sat = f.sat
+	if f.hdop != "" {
+		gpsData.OtherID = append(gpsData.OtherID, "HDOP="+f.hdop+";")
+	}
+	if f.pdop != "" {
+		gpsData.OtherID = append(gpsData.OtherID, "PDOP="+f.pdop+";")
+	}
+	if f.vdop != "" {
+		gpsData.OtherID = append(gpsData.OtherID, "VDOP="+f.vdop+";")
+	}
+	T.GPS.AddRecord(records, gpsData, f.active && (!f.gga || f.quality), T.ChkPar)
+}
+
+//Flush записывает точку, собранную к закрытию соединения (например, только из RMC)
+func (T *NMEA) Flush() error {
+	var records models.Records
+	T.flush(&records)
+	return T.GPS.SaveRecords(T.Path, records)
+}
+
+//nmeaSentence проверяет контрольную сумму $...*HH (XOR байт между $ и *) и возвращает поля:
+//первое - источник и тип предложения (GPRMC, GNGGA, ...)
+func nmeaSentence(line string) ([]string, error) {
+	star := strings.LastIndexByte(line, '*')
+	if !strings.HasPrefix(line, "$") || star < 0 || len(line) < star+3 {
+		return nil, fmt.Errorf("bad sentence %q", line)
+	}
+	orig, err := strconv.ParseUint(line[star+1:star+3], 16, 8)
+	if err != nil {
+		return nil, fmt.Errorf("bad checksum %q", line)
+	}
+	var sum byte
+	for i := 1; i < star; i++ {
+		sum ^= line[i]
+	}
+	if byte(orig) != sum {
+		return nil, fmt.Errorf("error checksum: orig= %02X, data= %02X in %q", orig, sum, line)
+	}
+	return strings.Split(line[1:star], ","), nil
+}
+
+//nmeaCoord широта и долгота с полушарием: lat, N/S, lon, E/W; пустые поля (нет решения) не меняют точку
+func nmeaCoord(gpsData *models.GPSData, f []string) error {
+	if f[0] == "" || f[2] == "" {
+		return nil
+	}
+	lat, err := utils.ConvertCoordHemi(f[0], f[1])
+	if err != nil {
+		return err
+	}
+	lng, err := utils.ConvertCoordHemi(f[2], f[3])
+	if err != nil {
+		return err
+	}
+	gpsData.Lat, gpsData.Lng = lat, lng
+	return nil
+}
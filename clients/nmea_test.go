@@ -0,0 +1,100 @@
+package clients
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+//nmeaLine предложение с контрольной суммой
+func nmeaLine(body string) string {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return fmt.Sprintf("$%s*%02X\r\n", body, sum)
+}
+
+//пример из описания NMEA 0183: 23.03.1994 12:35:19 UTC, 48.1173 11.5166667
+var (
+	nmeaRMC = nmeaLine("GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W")
+	nmeaGGA = nmeaLine("GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,")
+	nmeaGSA = nmeaLine("GPGSA,A,3,04,05,,09,12,,,24,,,,,2.5,1.3,2.1")
+)
+
+func TestNMEA(t *testing.T) {
+	tm := time.Date(1994, 3, 23, 12, 35, 19, 0, time.UTC)
+	tests := []struct {
+		name  string
+		reads []string
+		//held точка после последнего чтения еще не записана, записывается Flush
+		held  bool
+		sat   int64
+		other []string
+	}{
+		{
+			//без GSA точка записывается в конце чтения
+			name:  "rmc gga",
+			reads: []string{"dev050\r\n" + nmeaRMC + nmeaGGA},
+			sat:   8,
+			other: []string{"HDOP=0.9;"},
+		},
+		{
+			name:  "rmc gga gsa split",
+			reads: []string{"dev050\r\n" + nmeaRMC + nmeaGGA[:20], nmeaGGA[20:] + nmeaGSA},
+			sat:   8,
+			other: []string{"HDOP=0.9;", "PDOP=2.5;", "VDOP=2.1;"},
+		},
+		{
+			//без GGA точка ждет следующего времени или закрытия соединения
+			name:  "rmc only",
+			reads: []string{"dev050\r\n" + nmeaRMC},
+			held:  true,
+		},
+	}
+	for _, tt := range tests {
+		T := &NMEA{}
+		T.Path = t.TempDir() + "/"
+		for i, input := range tt.reads {
+			T.Input = []byte(input)
+			if err := T.ParseData(); err != nil {
+				t.Fatalf("%s: read %d: %v", tt.name, i, err)
+			}
+			//до последнего чтения точка не собрана
+			if i < len(tt.reads)-1 && !T.GPS.GpsD.DateTime.IsZero() {
+				t.Fatalf("%s: read %d: saved %+v", tt.name, i, T.GPS.GpsD)
+			}
+		}
+		if saved := !T.GPS.GpsD.DateTime.IsZero(); saved == tt.held {
+			t.Fatalf("%s: saved %v before close", tt.name, saved)
+		}
+		if err := T.Flush(); err != nil {
+			t.Fatalf("%s: flush: %v", tt.name, err)
+		}
+
+		d := T.GPS.GpsD
+		if T.GPS.LastError != "" || !d.DateTime.Equal(tm) || d.Lat != 48.1173 || d.Lng != 11.5166667 ||
+			d.Speed != 41 || d.Angle != 84 || d.Sat != tt.sat {
+			t.Errorf("%s: record %+v, error %q", tt.name, d, T.GPS.LastError)
+		}
+		if fmt.Sprint(d.OtherID) != fmt.Sprint(tt.other) {
+			t.Errorf("%s: other %v, want %v", tt.name, d.OtherID, tt.other)
+		}
+	}
+}
+
+//TestNMEABadCoordinates точка с неразобранными координатами не записывается
+func TestNMEABadCoordinates(t *testing.T) {
+	T := &NMEA{}
+	T.Path = t.TempDir() + "/"
+	T.Input = []byte("dev050\r\n" + nmeaLine("GPRMC,123519,A,48A7.038,N,01131.000,E,022.4,084.4,230394,003.1,W") + nmeaGGA)
+	if err := T.ParseData(); err == nil {
+		t.Fatal("bad coordinates accepted")
+	}
+	if err := T.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !T.GPS.GpsD.DateTime.IsZero() {
+		t.Fatalf("saved %+v", T.GPS.GpsD)
+	}
+}
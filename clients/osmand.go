@@ -0,0 +1,255 @@
+package clients
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gps_clients/server_gps_service/models"
+)
+
+//OsmAnd протокол OsmAnd / Traccar Client по HTTP: GET или POST с параметрами
+//id, lat, lon, timestamp, speed, bearing, altitude, batt, либо POST с JSON.
+//Порт обслуживает HTTP-сервер, каждый запрос передается разборщику через SetRequest.
+//Ответы 200 и 400 в CountData и GetBadPacketByte - для записи соединения и replay.
+type OsmAnd struct {
+	models.ProtocolModel
+	req *http.Request
+}
+
+var (
+	osmandOK         = []byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+	osmandBadRequest = []byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n")
+)
+
+func (T *OsmAnd) Model() *models.ProtocolModel {
+	return &T.ProtocolModel
+}
+
+//GetBadPacketByte ответ 400, HTTP-сервер отвечает тем же кодом
+func (T *OsmAnd) GetBadPacketByte() []byte {
+	return osmandBadRequest
+}
+
+func (T *OsmAnd) ReturnError(err string) error {
+	T.GPS.LastError = err
+	return errors.New(T.GPS.LastError)
+}
+
+//SetRequest запрос для следующего ParseData; без него запрос читается из Input
+func (T *OsmAnd) SetRequest(r *http.Request) {
+	T.req = r
+}
+
+func (T *OsmAnd) ParseData() error {
+	defer func() {
+		if recMes := recover(); recMes != nil {
+			T.GPS.Log().Error("panic parse data: %v", recMes)
+		}
+	}()
+	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
+	T.GPS.LastInfo = ""
+	T.GPS.LastError = "no data"
+	T.GPS.CountData = nil
+
+	req := T.req
+	T.req = nil
+	if req == nil {
+		//запрос из записи соединения (replay)
+		var err error
+		if req, err = http.ReadRequest(bufio.NewReader(bytes.NewReader(T.Input))); err != nil {
+			return T.ReturnError("bad request: " + err.Error())
+		}
+	}
+	//размер тела ограничивает HTTP-сервер порта
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return T.ReturnError("bad request body: " + err.Error())
+	}
+
+	var name string
+	var gpsData models.GPSData
+	var fix bool
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") || bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		name, gpsData, fix, err = osmandJSON(body)
+	} else {
+		form := req.URL.Query()
+		if req.Method == http.MethodPost {
+			if values, err := url.ParseQuery(string(body)); err == nil {
+				for k, v := range values {
+					form[k] = append(form[k], v...)
+				}
+			}
+		}
+		name, gpsData, fix, err = osmandForm(form)
+	}
+	if err != nil {
+		return T.ReturnError(err.Error())
+	}
+
+	if T.GPS.Name == "" {
+		T.GPS.Name = name
+		if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+			return T.ReturnError(err.Error())
+		}
+	} else if T.GPS.Name != name {
+		return T.ReturnError(fmt.Sprintf("id %s on connection of %s", name, T.GPS.Name))
+	}
+
+	chk := T.ChkPar
+	if fix {
+		//число спутников протокол не передает
+		chk.Sat = 0
+	}
+	var records models.Records
+	T.GPS.AddRecord(&records, gpsData, fix, chk)
+	T.GPS.CountData = osmandOK
+
+	if err := T.GPS.SaveRecords(T.Path, records); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//osmandTime время в секундах или миллисекундах unix, либо строкой ISO 8601; пустое - текущее
+func osmandTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Now(), nil
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if v > 1e12 {
+			return time.Unix(v/1000, 0), nil
+		}
+		return time.Unix(v, 0), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Local(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad timestamp %q", s)
+}
+
+//osmandForm параметры запроса; скорость в узлах
+func osmandForm(form url.Values) (name string, gpsData models.GPSData, fix bool, err error) {
+	name = form.Get("id")
+	if name == "" {
+		name = form.Get("deviceid")
+	}
+	if name == "" {
+		return "", gpsData, false, errors.New("error: miss id key")
+	}
+
+	lat, lon := form.Get("lat"), form.Get("lon")
+	if loc := strings.Split(form.Get("location"), ","); lat == "" && len(loc) == 2 {
+		lat, lon = loc[0], loc[1]
+	}
+	if gpsData.Lat, err = strconv.ParseFloat(lat, 64); err != nil {
+		return name, gpsData, false, fmt.Errorf("bad lat %q", lat)
+	}
+	if gpsData.Lng, err = strconv.ParseFloat(lon, 64); err != nil {
+		return name, gpsData, false, fmt.Errorf("bad lon %q", lon)
+	}
+	if gpsData.DateTime, err = osmandTime(form.Get("timestamp")); err != nil {
+		return name, gpsData, false, err
+	}
+
+	fix = form.Get("valid") != "false" && form.Get("valid") != "0"
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := form.Get(k)
+		f, _ := strconv.ParseFloat(v, 64)
+		switch k {
+		case "id", "deviceid", "lat", "lon", "location", "timestamp", "valid":
+		case "speed":
+			gpsData.Speed = int64(math.Round(f * 1.852))
+		case "bearing", "heading":
+			gpsData.Angle = int64(f)
+		case "altitude":
+			gpsData.Alt = int64(f)
+		case "batt":
+			gpsData.OtherID = append(gpsData.OtherID, "Battery="+v+";")
+		default:
+			key := strings.NewReplacer(";", "", "=", "").Replace(k)
+			value := strings.NewReplacer(";", " ", "=", " ").Replace(v)
+			gpsData.OtherID = append(gpsData.OtherID, key+"="+value+";")
+		}
+	}
+	return name, gpsData, fix, nil
+}
+
+//osmandLocation JSON Traccar Client; скорость в м/с, заряд 0..1
+type osmandLocation struct {
+	DeviceID string `json:"device_id"`
+	Location struct {
+		Timestamp string `json:"timestamp"`
+		Coords    struct {
+			Latitude  *float64 `json:"latitude"`
+			Longitude *float64 `json:"longitude"`
+			Accuracy  float64  `json:"accuracy"`
+			Speed     float64  `json:"speed"`
+			Heading   float64  `json:"heading"`
+			Altitude  float64  `json:"altitude"`
+		} `json:"coords"`
+		IsMoving bool    `json:"is_moving"`
+		Odometer float64 `json:"odometer"`
+		Event    string  `json:"event"`
+		Battery  struct {
+			Level      *float64 `json:"level"`
+			IsCharging bool     `json:"is_charging"`
+		} `json:"battery"`
+	} `json:"location"`
+}
+
+func osmandJSON(body []byte) (name string, gpsData models.GPSData, fix bool, err error) {
+	var v osmandLocation
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", gpsData, false, fmt.Errorf("bad json: %v", err)
+	}
+	if v.DeviceID == "" {
+		return "", gpsData, false, errors.New("error: miss device_id key")
+	}
+	c := v.Location.Coords
+	if c.Latitude == nil || c.Longitude == nil {
+		return v.DeviceID, gpsData, false, errors.New("error: miss coords")
+	}
+	if gpsData.DateTime, err = osmandTime(v.Location.Timestamp); err != nil {
+		return v.DeviceID, gpsData, false, err
+	}
+
+	gpsData.Lat, gpsData.Lng = *c.Latitude, *c.Longitude
+	if c.Speed > 0 {
+		gpsData.Speed = int64(math.Round(c.Speed * 3.6))
+	}
+	if c.Heading > 0 {
+		gpsData.Angle = int64(c.Heading)
+	}
+	gpsData.Alt = int64(c.Altitude)
+
+	gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Accuracy=%.f;", c.Accuracy))
+	if v.Location.Battery.Level != nil {
+		gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Battery=%.f;", *v.Location.Battery.Level*100))
+	}
+	if v.Location.Odometer > 0 {
+		gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Mileage=%.f;", v.Location.Odometer))
+	}
+	if v.Location.Event != "" {
+		gpsData.OtherID = append(gpsData.OtherID, "Event="+v.Location.Event+";")
+	}
+	return v.DeviceID, gpsData, true, nil
+}
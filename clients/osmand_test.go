@@ -0,0 +1,57 @@
+package clients
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOsmAnd(t *testing.T) {
+	T := &OsmAnd{}
+	T.Path = t.TempDir() + "/"
+
+	//запрос Traccar Client: скорость в узлах
+	T.SetRequest(httptest.NewRequest("GET", "/?id=123456&timestamp=1758190830&lat=55.752&lon=37.6175&speed=10.0&bearing=90&altitude=150&batt=87", nil))
+	if err := T.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	if string(T.GPS.CountData) != "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n" {
+		t.Fatalf("ack %q", T.GPS.CountData)
+	}
+	d := T.GPS.GpsD
+	if T.GPS.Name != "123456" || !d.DateTime.Equal(time.Date(2025, 9, 18, 10, 20, 30, 0, time.UTC)) ||
+		d.Lat != 55.752 || d.Lng != 37.6175 || d.Speed != 19 || d.Angle != 90 || d.Alt != 150 {
+		t.Fatalf("record %+v", d)
+	}
+	if len(d.OtherID) != 1 || d.OtherID[0] != "Battery=87;" {
+		t.Fatalf("other %v", d.OtherID)
+	}
+
+	//JSON Traccar Client в записи соединения: скорость в м/с, заряд 0..1
+	const body = `{"device_id":"123456","location":{"timestamp":"2025-09-18T10:20:40Z",` +
+		`"coords":{"latitude":55.753,"longitude":37.6175,"accuracy":5,"speed":10,"heading":180},"battery":{"level":0.5}}}`
+	T.Input = []byte("POST / HTTP/1.1\r\nHost: gps\r\nContent-Type: application/json\r\nContent-Length: " +
+		strconv.Itoa(len(body)) + "\r\n\r\n" + body)
+	if err := T.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	d = T.GPS.GpsD
+	if d.Lat != 55.753 || d.Speed != 36 || d.Angle != 180 ||
+		len(d.OtherID) != 2 || d.OtherID[0] != "Accuracy=5;" || d.OtherID[1] != "Battery=50;" {
+		t.Fatalf("json record %+v", d)
+	}
+
+	//нет координат
+	T.SetRequest(httptest.NewRequest("GET", "/?id=123456&timestamp=1758190850", nil))
+	if err := T.ParseData(); err == nil {
+		t.Fatal("record without coordinates accepted")
+	}
+
+	//другое устройство на том же соединении
+	T.SetRequest(httptest.NewRequest("POST", "/", strings.NewReader("id=654321&lat=55.752&lon=37.6175&timestamp=1758190860")))
+	if err := T.ParseData(); err == nil {
+		t.Fatal("foreign id accepted")
+	}
+}
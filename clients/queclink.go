@@ -0,0 +1,230 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gps_clients/server_gps_service/models"
+)
+
+//Queclink текстовый протокол @Track трекеров Queclink GV/GL:
+//+RESP:GTFRI,<версия>,<IMEI>,<имя>,...,<время отправки>,<счетчик>$
+type Queclink models.ProtocolModel
+
+//qlFix поля одной точки: точность (HDOP), скорость, курс, высота, долгота, широта,
+//время UTC, MCC, MNC, LAC, Cell ID, резерв
+const qlFix = 12
+
+//qlReports сообщения с N точками в формате GTFRI, значение - событие для записи
+var qlReports = map[string]string{
+	"GTFRI": "",
+	"GTGEO": "Geo",
+	"GTSPD": "Speed",
+	"GTSOS": "SOS",
+	"GTRTL": "RTL",
+	"GTPNL": "PNL",
+	"GTNMR": "NMR",
+	"GTDIS": "DIS",
+	"GTDOG": "DOG",
+	"GTIGL": "IGL",
+}
+
+func (T *Queclink) Model() *models.ProtocolModel {
+	return (*models.ProtocolModel)(T)
+}
+
+//GetBadPacketByte отрицательного ответа в протоколе нет
+func (T *Queclink) GetBadPacketByte() []byte {
+	return []byte{}
+}
+
+func (T *Queclink) ReturnError(err string) error {
+	T.GPS.LastError = err
+	return errors.New(T.GPS.LastError)
+}
+
+func (T *Queclink) ParseData() error {
+	defer func() {
+		if recMes := recover(); recMes != nil {
+			T.GPS.Log().Error("panic parse data: %v", recMes)
+		}
+	}()
+	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
+	T.GPS.LastInfo = ""
+	T.GPS.LastError = "no data"
+	T.GPS.CountData = nil
+
+	var records models.Records
+
+	addRecord := func(gpsData models.GPSData, fix bool) {
+		chk := T.ChkPar
+		if fix {
+			//число спутников протокол не передает, точка с HDOP считается достоверной
+			chk.Sat = 0
+		}
+		T.GPS.AddRecord(&records, gpsData, fix, chk)
+	}
+
+	msgs := strings.Split(strings.TrimSpace(string(T.Input)), "$")
+	for _, msg := range msgs {
+		msg = strings.TrimSpace(msg)
+		if msg == "" {
+			continue
+		}
+
+		head := strings.SplitN(msg, ":", 2)
+		if len(head) != 2 {
+			return T.ReturnError("bad message " + msg)
+		}
+		v := strings.Split(head[1], ",")
+		if len(v) < 5 {
+			return T.ReturnError("bad length " + msg)
+		}
+		kind := v[0]
+
+		if v[2] == "" {
+			return T.ReturnError("empty imei " + msg)
+		}
+		if T.GPS.Name == "" {
+			T.GPS.Name = v[2]
+			if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+				return T.ReturnError(err.Error())
+			}
+		} else if T.GPS.Name != v[2] {
+			return T.ReturnError(fmt.Sprintf("message of %s on connection of %s", v[2], T.GPS.Name))
+		}
+
+		count := v[len(v)-1]
+
+		switch head[0] {
+		case "+ACK":
+			//подтверждение команды сервера; heartbeat приходит тоже как +ACK
+			if kind != "GTHBD" {
+				T.GPS.LastInfo = "ack " + kind
+				T.GPS.LastError = ""
+				continue
+			}
+		case "+RESP", "+BUFF":
+		default:
+			return T.ReturnError("unknown message type " + head[0])
+		}
+
+		event, report := qlReports[kind]
+		switch {
+		case report:
+			//<версия>,<IMEI>,<имя>,<внешнее питание мВ>,<ID отчета>,<N>,{точка}*N,<пробег>,<моточасы>,<AIN1>,<AIN2>,<заряд %>,...
+			if len(v) < 7 {
+				return T.ReturnError("bad length " + msg)
+			}
+			n, err := strconv.Atoi(v[6])
+			if err != nil || n < 1 || len(v) < 7+n*qlFix+2 {
+				return T.ReturnError("bad number of points " + msg)
+			}
+			tail := v[7+n*qlFix:]
+			for i := 0; i < n; i++ {
+				gpsData, fix := qlGPSData(v[7+i*qlFix:])
+				if mv, err := strconv.ParseFloat(v[4], 64); err == nil {
+					gpsData.AccV = mv / 1000
+				}
+				if event != "" {
+					gpsData.OtherID = append(gpsData.OtherID, "Event="+event+";")
+				}
+				if len(tail) > 0 && tail[0] != "" {
+					gpsData.OtherID = append(gpsData.OtherID, "Mileage="+tail[0]+";")
+				}
+				if len(tail) > 4 && tail[4] != "" {
+					if bat, err := strconv.Atoi(tail[4]); err == nil {
+						gpsData.BatLevel = int64(bat)
+						gpsData.UseBatLevel = true
+					}
+				}
+				addRecord(gpsData, fix)
+			}
+
+		case kind == "GTIGN" || kind == "GTIGF":
+			//<версия>,<IMEI>,<имя>,<длительность>,{точка},<моточасы>,<пробег>,...
+			if len(v) < 5+qlFix {
+				return T.ReturnError("bad length " + msg)
+			}
+			gpsData, fix := qlGPSData(v[5:])
+			if kind == "GTIGN" {
+				gpsData.OtherID = append(gpsData.OtherID, "Ign=1;")
+			} else {
+				gpsData.OtherID = append(gpsData.OtherID, "Ign=0;")
+			}
+			addRecord(gpsData, fix)
+
+		case kind == "GTMPN" || kind == "GTMPF":
+			//подключение/отключение внешнего питания: <версия>,<IMEI>,<имя>,{точка},...
+			if len(v) < 4+qlFix {
+				return T.ReturnError("bad length " + msg)
+			}
+			gpsData, fix := qlGPSData(v[4:])
+			if kind == "GTMPN" {
+				gpsData.OtherID = append(gpsData.OtherID, "Power=1;")
+			} else {
+				gpsData.OtherID = append(gpsData.OtherID, "Power=0;")
+			}
+			addRecord(gpsData, fix)
+
+		case kind == "GTBPL":
+			//разряд резервной батареи: <версия>,<IMEI>,<имя>,<напряжение В>,{точка},...
+			if len(v) < 5+qlFix {
+				return T.ReturnError("bad length " + msg)
+			}
+			gpsData, fix := qlGPSData(v[5:])
+			gpsData.BatV, _ = strconv.ParseFloat(v[4], 64)
+			gpsData.OtherID = append(gpsData.OtherID, "Event=BatteryLow;")
+			addRecord(gpsData, fix)
+
+		case kind == "GTPNA" || kind == "GTPFA":
+			//включение/выключение трекера, без координат
+			T.GPS.LastInfo = "power " + map[string]string{"GTPNA": "on", "GTPFA": "off"}[kind]
+			T.GPS.LastError = ""
+
+		case kind == "GTHBD":
+			T.GPS.LastInfo = "heartbeat"
+			T.GPS.LastError = ""
+			T.GPS.CountData = append(T.GPS.CountData, fmt.Sprintf("+SACK:GTHBD,%s,%s$", v[1], count)...)
+			continue
+
+		default:
+			T.GPS.LastInfo = "skip " + kind
+			T.GPS.LastError = ""
+		}
+
+		T.GPS.CountData = append(T.GPS.CountData, fmt.Sprintf("+SACK:%s$", count)...)
+	}
+
+	if err := T.GPS.SaveRecords(T.Path, records); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//qlGPSData точка из qlFix полей; fix - координаты определены (HDOP не 0)
+func qlGPSData(v []string) (gpsData models.GPSData, fix bool) {
+	hdop, err := strconv.ParseFloat(v[0], 64)
+	fix = err == nil && hdop > 0
+
+	val, _ := strconv.ParseFloat(v[1], 64)
+	gpsData.Speed = int64(val)
+	val, _ = strconv.ParseFloat(v[2], 64)
+	gpsData.Angle = int64(val)
+	val, _ = strconv.ParseFloat(v[3], 64)
+	gpsData.Alt = int64(val)
+
+	gpsData.Lng, _ = strconv.ParseFloat(v[4], 64)
+	gpsData.Lat, _ = strconv.ParseFloat(v[5], 64)
+
+	if t, err := time.Parse("20060102150405", v[6]); err == nil {
+		gpsData.DateTime = t.Local()
+	} else {
+		fix = false
+	}
+	return gpsData, fix
+}
@@ -0,0 +1,75 @@
+package clients
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+//сообщения из документации @Track GV300
+const (
+	qlFRI = "+RESP:GTFRI,060228,862170010196747,,0,0,1,1,4.3,92,70.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00,2000.0,12345:12:34,,,80,210100,,,,20090214093254,11F0$"
+	qlIGN = "+RESP:GTIGN,060228,862170010196747,,200,0,0.0,0,70.0,121.354335,31.222073,20090214013254,0460,0000,18d8,6141,00,2000.0,12345:12:34,20090214093254,11F2$"
+	qlHBD = "+ACK:GTHBD,060228,862170010196747,,20090214093254,11F0$"
+)
+
+func TestQueclink(t *testing.T) {
+	//две точки в одном FRI, внешнее питание 12500 мВ
+	fri2 := strings.Replace(qlFRI, ",,0,0,1,1,4.3,", ",,12500,0,2,1,4.3,", 1)
+	fri2 = strings.Replace(fri2, "6141,00,2000.0", "6141,00,1,4.3,92,70.0,121.354335,31.222073,20090214013304,0460,0000,18d8,6141,00,2000.0", 1)
+
+	tests := []struct {
+		name    string
+		input   string
+		ack     string
+		records int
+		error   string
+	}{
+		{"fri", qlFRI, "+SACK:11F0$", 1, ""},
+		{"fri 2 points", fri2, "+SACK:11F0$", 2, ""},
+		{"buff", strings.Replace(qlFRI, "+RESP", "+BUFF", 1), "+SACK:11F0$", 1, ""},
+		//HDOP 0 - без координат
+		{"ign", qlIGN, "+SACK:11F2$", 0, "no gps fix"},
+		{"heartbeat", qlHBD, "+SACK:GTHBD,060228,11F0$", 0, ""},
+		{"several", qlHBD + "\r\n" + qlFRI, "+SACK:GTHBD,060228,11F0$+SACK:11F0$", 1, ""},
+	}
+	for _, tt := range tests {
+		T := &Queclink{Path: t.TempDir() + "/"}
+		T.Input = []byte(tt.input)
+		if err := T.ParseData(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(T.GPS.CountData) != tt.ack {
+			t.Errorf("%s: ack %q, want %q", tt.name, T.GPS.CountData, tt.ack)
+		}
+		if T.GPS.Name != "862170010196747" || T.GPS.LastError != tt.error {
+			t.Errorf("%s: name %q, error %q", tt.name, T.GPS.Name, T.GPS.LastError)
+		}
+		if tt.records == 0 {
+			continue
+		}
+
+		d := T.GPS.GpsD
+		tm := time.Date(2009, 2, 14, 1, 32, 54, 0, time.UTC)
+		if tt.records == 2 {
+			tm = tm.Add(10 * time.Second)
+		}
+		if !d.DateTime.Equal(tm) || d.Lat != 31.222073 || d.Lng != 121.354335 ||
+			d.Speed != 4 || d.Angle != 92 || d.Alt != 70 {
+			t.Errorf("%s: record %+v", tt.name, d)
+		}
+		if !d.UseBatLevel || d.BatLevel != 80 {
+			t.Errorf("%s: battery %d %v", tt.name, d.BatLevel, d.UseBatLevel)
+		}
+		if tt.records == 2 && d.AccV != 12.5 {
+			t.Errorf("%s: external power %v", tt.name, d.AccV)
+		}
+	}
+
+	//IMEI другого устройства на том же соединении
+	T := &Queclink{Path: t.TempDir() + "/"}
+	T.Input = []byte(qlFRI + strings.Replace(qlHBD, "862170010196747", "862170010196748", 1))
+	if err := T.ParseData(); err == nil {
+		t.Fatal("message of other device accepted")
+	}
+}
@@ -0,0 +1,160 @@
+package clients
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gps_clients/server_gps_service/hash"
+	"gps_clients/server_gps_service/models"
+)
+
+//Ruptela двоичный протокол трекеров Ruptela (FM-Eco, FM-Pro, Trace):
+//длина 2 байта, IMEI 8 байт, команда, данные, CRC16-KERMIT от IMEI до конца данных
+type Ruptela models.ProtocolModel
+
+//команды Ruptela
+const (
+	ruptelaRecords    = 1
+	ruptelaRecordsExt = 68
+	ruptelaAck        = 100
+)
+
+func (T *Ruptela) Model() *models.ProtocolModel {
+	return (*models.ProtocolModel)(T)
+}
+
+//GetBadPacketByte отрицательное подтверждение 0x64 0x00
+func (T *Ruptela) GetBadPacketByte() []byte {
+	return ruptelaAnswer(0)
+}
+
+func (T *Ruptela) ReturnError(err string) error {
+	T.GPS.LastError = err
+	return errors.New(T.GPS.LastError)
+}
+
+//ruptelaAnswer ответ на записи: 1 - приняты, 0 - нет
+func ruptelaAnswer(ack byte) []byte {
+	b := []byte{0x00, 0x02, ruptelaAck, ack}
+	crc := hash.CheckSumCRC16Kermit(b[2:])
+	return append(b, byte(crc>>8), byte(crc))
+}
+
+func (T *Ruptela) ParseData() error {
+	defer func() {
+		if recMes := recover(); recMes != nil {
+			T.GPS.Log().Error("panic parse data: %v", recMes)
+		}
+	}()
+	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
+	T.GPS.LastInfo = ""
+	T.GPS.LastError = "no data"
+
+	input := T.Input
+	if len(input) < 13 {
+		return T.ReturnError(fmt.Sprintf("short packet %x", input))
+	}
+	lenPacket := int(binary.BigEndian.Uint16(input[0:2]))
+	if len(input) != lenPacket+4 {
+		return T.ReturnError(fmt.Sprintf("error length: %d != %d", lenPacket, len(input)-4))
+	}
+
+	origCRC := binary.BigEndian.Uint16(input[2+lenPacket:])
+	if dataCRC := hash.CheckSumCRC16Kermit(input[2 : 2+lenPacket]); origCRC != dataCRC {
+		return T.ReturnError(fmt.Sprintf("error crc sum: origCRC= %d, dataCRC= %d", origCRC, dataCRC))
+	}
+
+	name := strconv.FormatUint(binary.BigEndian.Uint64(input[2:10]), 10)
+	if T.GPS.Name == "" {
+		T.GPS.Name = name
+		if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+			return T.ReturnError(err.Error())
+		}
+	} else if T.GPS.Name != name {
+		return T.ReturnError(fmt.Sprintf("imei %s on connection of %s", name, T.GPS.Name))
+	}
+
+	command := input[10]
+	switch command {
+	case ruptelaRecords:
+		return T.ParceRecords(input[11:2+lenPacket], ioCodec8)
+	case ruptelaRecordsExt:
+		return T.ParceRecords(input[11:2+lenPacket], ioRuptelaExt)
+	default:
+		return T.ReturnError(fmt.Sprintf("unsupported command %d", command))
+	}
+}
+
+//ParceRecords записи команд 1 и 68: в расширенных есть байт расширения записи,
+//ID события и ID датчиков 2 байта
+func (T *Ruptela) ParceRecords(input []byte, io ioGroups) error {
+	T.GPS.LastError = ""
+	T.GPS.LastInfo = ""
+
+	if len(input) < 2 {
+		return T.ReturnError("bad records length")
+	}
+	countData := int(input[1]) //input[0] - записей осталось в памяти
+	pos := 2
+
+	var records models.Records
+
+	head := 23
+	if io.idSize == 2 {
+		head = 25
+	}
+
+	for i := 0; i < countData; i++ {
+		if len(input) < pos+head {
+			return T.ReturnError(fmt.Sprintf("bad record %d length", i))
+		}
+		r := input[pos:]
+		var gpsData models.GPSData
+
+		gpsData.DateTime = time.Unix(int64(binary.BigEndian.Uint32(r[0:4])), 0).In(time.UTC)
+		//расширение времени, приоритет и в 68 - расширение записи
+		p := 6
+		if io.idSize == 2 {
+			p = 7
+		}
+		gpsData.Lng = float64(int32(binary.BigEndian.Uint32(r[p:p+4]))) / 10000000
+		gpsData.Lat = float64(int32(binary.BigEndian.Uint32(r[p+4:p+8]))) / 10000000
+		gpsData.Alt = int64(int16(binary.BigEndian.Uint16(r[p+8:p+10]))) / 10
+		gpsData.Angle = int64(binary.BigEndian.Uint16(r[p+10:p+12])) / 100
+		gpsData.Sat = int64(r[p+12])
+		gpsData.Speed = int64(binary.BigEndian.Uint16(r[p+13 : p+15]))
+		gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("HDOP=%.1f;", float64(r[p+15])/10))
+		gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Event=%d;", ioValue(r[p+16:head])))
+
+		next, err := io.parse(input, pos+head, func(id int, v []byte) {
+			d := ioValue(v)
+			switch {
+			case id == 29 && len(v) == 2:
+				gpsData.AccV = float64(d) / 1000
+			case id == 30 && len(v) == 2:
+				gpsData.BatV = float64(d) / 1000
+			case id == 65 && len(v) == 4:
+				gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("Mileage=%d;", d))
+			default:
+				gpsData.OtherID = append(gpsData.OtherID, ioParam(id, v))
+			}
+		})
+		if err != nil {
+			return T.ReturnError(err.Error())
+		}
+		pos = next
+
+		T.GPS.AddRecord(&records, gpsData, true, T.ChkPar)
+	}
+
+	T.GPS.CountData = ruptelaAnswer(1)
+
+	if err := T.GPS.SaveRecords(T.Path, records); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package clients
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/hash"
+)
+
+//ruptelaPacket пакет с длиной и CRC16-KERMIT: IMEI, команда, записей в памяти 0, количество и записи
+func ruptelaPacket(t *testing.T, imei string, command byte, records ...string) []byte {
+	b, err := hex.DecodeString(imei)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = append(b, command, 0, byte(len(records)))
+	for _, r := range records {
+		rec, err := hex.DecodeString(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = append(b, rec...)
+	}
+	crc := hash.CheckSumCRC16Kermit(b)
+	return append(append([]byte{byte(len(b) >> 8), byte(len(b))}, b...), byte(crc>>8), byte(crc))
+}
+
+const (
+	//IMEI 868204005647838
+	ruptelaIMEI = "000315A07F5965DE"
+	//запись команды 1 18.09.2025 10:20:30 UTC: 37.6175 55.752, высота 150.0, курс 90.00, 8 спутников, 60 км/ч,
+	//HDOP 1.2, событие 5; датчики (5=1, 27=10), (29=13200, 30=4100), (65=10000)
+	ruptelaRecord = "68CBDCEE" + "00" + "00" + "166BF998" + "213B1480" + "05DC" + "2328" + "08" + "003C" + "0C" + "05" +
+		"02" + "0501" + "1B0A" + "02" + "1D3390" + "1E1004" + "01" + "4100002710" + "00"
+	//на 10 секунд раньше - отклоняется
+	ruptelaEarlier = "68CBDCE4" + "00" + "00" + "166BF998" + "213B1480" + "05DC" + "2328" + "08" + "003C" + "0C" + "05" +
+		"00" + "00" + "00" + "00"
+	//запись команды 68 через 10 секунд: байт расширения записи, событие и ID датчиков 2 байта
+	ruptelaRecordExt = "68CBDCF8" + "00" + "00" + "00" + "166BF998" + "213B1480" + "05DC" + "2328" + "08" + "003C" + "0C" + "0005" +
+		"01" + "019101" + "01" + "001D3390" + "00" + "00"
+)
+
+func TestRuptela(t *testing.T) {
+	T := &Ruptela{Path: t.TempDir() + "/"}
+
+	T.Input = ruptelaPacket(t, ruptelaIMEI, ruptelaRecords, ruptelaRecord, ruptelaEarlier)
+	if err := T.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	//подтверждение из документации: команда 100, принято
+	if ack := hex.EncodeToString(T.GPS.CountData); ack != "0002640113bc" {
+		t.Fatalf("ack %s", ack)
+	}
+	if T.GPS.Name != "868204005647838" {
+		t.Fatalf("name %q", T.GPS.Name)
+	}
+	if T.GPS.LastError != "Последнее время меньше предидущего" {
+		t.Fatalf("last record error %q", T.GPS.LastError)
+	}
+	d := T.GPS.GpsD
+	if d.DateTime != time.Date(2025, 9, 18, 10, 20, 30, 0, time.UTC) || d.Sat != 8 ||
+		d.Lat != 55.752 || d.Lng != 37.6175 || d.Speed != 60 || d.Angle != 90 || d.Alt != 150 {
+		t.Fatalf("record %+v", d)
+	}
+	if d.AccV != 13.2 || d.BatV != 4.1 {
+		t.Fatalf("sensors %+v", d)
+	}
+	other := []string{"HDOP=1.2;", "Event=5;", "id 5=1;", "id 27=10;", "Mileage=10000;"}
+	if len(d.OtherID) != len(other) {
+		t.Fatalf("other %v", d.OtherID)
+	}
+	for i := range other {
+		if d.OtherID[i] != other[i] {
+			t.Fatalf("other %v", d.OtherID)
+		}
+	}
+
+	T.Input = ruptelaPacket(t, ruptelaIMEI, ruptelaRecordsExt, ruptelaRecordExt)
+	if err := T.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	if T.GPS.LastError != "" {
+		t.Fatalf("extended record error %q", T.GPS.LastError)
+	}
+	d = T.GPS.GpsD
+	if d.DateTime != time.Date(2025, 9, 18, 10, 20, 40, 0, time.UTC) || d.Lat != 55.752 || d.AccV != 13.2 ||
+		len(d.OtherID) != 3 || d.OtherID[1] != "Event=5;" || d.OtherID[2] != "id 401=1;" {
+		t.Fatalf("extended record %+v", d)
+	}
+
+	//неверная CRC
+	data := ruptelaPacket(t, ruptelaIMEI, ruptelaRecords, ruptelaRecord)
+	data[len(data)-1] ^= 0xFF
+	T.Input = data
+	if err := T.ParseData(); err == nil {
+		t.Fatal("bad crc accepted")
+	}
+
+	//другой IMEI на том же соединении
+	T.Input = ruptelaPacket(t, "000315A07F5965DF", ruptelaRecords, ruptelaRecord)
+	if err := T.ParseData(); err == nil {
+		t.Fatal("foreign imei accepted")
+	}
+
+	//отрицательное подтверждение
+	if nack := hex.EncodeToString(T.GetBadPacketByte()); nack != "000264000235" {
+		t.Fatalf("nack %s", nack)
+	}
+}
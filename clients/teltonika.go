@@ -10,11 +10,14 @@ import (
 
 	"gps_clients/server_gps_service/hash"
 	"gps_clients/server_gps_service/models"
-	"gps_clients/server_gps_service/utils"
 )
 
 type Teltonika models.ProtocolModel
 
+func (T *Teltonika) Model() *models.ProtocolModel {
+	return (*models.ProtocolModel)(T)
+}
+
 func (T *Teltonika) GetBadPacketByte() []byte {
 	return []byte{0}
 }
@@ -27,7 +30,7 @@ func (T *Teltonika) ReturnError(err string) error {
 func (T *Teltonika) ParseData() error {
 	defer func() {
 		if recMes := recover(); recMes != nil {
-			utils.AddToLog(utils.GetProgramPath()+"-error.txt", recMes)
+			T.GPS.Log().Error("panic parse data: %v", recMes)
 		}
 	}()
 	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
@@ -49,6 +52,10 @@ func (T *Teltonika) ParseData() error {
 			T.GPS.Name += string(T.Input[i])
 		}
 
+		if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+			return T.ReturnError(err.Error())
+		}
+
 		T.GPS.CountData = []byte{1}
 		T.GPS.LastError = ""
 		return nil
@@ -185,163 +192,21 @@ func (T *Teltonika) ParceGPSData8ECodec() error {
 
 		//posInInput = 34
 		//IO ELEMENT
-		posInInput += 2 //0 – данные созданы не по событию
-
-		//Общее кол-во передаваемых датчиков
-		data = input[posInInput : posInInput+2]
-		posInInput += 2
-		countAllIO, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64)
-		if err != nil {
-			T.GPS.LastError = "error parse io element count: " + err.Error()
-		} else {
-			var c int64
-			for c = 0; c < countAllIO; c++ {
-				//0 - 1b, 1 - 2b, 2 - 4b, 3 - 8b, 4 - Xb
-				switch c {
-				case 0:
-					data = input[posInInput : posInInput+2]
-					posInInput += 2
-					countIO, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64) // Кол-во датчиков разрядности 1 байт
-					if err != nil {
-						T.GPS.LastError = "error parse io element count 1b: " + err.Error()
-					} else {
-						var i int64
-						for i = 0; i < countIO; i++ {
-							data = input[posInInput : posInInput+2]
-							posInInput += 2
-							id, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64)
-							if err != nil {
-								T.GPS.LastError = "error parse io element id 1b: " + err.Error()
-							} else {
-								d := int(input[posInInput])
-								posInInput++
-								gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-							}
-						}
-					}
-
-				case 1:
-					data = input[posInInput : posInInput+2]
-					posInInput += 2
-					countIO, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64) // Кол-во датчиков разрядности 2 байта
-					if err != nil {
-						T.GPS.LastError = "error parse io element count 2b: " + err.Error()
-					} else {
-						var i int64
-						for i = 0; i < countIO; i++ {
-							data = input[posInInput : posInInput+2]
-							posInInput += 2
-							id, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64)
-							if err != nil {
-								T.GPS.LastError = "error parse io element id 2b: " + err.Error()
-							} else {
-								data = input[posInInput : posInInput+2]
-								posInInput += 2
-								d, err := strconv.ParseInt(hex.EncodeToString(data), 16, 16)
-								if err == nil {
-									switch id {
-									case 66:
-										gpsData.AccV = float64(d) / 1000
-									case 67:
-										gpsData.BatV = float64(d) / 1000
-									default:
-										gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-									}
-								} else {
-									T.GPS.LastError = "error parse io param 2b: " + err.Error()
-								}
-							}
-
-						}
-					}
-				case 2:
-					data = input[posInInput : posInInput+2]
-					posInInput += 2
-					countIO, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64) // Кол-во датчиков разрядности 4 байта
-					if err != nil {
-						T.GPS.LastError = "error parse io element count 4b: " + err.Error()
-					} else {
-						var i int64
-						for i = 0; i < countIO; i++ {
-							data = input[posInInput : posInInput+2]
-							posInInput += 2
-							id, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64)
-							if err != nil {
-								T.GPS.LastError = "error parse io element id 4b: " + err.Error()
-							} else {
-								data = input[posInInput : posInInput+4]
-								posInInput += 4
-								d, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64) //32
-								if err == nil {
-									gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-								} else {
-									T.GPS.LastError = "error parse io param 4b: " + err.Error()
-								}
-							}
-						}
-					}
-				case 3:
-					data = input[posInInput : posInInput+2]
-					posInInput += 2
-					countIO, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64) // Кол-во датчиков разрядности 8 байт
-					if err != nil {
-						T.GPS.LastError = "error parse io element count 8b: " + err.Error()
-					} else {
-						var i int64
-						for i = 0; i < countIO; i++ {
-							data = input[posInInput : posInInput+2]
-							posInInput += 2
-							id, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64)
-							if err != nil {
-								T.GPS.LastError = "error parse io element id 8b: " + err.Error()
-							} else {
-								data = input[posInInput : posInInput+8]
-								posInInput += 8
-								d, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64)
-								if err == nil {
-									gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-								} else {
-									T.GPS.LastError = "error parse io param 8b: " + err.Error()
-								}
-							}
-						}
-					}
-				case 4:
-					data = input[posInInput : posInInput+2]
-					posInInput += 2
-					countIO, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64) // Nx
-					if err != nil {
-						T.GPS.LastError = "error parse io element count NXb: " + err.Error()
-					} else {
-						var i int64
-						for i = 0; i < countIO; i++ {
-							data = input[posInInput : posInInput+2]
-							posInInput += 2
-							id, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64)
-							if err != nil {
-								T.GPS.LastError = "error parse io element id NXb: " + err.Error()
-							} else {
-								lenght, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64)
-								if err != nil {
-									T.GPS.LastError = "error parse len io param NXb: " + err.Error()
-								} else {
-									data = input[posInInput : posInInput+int(lenght)]
-									posInInput += int(lenght)
-									d, err := strconv.ParseInt(hex.EncodeToString(data), 16, 64)
-									if err == nil {
-										gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-									} else {
-										T.GPS.LastError = "error parse io param NXb: " + err.Error()
-									}
-								}
-							}
-						}
-					}
-				default:
-
-				}
+		posInInput += 4 //Event IO ID и общее кол-во датчиков
+
+		posInInput, err = ioCodec8E.parse(input, posInInput, func(id int, v []byte) {
+			d := ioValue(v)
+			switch {
+			case id == 66 && len(v) == 2:
+				gpsData.AccV = float64(d) / 1000
+			case id == 67 && len(v) == 2:
+				gpsData.BatV = float64(d) / 1000
+			default:
+				gpsData.OtherID = append(gpsData.OtherID, ioParam(id, v))
 			}
-
+		})
+		if err != nil {
+			return T.ReturnError(err.Error())
 		}
 
 		err = T.GPS.Chk(gpsData, T.ChkPar)
@@ -459,79 +324,21 @@ func (T *Teltonika) ParceGPSData8Codec() error {
 
 		//posInInput = 34
 		//IO ELEMENT
-		posInInput++ //0 – данные созданы не по событию
-
-		countAllIO := int(input[posInInput])
-		posInInput++ //Общее кол-во передаваемых датчиков
-
-		for i := 0; i < countAllIO; i++ {
-			switch i {
-			case 0:
-				countIO := int(input[posInInput]) // Кол-во датчиков разрядности 1 байт
-				posInInput++
-				for i := 0; i < countIO; i++ {
-					id := int(input[posInInput])
-					posInInput++
-					d := int(input[posInInput])
-					posInInput++
-					gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-				}
-			case 1:
-				countIO := int(input[posInInput]) // Кол-во датчиков разрядности 2 байта
-				posInInput++
-				for i := 0; i < countIO; i++ {
-					id := int(input[posInInput])
-					posInInput++
-					data = input[posInInput : posInInput+2]
-					posInInput += 2
-					encodedStr = hex.EncodeToString(data)
-					d, err := strconv.ParseInt(encodedStr, 16, 16)
-					if err == nil {
-						switch id {
-						case 66:
-							gpsData.AccV = float64(d) / 1000
-						case 67:
-							gpsData.BatV = float64(d) / 1000
-						default:
-							gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-						}
-					} else {
-						T.GPS.LastError = "error parse io param 2b: " + err.Error()
-					}
-				}
-			case 2:
-				countIO := int(input[posInInput]) // Кол-во датчиков разрядности 4 байта
-				posInInput++
-				for i := 0; i < countIO; i++ {
-					id := int(input[posInInput])
-					posInInput++
-					data = input[posInInput : posInInput+4]
-					posInInput += 4
-					encodedStr = hex.EncodeToString(data)
-					d, err := strconv.ParseInt(encodedStr, 16, 64) //32
-					if err == nil {
-						gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-					} else {
-						T.GPS.LastError = "error parse io param 4b: " + err.Error()
-					}
-				}
-			case 3:
-				countIO := int(input[posInInput]) // Кол-во датчиков разрядности 8 байт
-				posInInput++
-				for i := 0; i < countIO; i++ {
-					id := int(input[posInInput])
-					posInInput++
-					data = input[posInInput : posInInput+8]
-					posInInput += 8
-					encodedStr = hex.EncodeToString(data)
-					d, err := strconv.ParseInt(encodedStr, 16, 64)
-					if err == nil {
-						gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("id %d=%d;", id, d))
-					} else {
-						T.GPS.LastError = "error parse io param 8b: " + err.Error()
-					}
-				}
+		posInInput += 2 //Event IO ID и общее кол-во датчиков
+
+		posInInput, err = ioCodec8.parse(input, posInInput, func(id int, v []byte) {
+			d := ioValue(v)
+			switch {
+			case id == 66 && len(v) == 2:
+				gpsData.AccV = float64(d) / 1000
+			case id == 67 && len(v) == 2:
+				gpsData.BatV = float64(d) / 1000
+			default:
+				gpsData.OtherID = append(gpsData.OtherID, ioParam(id, v))
 			}
+		})
+		if err != nil {
+			return T.ReturnError(err.Error())
 		}
 
 		err = T.GPS.Chk(gpsData, T.ChkPar)
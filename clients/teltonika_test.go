@@ -0,0 +1,153 @@
+package clients
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"gps_clients/server_gps_service/hash"
+)
+
+//avlFrames пакеты AVL из документации Teltonika (Codec 8 и 8E); Bitrek и Cargo передают тот же Codec 8
+var avlFrames = map[string]string{
+	//одна запись, IO: событие 1, всего 5 - (21=3, 1=1), (66=24079), (241=24602), (78=0)
+	"codec8": "000000000000003608010000016B40D8EA30010000000000000000000000000000000105021503010101425E0F01F10000601A014E0000000000000000010000C7CF",
+	//одна запись, всего 3 датчика: группы 4 и 8 байт пустые
+	"codec8 3 io": "000000000000002808010000016B40D9AD80010000000000000000000000000000000103021503010101425E100000010000F22A",
+	//две записи по одному датчику 1 байт
+	"codec8 2 records": "000000000000004308020000016B40D57B480100000000000000000000000000000001010101000000000000016B40D5C198010000000000000000000000000000000101010101000000020000252C",
+	//одна запись, IO с 2-байтовыми ID: (1=1), (17=29), (16=22949000), (11=893700218, 14=500686954), без X-байтовых
+	"codec8e": "000000000000004A8E010000016B412CEE000100000000000000000000000000000000010005000100010100010011001D00010010015E2C880002000B000000003544C87A000E000000001DD7E06A00000100002994",
+}
+
+//avlRecords принятые записи и число отклоненных, сохраненные разборщиком в dir
+func avlRecords(t *testing.T, dir string) (saved []string, rejected int) {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		lines := strings.Split(strings.TrimRight(string(b), "\r\n"), "\r\n")
+		if strings.Contains(path, "Error") {
+			rejected += strings.Count(string(b), "\r\n-") + 1
+		} else {
+			saved = append(saved, lines...)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(saved)
+	return saved, rejected
+}
+
+//TestAVLCaptures записи пакетов из документации разбираются Teltonika, Bitrek и Cargo одинаково
+func TestAVLCaptures(t *testing.T) {
+	tests := []struct {
+		decoder  string
+		frame    string
+		ack      string
+		saved    []string
+		rejected int
+	}{
+		{"teltonika", "codec8", "00000001", []string{
+			"100446;0.000000;0.000000;Altitude=0;Angle=0;SatCount=0;Speed=0;AccV=24.08;BatV=0.00;id 21=3;id 1=1;id 241=24602;id 78=0;",
+		}, 0},
+		{"teltonika", "codec8 3 io", "00000001", []string{
+			"100536;0.000000;0.000000;Altitude=0;Angle=0;SatCount=0;Speed=0;AccV=24.08;BatV=0.00;id 21=3;id 1=1;",
+		}, 0},
+		{"teltonika", "codec8 2 records", "00000002", []string{
+			"100101;0.000000;0.000000;Altitude=0;Angle=0;SatCount=0;Speed=0;AccV=0.00;BatV=0.00;id 1=0;",
+			"100119;0.000000;0.000000;Altitude=0;Angle=0;SatCount=0;Speed=0;AccV=0.00;BatV=0.00;id 1=1;",
+		}, 0},
+		{"teltonika", "codec8e", "00000001", []string{
+			"113632;0.000000;0.000000;Altitude=0;Angle=0;SatCount=0;Speed=0;AccV=0.00;BatV=0.00;id 1=1;id 17=29;id 16=22949000;id 11=893700218;id 14=500686954;",
+		}, 0},
+		{"bitrek", "codec8", "00000001", []string{
+			"100446;0.000000;0.000000;Altitude=0;Angle=0;SatCount=0;Speed=0;AccV=24.08;BatV=0.00;id 21=3;id 1=1;id 241=24602;id 78=0;",
+		}, 0},
+		{"cargo", "codec8", "00000001", []string{
+			"100446;0.000000;0.000000;Altitude=0;Angle=0;SatCount=0;Speed=0;AccV=24.08;BatV=0.00;id 21=3;id 1=1;id 241=24602;id 78=0;",
+		}, 0},
+	}
+	for _, tt := range tests {
+		name := tt.decoder + " " + tt.frame
+		input, err := hex.DecodeString(avlFrames[tt.frame])
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := New(tt.decoder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		m := p.Model()
+		m.Path = dir + "/"
+		m.GPS.Name = "356307042441013"
+		m.Input = input
+		if err := p.ParseData(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if ack := hex.EncodeToString(m.GPS.CountData); ack != tt.ack {
+			t.Errorf("%s: ack %s, want %s", name, ack, tt.ack)
+		}
+		saved, rejected := avlRecords(t, dir)
+		if strings.Join(saved, "\n") != strings.Join(tt.saved, "\n") || rejected != tt.rejected {
+			t.Errorf("%s: saved\n%s\nwant\n%s\nrejected %d, want %d", name,
+				strings.Join(saved, "\n"), strings.Join(tt.saved, "\n"), rejected, tt.rejected)
+		}
+	}
+}
+
+//avlFrame пакет AVL из данных от кода кодека до числа записей включительно
+func avlFrame(t *testing.T, data string) []byte {
+	b, err := hex.DecodeString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := []byte{0, 0, 0, 0, byte(len(b) >> 24), byte(len(b) >> 16), byte(len(b) >> 8), byte(len(b))}
+	frame = append(frame, b...)
+	crc := hash.CheckSumCRC16(b)
+	return append(frame, 0, 0, byte(crc>>8), byte(crc))
+}
+
+//TestAVLIOElements разбор значений датчиков на границах
+func TestAVLIOElements(t *testing.T) {
+	//запись Codec 8 18.09.2025 10:20:30 UTC, 55.752 37.6175, высота 150, курс 90, 8 спутников, 60 км/ч
+	const rec = "000001995C5701B0" + "00" + "166BF998" + "213B1480" + "0096" + "005A" + "08" + "003C"
+	tests := []struct {
+		name     string
+		data     string
+		err      bool
+		saved    string
+		rejected int
+	}{
+		//2-байтовое значение беззнаковое: 0x80E8 = 33000 мВ
+		{"2 byte value above 0x7FFF", "0801" + rec + "0004" + "011503" + "014280E8" + "01F10000601A" + "014E0000000000000000" + "01",
+			false, "102030;55.752000;37.617500;Altitude=150;Angle=90;SatCount=8;Speed=60;AccV=33.00;BatV=0.00;id 21=3;id 241=24602;id 78=0;", 0},
+		//выход за пакет - ошибка, пакет не подтверждается
+		{"io out of packet", "0801" + rec + "0002" + "01" + "1503" + "05" + "4280E8" + "00" + "00" + "01",
+			true, "", 0},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		p := &Teltonika{Path: dir + "/"}
+		p.GPS.Name = "356307042441013"
+		p.Input = avlFrame(t, tt.data)
+		if err := p.ParseData(); (err != nil) != tt.err {
+			t.Errorf("%s: error %v", tt.name, err)
+		}
+		saved, rejected := avlRecords(t, dir)
+		if strings.Join(saved, "\n") != tt.saved || rejected != tt.rejected {
+			t.Errorf("%s: saved %q, rejected %d", tt.name, saved, rejected)
+		}
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"gps_clients/server_gps_service/models"
 	"gps_clients/server_gps_service/utils"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +15,10 @@ import (
 
 type Wialon models.ProtocolModel
 
+func (T *Wialon) Model() *models.ProtocolModel {
+	return (*models.ProtocolModel)(T)
+}
+
 func (T *Wialon) GetBadPacketByte() []byte {
 	return []byte{0}
 }
@@ -29,7 +32,7 @@ func (T *Wialon) ReturnError(err string) error {
 func (T *Wialon) ParseData() error {
 	defer func() {
 		if recMes := recover(); recMes != nil {
-			utils.AddToLog(utils.GetProgramPath()+"-error.txt", recMes)
+			T.GPS.Log().Error("panic parse data: %v", recMes)
 		}
 	}()
 	T.GPS.LastConnect = time.Now().Local().Format("02.01.2006 15:04:05")
@@ -37,21 +40,23 @@ func (T *Wialon) ParseData() error {
 	T.GPS.LastError = "no data"
 
 	if strings.HasPrefix(string(T.Input), "#") {
-		T.WialonIPS()
-	} else {
-		T.WialonRetranslator_v1()
+		return T.WialonIPS()
 	}
+	T.WialonRetranslator_v1()
 
 	return nil
 }
 
-func (T *Wialon) WialonIPS() {
+//WialonIPS ответ на каждую строку пакета: #AL# на вход, #AD# на #D#, #ASD# на #SD#.
+//Отказ во входе - ошибка разбора, ответ #AL#0 отправляется перед закрытием соединения.
+func (T *Wialon) WialonIPS() error {
 	body := T.Input
+	T.GPS.CountData = nil
 
 	bodySlice := strings.Split(string(body), "\r\n")
 	if len(bodySlice) < 2 {
 		T.GPS.LastError = "wrong input data"
-		return
+		return nil
 	}
 
 	for _, v := range bodySlice {
@@ -62,27 +67,42 @@ func (T *Wialon) WialonIPS() {
 		slice := strings.Split(v, "#")
 		if len(slice) < 3 {
 			T.GPS.LastError = "wrong split data wialon ips: " + v
-			return
+			return nil
 		}
 
 		switch slice[1] {
 		case "L":
 			s := strings.Split(slice[2], ";")
 			T.GPS.Name = s[0]
+			if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+				T.GPS.CountData = append(T.GPS.CountData, "#AL#0\r\n"...)
+				T.GPS.LastError = err.Error()
+				return err
+			}
+			T.GPS.CountData = append(T.GPS.CountData, "#AL#1\r\n"...)
 		case "D", "SD":
 			s := strings.Split(slice[2], ";")
+			ack := "#A" + slice[1] + "#"
 
 			var gpsData models.GPSData
 			var err error
 
 			gpsData.DateTime, err = time.Parse("020106 150405", s[0]+" "+s[1])
 			if err != nil {
+				T.GPS.CountData = append(T.GPS.CountData, ack+"0\r\n"...)
 				T.GPS.LastError = "error parce data: " + err.Error()
-				return
+				continue
 			}
 
-			gpsData.Lat = utils.ConvertCoordToFloat(s[2])
-			gpsData.Lng = utils.ConvertCoordToFloat(s[4])
+			//NA;NA - координат нет, код 10 - ошибка координат
+			if gpsData.Lat, err = utils.ConvertCoordHemi(s[2], s[3]); err == nil {
+				gpsData.Lng, err = utils.ConvertCoordHemi(s[4], s[5])
+			}
+			if err != nil {
+				T.GPS.CountData = append(T.GPS.CountData, ack+"10\r\n"...)
+				T.GPS.LastError = "error parce coordinates: " + err.Error()
+				continue
+			}
 			gpsData.Sat, _ = strconv.ParseInt(s[9], 10, 64)
 			gpsData.Alt, _ = strconv.ParseInt(s[8], 10, 64)
 			gpsData.Speed, _ = strconv.ParseInt(s[6], 10, 64)
@@ -112,8 +132,10 @@ func (T *Wialon) WialonIPS() {
 					utils.ChkErrFatal(err)
 				}
 			}
+			T.GPS.CountData = append(T.GPS.CountData, ack+"1\r\n"...)
 		}
 	}
+	return nil
 }
 
 func (T *Wialon) WialonRetranslator_v1() {
@@ -146,6 +168,10 @@ func (T *Wialon) WialonRetranslator_v1() {
 				T.GPS.LastError = "error gps name wialon retranslator"
 				return
 			}
+			if err := T.ChkPar.ChkName(T.GPS.Name); err != nil {
+				T.GPS.LastError = err.Error()
+				return
+			}
 
 			lastIndex += namePos + 2
 			buf = tempBody[lastIndex : lastIndex+8]
@@ -184,13 +210,13 @@ func (T *Wialon) WialonRetranslator_v1() {
 					buf16Byte := make([]byte, 16)
 					_, err = hex.Decode(buf16Byte, res)
 					if err != nil {
-						log.Println(err)
+						T.GPS.Log().Warn("error parse block %s: %v", blockInfo.Name, err)
 						continue
 					}
 
 					var double float64
 					if err := binary.Read(bytes.NewBuffer(buf16Byte), binary.LittleEndian, &double); err != nil {
-						log.Println(err)
+						T.GPS.Log().Warn("error parse block %s: %v", blockInfo.Name, err)
 						continue
 					}
 					gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("%s=%.2f;", blockInfo.Name, double))
@@ -201,13 +227,13 @@ func (T *Wialon) WialonRetranslator_v1() {
 					buf16Byte := make([]byte, 16)
 					_, err = hex.Decode(buf16Byte, res)
 					if err != nil {
-						log.Println(err)
+						T.GPS.Log().Warn("error parse block %s: %v", blockInfo.Name, err)
 						continue
 					}
 
 					var integer int
 					if integer, err = strconv.Atoi(string(res)); err != nil {
-						log.Println(err)
+						T.GPS.Log().Warn("error parse block %s: %v", blockInfo.Name, err)
 						continue
 					}
 					gpsData.OtherID = append(gpsData.OtherID, fmt.Sprintf("%s=%d;", blockInfo.Name, integer))
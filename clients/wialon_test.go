@@ -0,0 +1,73 @@
+package clients
+
+import (
+	"errors"
+	"testing"
+)
+
+//rejectDevices реестр, в котором нет ни одного устройства
+type rejectDevices struct{}
+
+func (rejectDevices) CheckDevice(name string) error {
+	return errors.New("unknown device " + name)
+}
+
+func TestWialonIPSAck(t *testing.T) {
+	tests := []struct {
+		input string
+		ack   string
+	}{
+		{"#L#356307042441013;NA\r\n", "#AL#1\r\n"},
+		{"#D#180925;102030;5545.1234;N;03736.5678;E;10;90;150;8\r\n", "#AD#1\r\n"},
+		{"#SD#180925;102031;5545.1234;N;03736.5678;E;10;90;150;8\r\n", "#ASD#1\r\n"},
+		{"#SD#180925;1020;5545.1234;N;03736.5678;E;10;90;150;8\r\n", "#ASD#0\r\n"},
+		{"#D#bad;102032;5545.1234;N;03736.5678;E;10;90;150;8\r\n", "#AD#0\r\n"},
+		//координат нет или не разобраны
+		{"#D#180925;102035;NA;NA;NA;NA;10;90;150;8\r\n", "#AD#10\r\n"},
+		{"#SD#180925;102036;5545.1234;N;03736.5678;X;10;90;150;8\r\n", "#ASD#10\r\n"},
+		{
+			"#L#356307042441013;NA\r\n#SD#180925;102033;5545.1234;N;03736.5678;E;10;90;150;8\r\n#D#180925;102034;5545.1234;N;03736.5678;E;10;90;150;8\r\n",
+			"#AL#1\r\n#ASD#1\r\n#AD#1\r\n",
+		},
+		//ошибка в средней строке не мешает разбору и подтверждению остальных
+		{
+			"#L#356307042441013;NA\r\n#D#180925;102037;5545.1234;N;03736.5678;E;10;90;150;8\r\n#D#180925;102038;NA;NA;NA;NA;10;90;150;8\r\n#D#180925;102039;5545.1234;N;03736.5678;E;10;90;150;8\r\n",
+			"#AL#1\r\n#AD#1\r\n#AD#10\r\n#AD#1\r\n",
+		},
+		{
+			"#L#356307042441013;NA\r\n#SD#180925;102040;5545.1234;N;03736.5678;E;10;90;150;8\r\n#SD#180925;1020;5545.1234;N;03736.5678;E;10;90;150;8\r\n#SD#180925;102041;5545.1234;N;03736.5678;E;10;90;150;8\r\n",
+			"#AL#1\r\n#ASD#1\r\n#ASD#0\r\n#ASD#1\r\n",
+		},
+	}
+	for _, tt := range tests {
+		T := &Wialon{Path: t.TempDir() + "/"}
+		T.Input = []byte(tt.input)
+		if err := T.ParseData(); err != nil {
+			t.Fatalf("%q: %v", tt.input, err)
+		}
+		if string(T.GPS.CountData) != tt.ack {
+			t.Errorf("%q: ack %q, want %q", tt.input, T.GPS.CountData, tt.ack)
+		}
+	}
+
+	//южная широта и западная долгота
+	T := &Wialon{Path: t.TempDir() + "/"}
+	T.Input = []byte("#L#356307042441013;NA\r\n#D#180925;102030;5545.1234;S;03736.5678;W;10;90;150;8\r\n")
+	if err := T.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	if T.GPS.GpsD.Lat != -55.7520567 || T.GPS.GpsD.Lng != -37.6094633 {
+		t.Fatalf("record %f %f", T.GPS.GpsD.Lat, T.GPS.GpsD.Lng)
+	}
+
+	//отказ во входе: ошибка разбора и ответ #AL#0, строки после входа не разбираются
+	T = &Wialon{Path: t.TempDir() + "/"}
+	T.ChkPar.Devices = rejectDevices{}
+	T.Input = []byte("#L#356307042441013;NA\r\n#D#180925;102030;5545.1234;N;03736.5678;E;10;90;150;8\r\n")
+	if err := T.ParseData(); err == nil {
+		t.Fatal("unknown device accepted")
+	}
+	if string(T.GPS.CountData) != "#AL#0\r\n" || !T.GPS.GpsD.DateTime.IsZero() {
+		t.Fatalf("ack %q, record %+v", T.GPS.CountData, T.GPS.GpsD)
+	}
+}
@@ -1,28 +1,212 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
+	"gps_clients/server_gps_service/clients"
 	"gps_clients/server_gps_service/utils"
 )
 
 var Config Configuration
 
+//mu защищает Config при перечитывании конфигурации во время работы
+var mu sync.RWMutex
+
+//Get текущая конфигурация, безопасно для вызова из соединений
+func Get() Configuration {
+	defer mu.RUnlock()
+	mu.RLock()
+	return Config
+}
+
+//Set замена конфигурации при перечитывании
+func Set(c Configuration) {
+	defer mu.Unlock()
+	mu.Lock()
+	Config = c
+}
+
 type Configuration struct {
-	ServiceName string   `json:"serivceName"`
-	DescService string   `json:"descService"`
-	Ports       []string `json:"ports"`
-	PathToSave  string   `json:"pathToSave"`
-	MinSatel    int64    `json:"minSatel"`
+	ServiceName string `json:"serviceName"`
+	//OldServiceName прежнее написание ключа serviceName, читается для совместимости
+	OldServiceName string `json:"serivceName,omitempty"`
+	DescService    string `json:"descService"`
+
+	Ports        []string   `json:"ports"`
+	Protocol     string     `json:"protocol"`
+	Listeners    []Listener `json:"listeners,omitempty"`
+	IdleTimeout  int64      `json:"idleTimeout"`
+	MaxFrameSize int64      `json:"maxFrameSize"`
+	DrainTimeout int64      `json:"drainTimeout"`
+	Limits       Limits     `json:"limits"`
+
+	PathToSave  string  `json:"pathToSave"`
+	MinSatel    int64   `json:"minSatel"`
+	DevicesFile string  `json:"devicesFile"`
+	APIAddr     string  `json:"apiAddr"`
+	Log         Log     `json:"log"`
+	Capture     Capture `json:"capture"`
+
+	Retranslators []Retranslator `json:"retranslators,omitempty"`
+	Webhooks      []Webhook      `json:"webhooks,omitempty"`
+	MQTT          []MQTT         `json:"mqtt,omitempty"`
+}
+
+//Listener группа портов со своим протоколом и ограничениями.
+//Нулевые значения берутся из общих параметров конфигурации.
+type Listener struct {
+	Ports        []string `json:"ports"`
+	Protocol     string   `json:"protocol"`
+	IdleTimeout  int64    `json:"idleTimeout"`
+	MaxFrameSize int64    `json:"maxFrameSize"`
+	Limits       Limits   `json:"limits"`
+	TLS          *TLS     `json:"tls,omitempty"`
+}
+
+//TLS прием соединений по TLS, разбор пакетов такой же, как по TCP
+type TLS struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	//ClientCA корневые сертификаты для проверки сертификатов устройств
+	ClientCA string `json:"clientCa"`
+	//ClientAuth "" - без проверки, verify - проверка, если передан, require - сертификат обязателен
+	ClientAuth string `json:"clientAuth"`
+	//MatchDevice CN сертификата устройства должен совпадать с его ID
+	MatchDevice bool `json:"matchDevice"`
+}
+
+//Limits ограничения соединений порта, 0 - без ограничения.
+//В listeners нулевые значения берутся из общих ограничений.
+type Limits struct {
+	MaxConns         int64 `json:"maxConns"`
+	MaxConnsPerIP    int64 `json:"maxConnsPerIp"`
+	MaxBytesPerSec   int64 `json:"maxBytesPerSec"`
+	MaxPacketsPerSec int64 `json:"maxPacketsPerSec"`
+	//HandshakeTimeout сек, за которые соединение должно передать IMEI/логин
+	HandshakeTimeout int64 `json:"handshakeTimeout"`
+}
+
+//merge значения l, незаданные берутся из def
+func (l Limits) merge(def Limits) Limits {
+	if l.MaxConns == 0 {
+		l.MaxConns = def.MaxConns
+	}
+	if l.MaxConnsPerIP == 0 {
+		l.MaxConnsPerIP = def.MaxConnsPerIP
+	}
+	if l.MaxBytesPerSec == 0 {
+		l.MaxBytesPerSec = def.MaxBytesPerSec
+	}
+	if l.MaxPacketsPerSec == 0 {
+		l.MaxPacketsPerSec = def.MaxPacketsPerSec
+	}
+	if l.HandshakeTimeout == 0 {
+		l.HandshakeTimeout = def.HandshakeTimeout
+	}
+	return l
+}
+
+//MQTT параметры публикации записей на MQTT брокер
+type MQTT struct {
+	Name      string   `json:"name"`
+	Addr      string   `json:"addr"`
+	ClientID  string   `json:"clientId"`
+	Username  string   `json:"username"`
+	Password  string   `json:"password"`
+	Prefix    string   `json:"prefix"`
+	QoS       byte     `json:"qos"`
+	Retain    bool     `json:"retain"`
+	KeepAlive int64    `json:"keepAlive"`
+	Devices   []string `json:"devices"`
+}
+
+//Webhook параметры отправки записей и событий на HTTP адрес
+type Webhook struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	Devices    []string `json:"devices"`
+	Ports      []string `json:"ports"`
+	Events     []string `json:"events"`
+	Timeout    int64    `json:"timeout"`
+	MaxBackoff int64    `json:"maxBackoff"`
+	MaxQueue   int      `json:"maxQueue"`
+	//BatchSize сообщений в одном запросе, BatchWait мс ожидания неполного пакета
+	BatchSize int   `json:"batchSize"`
+	BatchWait int64 `json:"batchWait"`
+}
+
+//Log параметры журнала, MaxSize в МБ, MaxAge в днях
+type Log struct {
+	Level      string   `json:"level"`
+	Format     string   `json:"format"`
+	File       string   `json:"file"`
+	MaxSize    int64    `json:"maxSize"`
+	MaxAge     int      `json:"maxAge"`
+	MaxBackups int      `json:"maxBackups"`
+	Daily      bool     `json:"daily"`
+	Console    bool     `json:"console"`
+	Debug      []string `json:"debugDevices,omitempty"`
+}
+
+//Capture запись сырых пакетов по портам и устройствам
+type Capture struct {
+	Dir     string   `json:"dir"`
+	Ports   []string `json:"ports,omitempty"`
+	Devices []string `json:"devices,omitempty"`
 }
 
+//Retranslator параметры ретрансляции принятых данных на другой сервер
+type Retranslator struct {
+	Name       string   `json:"name"`
+	Addr       string   `json:"addr"`
+	Protocol   string   `json:"protocol"`
+	Password   string   `json:"password"`
+	Devices    []string `json:"devices"`
+	Exclude    []string `json:"exclude"`
+	Timeout    int64    `json:"timeout"`
+	MaxBackoff int64    `json:"maxBackoff"`
+	MaxQueue   int      `json:"maxQueue"`
+
+	IOMap []IOElement `json:"ioMap"`
+	//TerminalIDs идентификаторы терминалов EGTS по имени устройства, без них - из реестра устройств
+	TerminalIDs map[string]uint32 `json:"terminalIds"`
+}
+
+//IOElement соответствие параметра записи IO ID протокола Teltonika
+type IOElement struct {
+	Param string  `json:"param"`
+	ID    int     `json:"id"`
+	Size  int     `json:"size"`
+	Scale float64 `json:"scale"`
+}
+
+//значения по умолчанию
+const (
+	DefaultIdleTimeout  = 180   //сек
+	DefaultMaxFrameSize = 10240 //байт
+	DefaultDrainTimeout = 10    //сек
+	DefaultHandshake    = 30    //сек
+)
+
 func setstandartconfig() {
 	Config.ServiceName = "go_server_teltonika"
 	Config.DescService = "TLKA gps-server service"
 	Config.Ports = []string{"10000", "10001"}
-	Config.PathToSave = "D:/UPC"
+	Config.Protocol = clients.DefaultProtocol
+	Config.IdleTimeout = DefaultIdleTimeout
+	Config.MaxFrameSize = DefaultMaxFrameSize
+	Config.DrainTimeout = DefaultDrainTimeout
+	Config.Limits.HandshakeTimeout = DefaultHandshake
+	Config.PathToSave = filepath.Join(utils.GetPathWhereExe(), "data")
 	Config.MinSatel = 4
 }
 
@@ -32,15 +216,11 @@ func ReadConfig(fileName string) error {
 		return err
 	}
 	if ok {
-		configFile, err := ioutil.ReadFile(fileName)
-		if err != nil {
-			log.Print("Unable to read config file, switching to flag mode")
-			return err
-		}
-		Config, err = unmarshalconfig(configFile)
+		c, err := Load(fileName)
 		if err != nil {
 			return err
 		}
+		Set(c)
 	} else {
 		setstandartconfig()
 		return writeconfigtofile(fileName)
@@ -49,6 +229,24 @@ func ReadConfig(fileName string) error {
 	return nil
 }
 
+//Load читает конфигурацию из файла с учетом переменных окружения, текущая конфигурация не меняется
+func Load(fileName string) (Configuration, error) {
+	body, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return Configuration{}, fmt.Errorf("config %s: %v", fileName, err)
+	}
+
+	c, err := unmarshalconfig(body)
+	if err != nil {
+		return Configuration{}, fmt.Errorf("config %s: %v", fileName, err)
+	}
+
+	if err := applyEnv(&c); err != nil {
+		return Configuration{}, err
+	}
+	return c, nil
+}
+
 //writeconfigtofile сохраняет конфигурацию настроек в файл
 func writeconfigtofile(namefile string) error {
 	body, err := Config.Marshal()
@@ -58,14 +256,110 @@ func writeconfigtofile(namefile string) error {
 	return ioutil.WriteFile(namefile, body, 0777)
 }
 
-//unmarshalconfig разбор параметров
+//unmarshalconfig разбор параметров, неизвестные ключи - ошибка
 func unmarshalconfig(data []byte) (Configuration, error) {
 	var r Configuration
-	err := json.Unmarshal(data, &r)
-	return r, err
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&r); err != nil {
+		return r, decodeError(data, err)
+	}
+
+	if r.ServiceName == "" {
+		r.ServiceName = r.OldServiceName
+	}
+	r.OldServiceName = ""
+	return r, nil
+}
+
+//decodeError ошибка разбора JSON с номером строки и позицией
+func decodeError(data []byte, err error) error {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+		err = fmt.Errorf("%s: cannot use %s as %s", e.Field, e.Value, e.Type)
+	default:
+		return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	col := offset - int64(bytes.LastIndexByte(data[:offset], '\n'))
+	return fmt.Errorf("line %d col %d: %v", line, col, err)
 }
 
 //Marshal сбор параметров
 func (r *Configuration) Marshal() ([]byte, error) {
-	return json.Marshal(r)
+	return json.MarshalIndent(r, "", "  ")
+}
+
+//Port параметры одного порта после объединения ports и listeners
+type Port struct {
+	Port         string
+	Protocol     string
+	IdleTimeout  time.Duration
+	MaxFrameSize int64
+	Limits       Limits
+	TLS          *TLS
+}
+
+//PortList все порты с протоколом и ограничениями каждого
+func (r *Configuration) PortList() ([]Port, error) {
+	idle := r.IdleTimeout
+	if idle == 0 {
+		idle = DefaultIdleTimeout
+	}
+	frame := r.MaxFrameSize
+	if frame == 0 {
+		frame = DefaultMaxFrameSize
+	}
+	protocol := r.Protocol
+	if protocol == "" {
+		protocol = clients.DefaultProtocol
+	}
+	limits := r.Limits.merge(Limits{HandshakeTimeout: DefaultHandshake})
+
+	listeners := append([]Listener{{Ports: r.Ports}}, r.Listeners...)
+
+	var res []Port
+	used := make(map[string]bool)
+	for _, l := range listeners {
+		ports, err := utils.MakePortsFromSlice(l.Ports)
+		if err != nil {
+			return nil, err
+		}
+
+		p := Port{
+			Protocol:     strings.ToLower(protocol),
+			IdleTimeout:  time.Duration(idle) * time.Second,
+			MaxFrameSize: frame,
+			Limits:       l.Limits.merge(limits),
+			TLS:          l.TLS,
+		}
+		if l.Protocol != "" {
+			p.Protocol = strings.ToLower(l.Protocol)
+		}
+		if l.IdleTimeout != 0 {
+			p.IdleTimeout = time.Duration(l.IdleTimeout) * time.Second
+		}
+		if l.MaxFrameSize != 0 {
+			p.MaxFrameSize = l.MaxFrameSize
+		}
+
+		for _, v := range ports {
+			if used[v] {
+				return nil, fmt.Errorf("port %s is used twice", v)
+			}
+			used[v] = true
+			p.Port = v
+			res = append(res, p)
+		}
+	}
+	return res, nil
 }
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//EnvPrefix префикс переменных окружения, переопределяющих параметры файла
+const EnvPrefix = "GPS_"
+
+//envVars переменные окружения и параметры, которые они заменяют
+var envVars = []struct {
+	name string
+	set  func(c *Configuration, v string) error
+}{
+	{"SERVICE_NAME", func(c *Configuration, v string) error { c.ServiceName = v; return nil }},
+	{"PORTS", func(c *Configuration, v string) error { c.Ports = strings.Split(v, ","); return nil }},
+	{"PROTOCOL", func(c *Configuration, v string) error { c.Protocol = v; return nil }},
+	{"IDLE_TIMEOUT", func(c *Configuration, v string) error { return envInt(&c.IdleTimeout, v) }},
+	{"MAX_FRAME_SIZE", func(c *Configuration, v string) error { return envInt(&c.MaxFrameSize, v) }},
+	{"DRAIN_TIMEOUT", func(c *Configuration, v string) error { return envInt(&c.DrainTimeout, v) }},
+	{"MAX_CONNS", func(c *Configuration, v string) error { return envInt(&c.Limits.MaxConns, v) }},
+	{"MAX_CONNS_PER_IP", func(c *Configuration, v string) error { return envInt(&c.Limits.MaxConnsPerIP, v) }},
+	{"HANDSHAKE_TIMEOUT", func(c *Configuration, v string) error { return envInt(&c.Limits.HandshakeTimeout, v) }},
+	{"PATH_TO_SAVE", func(c *Configuration, v string) error { c.PathToSave = v; return nil }},
+	{"MIN_SATEL", func(c *Configuration, v string) error { return envInt(&c.MinSatel, v) }},
+	{"DEVICES_FILE", func(c *Configuration, v string) error { c.DevicesFile = v; return nil }},
+	{"API_ADDR", func(c *Configuration, v string) error { c.APIAddr = v; return nil }},
+	{"LOG_LEVEL", func(c *Configuration, v string) error { c.Log.Level = v; return nil }},
+	{"LOG_FORMAT", func(c *Configuration, v string) error { c.Log.Format = v; return nil }},
+	{"LOG_FILE", func(c *Configuration, v string) error { c.Log.File = v; return nil }},
+}
+
+func envInt(dst *int64, v string) error {
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+//applyEnv переопределяет параметры заданными переменными окружения GPS_*
+func applyEnv(c *Configuration) error {
+	for _, e := range envVars {
+		v, ok := os.LookupEnv(EnvPrefix + e.name)
+		if !ok {
+			continue
+		}
+		if err := e.set(c, v); err != nil {
+			return fmt.Errorf("env %s%s: %v", EnvPrefix, e.name, err)
+		}
+	}
+	return nil
+}
+
+//EnvNames имена поддерживаемых переменных окружения
+func EnvNames() []string {
+	var res []string
+	for _, e := range envVars {
+		res = append(res, EnvPrefix+e.name)
+	}
+	return res
+}
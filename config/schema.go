@@ -0,0 +1,8 @@
+package config
+
+import _ "embed"
+
+//Schema JSON Schema файла конфигурации
+//
+//go:embed schema.json
+var Schema []byte
@@ -0,0 +1,283 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"gps_clients/server_gps_service/clients"
+	"gps_clients/server_gps_service/logger"
+	"gps_clients/server_gps_service/utils"
+)
+
+//FieldError ошибка параметра с путем к нему, например listeners[0].protocol
+type FieldError struct {
+	Path string
+	Msg  string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Msg
+}
+
+//Errors все ошибки проверки конфигурации
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	var lines []string
+	for _, v := range e {
+		lines = append(lines, v.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+//Add добавляет ошибку параметра
+func (e *Errors) Add(path, format string, a ...interface{}) {
+	*e = append(*e, FieldError{Path: path, Msg: fmt.Sprintf(format, a...)})
+}
+
+//Err nil, если ошибок нет
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+//Validate проверка значений всех параметров
+func (r *Configuration) Validate() Errors {
+	var errs Errors
+
+	used := make(map[string]string)
+	checkPorts := func(p string, list []string) {
+		for i, v := range list {
+			ports, err := utils.MakePortsFromSlice([]string{v})
+			if err != nil {
+				errs.Add(fmt.Sprintf("%s[%d]", p, i), "bad port %q", v)
+				continue
+			}
+			for _, port := range ports {
+				n, _ := strconv.Atoi(port)
+				if n < 1 || n > 65535 {
+					errs.Add(fmt.Sprintf("%s[%d]", p, i), "port %s out of range 1-65535", port)
+					continue
+				}
+				if prev, ok := used[port]; ok {
+					errs.Add(fmt.Sprintf("%s[%d]", p, i), "port %s already used in %s", port, prev)
+					continue
+				}
+				used[port] = fmt.Sprintf("%s[%d]", p, i)
+			}
+		}
+	}
+	checkProtocol := func(p, protocol string) {
+		if protocol == "" {
+			return
+		}
+		if _, err := clients.New(protocol); err != nil {
+			errs.Add(p, "%v", err)
+		}
+	}
+	checkLimits := func(p string, idle, frame int64) {
+		if p != "" {
+			p += "."
+		}
+		if idle < 0 {
+			errs.Add(p+"idleTimeout", "must not be negative")
+		}
+		if frame < 0 || frame > 1<<20 {
+			errs.Add(p+"maxFrameSize", "must be between 0 and %d", 1<<20)
+		} else if frame > 0 && frame < 64 {
+			errs.Add(p+"maxFrameSize", "%d is too small, minimum 64", frame)
+		}
+	}
+
+	checkPorts("ports", r.Ports)
+	checkProtocol("protocol", r.Protocol)
+	checkLimits("", r.IdleTimeout, r.MaxFrameSize)
+	checkConnLimits(&errs, "limits", r.Limits)
+	checkNotNegative(&errs, "drainTimeout", r.DrainTimeout)
+	for i, l := range r.Listeners {
+		p := fmt.Sprintf("listeners[%d]", i)
+		if len(l.Ports) == 0 {
+			errs.Add(p+".ports", "empty list")
+		}
+		checkPorts(p+".ports", l.Ports)
+		checkProtocol(p+".protocol", l.Protocol)
+		checkLimits(p, l.IdleTimeout, l.MaxFrameSize)
+		checkConnLimits(&errs, p+".limits", l.Limits)
+		if l.TLS != nil {
+			checkTLS(&errs, p+".tls", *l.TLS)
+		}
+	}
+	if len(used) == 0 {
+		errs.Add("ports", "no ports to listen")
+	}
+
+	if r.MinSatel < 0 {
+		errs.Add("minSatel", "must not be negative")
+	}
+
+	if r.DevicesFile != "" {
+		if ok, err := utils.Exists(r.DevicesFile); err != nil {
+			errs.Add("devicesFile", "%v", err)
+		} else if !ok {
+			errs.Add("devicesFile", "file %s not found", r.DevicesFile)
+		}
+	}
+
+	if r.APIAddr != "" {
+		checkAddr(&errs, "apiAddr", r.APIAddr)
+	}
+
+	if _, err := logger.ParseLevel(r.Log.Level); err != nil {
+		errs.Add("log.level", "%v, want debug, info, warn or error", err)
+	}
+	switch strings.ToLower(r.Log.Format) {
+	case "", "text", "json":
+	default:
+		errs.Add("log.format", "unknown format %q, want text or json", r.Log.Format)
+	}
+	if r.Log.MaxSize < 0 {
+		errs.Add("log.maxSize", "must not be negative")
+	}
+	if r.Log.MaxAge < 0 {
+		errs.Add("log.maxAge", "must not be negative")
+	}
+	if r.Log.MaxBackups < 0 {
+		errs.Add("log.maxBackups", "must not be negative")
+	}
+
+	checkPatterns(&errs, "capture.ports", r.Capture.Ports)
+	checkPatterns(&errs, "capture.devices", r.Capture.Devices)
+
+	names := make(map[string]bool)
+	for i, v := range r.Retranslators {
+		p := fmt.Sprintf("retranslators[%d]", i)
+		checkName(&errs, p, v.Name, names)
+		checkAddr(&errs, p+".addr", v.Addr)
+		checkPatterns(&errs, p+".devices", v.Devices)
+		checkPatterns(&errs, p+".exclude", v.Exclude)
+		checkNotNegative(&errs, p+".timeout", v.Timeout)
+		checkNotNegative(&errs, p+".maxBackoff", v.MaxBackoff)
+		checkNotNegative(&errs, p+".maxQueue", int64(v.MaxQueue))
+		for name, id := range v.TerminalIDs {
+			if id == 0 {
+				errs.Add(p+".terminalIds."+name, "must not be 0")
+			}
+		}
+	}
+
+	names = make(map[string]bool)
+	for i, v := range r.Webhooks {
+		p := fmt.Sprintf("webhooks[%d]", i)
+		checkName(&errs, p, v.Name, names)
+		if u, err := url.Parse(v.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.Add(p+".url", "bad url %q, want http(s)://host/path", v.URL)
+		}
+		checkPatterns(&errs, p+".devices", v.Devices)
+		checkPatterns(&errs, p+".ports", v.Ports)
+		checkPatterns(&errs, p+".events", v.Events)
+		checkNotNegative(&errs, p+".timeout", v.Timeout)
+		checkNotNegative(&errs, p+".maxBackoff", v.MaxBackoff)
+		checkNotNegative(&errs, p+".maxQueue", int64(v.MaxQueue))
+		checkNotNegative(&errs, p+".batchSize", int64(v.BatchSize))
+		checkNotNegative(&errs, p+".batchWait", v.BatchWait)
+	}
+
+	names = make(map[string]bool)
+	for i, v := range r.MQTT {
+		p := fmt.Sprintf("mqtt[%d]", i)
+		checkName(&errs, p, v.Name, names)
+		checkAddr(&errs, p+".addr", v.Addr)
+		if v.QoS > 2 {
+			errs.Add(p+".qos", "%d out of range 0-2", v.QoS)
+		}
+		if strings.ContainsAny(v.Prefix, "+#") {
+			errs.Add(p+".prefix", "wildcards + and # are not allowed in topic")
+		}
+		checkPatterns(&errs, p+".devices", v.Devices)
+		checkNotNegative(&errs, p+".keepAlive", v.KeepAlive)
+	}
+
+	return errs
+}
+
+func checkName(errs *Errors, p, name string, names map[string]bool) {
+	switch {
+	case name == "":
+		errs.Add(p+".name", "empty name")
+	case names[name]:
+		errs.Add(p+".name", "duplicate name %q", name)
+	}
+	names[name] = true
+}
+
+func checkAddr(errs *Errors, p, addr string) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		errs.Add(p, "bad address %q, want host:port", addr)
+		return
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		errs.Add(p, "bad port in %q", addr)
+	}
+}
+
+func checkPatterns(errs *Errors, p string, list []string) {
+	for i, v := range list {
+		if _, err := path.Match(v, ""); err != nil {
+			errs.Add(fmt.Sprintf("%s[%d]", p, i), "bad pattern %q: %v", v, err)
+		}
+	}
+}
+
+func checkTLS(errs *Errors, p string, t TLS) {
+	checkFile := func(name, file string, need bool) {
+		if file == "" {
+			if need {
+				errs.Add(p+"."+name, "empty file name")
+			}
+			return
+		}
+		if ok, err := utils.Exists(file); err != nil {
+			errs.Add(p+"."+name, "%v", err)
+		} else if !ok {
+			errs.Add(p+"."+name, "file %s not found", file)
+		}
+	}
+	checkFile("certFile", t.CertFile, true)
+	checkFile("keyFile", t.KeyFile, true)
+
+	switch strings.ToLower(t.ClientAuth) {
+	case "":
+		checkFile("clientCa", t.ClientCA, false)
+		if t.MatchDevice {
+			errs.Add(p+".matchDevice", "needs clientAuth verify or require")
+		}
+	case "verify", "require":
+		checkFile("clientCa", t.ClientCA, true)
+	default:
+		errs.Add(p+".clientAuth", "unknown value %q, want verify or require", t.ClientAuth)
+	}
+}
+
+func checkConnLimits(errs *Errors, p string, l Limits) {
+	checkNotNegative(errs, p+".maxConns", l.MaxConns)
+	checkNotNegative(errs, p+".maxConnsPerIp", l.MaxConnsPerIP)
+	checkNotNegative(errs, p+".maxBytesPerSec", l.MaxBytesPerSec)
+	checkNotNegative(errs, p+".maxPacketsPerSec", l.MaxPacketsPerSec)
+	checkNotNegative(errs, p+".handshakeTimeout", l.HandshakeTimeout)
+	if l.MaxConns > 0 && l.MaxConnsPerIP > l.MaxConns {
+		errs.Add(p+".maxConnsPerIp", "%d is greater than maxConns %d", l.MaxConnsPerIP, l.MaxConns)
+	}
+}
+
+func checkNotNegative(errs *Errors, p string, v int64) {
+	if v < 0 {
+		errs.Add(p, "must not be negative")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gps_clients/server_gps_service/config"
+)
+
+//runConfig работа с файлом конфигурации: config validate [file] | config schema | config env
+func runConfig(args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: config validate [file] | config schema | config env")
+	}
+
+	switch args[0] {
+	case "validate":
+		file := configFile()
+		if len(args) > 1 {
+			file = args[1]
+		}
+		return validateFile(file)
+	case "schema":
+		_, err := os.Stdout.Write(config.Schema)
+		return err
+	case "env":
+		for _, v := range config.EnvNames() {
+			fmt.Println(v)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown config command %s", args[0])
+	}
+}
+
+//validateFile печать ошибок конфигурации или итоговых портов
+func validateFile(file string) error {
+	c, err := config.Load(file)
+	if err != nil {
+		return err
+	}
+
+	if err := validateConfig(c); err != nil {
+		if errs, ok := err.(config.Errors); ok {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", file, e)
+			}
+			return fmt.Errorf("%d errors", len(errs))
+		}
+		return err
+	}
+
+	ports, err := c.PortList()
+	if err != nil {
+		return err
+	}
+	for _, p := range ports {
+		fmt.Printf("port %s: %s, idle timeout %v, max frame %d bytes, handshake %ds\n",
+			p.Port, p.Protocol, p.IdleTimeout, p.MaxFrameSize, p.Limits.HandshakeTimeout)
+		if l := p.Limits; l.MaxConns > 0 || l.MaxConnsPerIP > 0 || l.MaxBytesPerSec > 0 || l.MaxPacketsPerSec > 0 {
+			fmt.Printf("  limits: conns %d, per ip %d, bytes/s %d, packets/s %d (0 - unlimited)\n",
+				l.MaxConns, l.MaxConnsPerIP, l.MaxBytesPerSec, l.MaxPacketsPerSec)
+		}
+	}
+	fmt.Printf("%s: ok\n", file)
+	return nil
+}
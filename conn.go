@@ -3,6 +3,10 @@ package main
 import (
 	"net"
 	"time"
+
+	"gps_clients/server_gps_service/capture"
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/logger"
 )
 
 type conn struct {
@@ -10,22 +14,117 @@ type conn struct {
 
 	IdleTimeout   time.Duration
 	MaxReadBuffer int64
+
+	capture *capture.Writer
+
+	state int32 //connIdle или connActive, читается при остановке сервера
+
+	ip string
+	//handshake срок передачи IMEI/логина, после входа устройства нулевой
+	handshake time.Time
+
+	//window начало текущей секунды, bytes и packets принятые в ней
+	window  time.Time
+	bytes   int64
+	packets int64
+
+	//clock источник времени ограничений и сроков, nil - time.Now; подменяется в тестах
+	clock func() time.Time
+}
+
+func (c *conn) now() time.Time {
+	if c.clock != nil {
+		return c.clock()
+	}
+	return time.Now()
 }
 
 func (c *conn) Close() (err error) {
 	err = c.Conn.Close()
+	if c.capture != nil {
+		c.capture.Close()
+	}
 	return
 }
 
 func (c *conn) UpdateDeadline() {
-	idleDeadline := time.Now().Add(c.IdleTimeout)
+	idleDeadline := c.now().Add(c.IdleTimeout)
+	if !c.handshake.IsZero() && c.handshake.Before(idleDeadline) {
+		idleDeadline = c.handshake
+	}
 	c.Conn.SetDeadline(idleDeadline)
 }
 
+//startHandshake срок, за который устройство должно войти; 0 - только IdleTimeout
+func (c *conn) startHandshake(d time.Duration) {
+	if d > 0 {
+		c.handshake = c.now().Add(d)
+	}
+	c.UpdateDeadline()
+}
+
+//endHandshake устройство вошло, дальше действует только IdleTimeout
+func (c *conn) endHandshake() {
+	c.handshake = time.Time{}
+	c.UpdateDeadline()
+}
+
+//throttle учет принятого пакета; при превышении ограничений за секунду
+//возвращает причину и время до конца секунды, на которое нужно приостановить чтение
+func (c *conn) throttle(n int, l config.Limits) (string, time.Duration) {
+	now := c.now()
+	if now.Sub(c.window) >= time.Second {
+		c.window = now
+		c.bytes = 0
+		c.packets = 0
+	}
+	c.bytes += int64(n)
+	c.packets++
+
+	var reason string
+	switch {
+	case l.MaxBytesPerSec > 0 && c.bytes > l.MaxBytesPerSec:
+		reason = limitBytes
+	case l.MaxPacketsPerSec > 0 && c.packets > l.MaxPacketsPerSec:
+		reason = limitPackets
+	default:
+		return "", 0
+	}
+
+	//пакет учитывается в следующей секунде, после ожидания
+	wait := c.window.Add(time.Second).Sub(now)
+	c.window = c.window.Add(time.Second)
+	c.bytes = int64(n)
+	c.packets = 1
+	return reason, wait
+}
+
 func (c *conn) Send(b []byte) error {
 	_, err := c.Conn.Write(b)
 	if err == nil {
 		c.UpdateDeadline()
+		c.captureFrame(capture.Out, b)
 	}
 	return err
 }
+
+//startCapture начинает запись кадров соединения в файл
+func (c *conn) startCapture(name string, h capture.Header) error {
+	w, err := capture.Create(name, h)
+	if err != nil {
+		return err
+	}
+	c.capture = w
+	return nil
+}
+
+func (c *conn) captureFrame(dir byte, b []byte) {
+	if c.capture == nil {
+		return
+	}
+	if err := c.capture.Write(dir, c.Conn.RemoteAddr().String(), b); err != nil {
+		logger.With(logger.Fields{Remote: c.Conn.RemoteAddr().String()}).Error("capture: %v", err)
+		c.capture.Close()
+		c.capture = nil
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/config"
+)
+
+//fakeClock время, которое двигает тест
+type fakeClock struct {
+	t time.Time
+}
+
+func (f *fakeClock) now() time.Time {
+	return f.t
+}
+
+//fakeConn запоминает последний срок соединения
+type fakeConn struct {
+	net.Conn
+	deadline time.Time
+}
+
+func (f *fakeConn) SetDeadline(t time.Time) error {
+	f.deadline = t
+	return nil
+}
+
+var t0 = time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+func TestThrottle(t *testing.T) {
+	type step struct {
+		at     time.Duration //от t0
+		n      int
+		reason string
+		wait   time.Duration
+	}
+	tests := []struct {
+		name   string
+		limits config.Limits
+		steps  []step
+	}{
+		{
+			name:  "no limits",
+			steps: []step{{0, 10000, "", 0}, {0, 10000, "", 0}, {time.Millisecond, 10000, "", 0}},
+		},
+		{
+			name:   "packets",
+			limits: config.Limits{MaxPacketsPerSec: 2},
+			steps: []step{
+				{0, 10, "", 0},
+				{100 * time.Millisecond, 10, "", 0},
+				{200 * time.Millisecond, 10, limitPackets, 800 * time.Millisecond},
+				//после паузы пакет учтен в следующей секунде
+				{time.Second, 10, "", 0},
+				{1100 * time.Millisecond, 10, limitPackets, 900 * time.Millisecond},
+				{3 * time.Second, 10, "", 0},
+			},
+		},
+		{
+			name:   "bytes",
+			limits: config.Limits{MaxBytesPerSec: 100},
+			steps: []step{
+				{0, 60, "", 0},
+				{500 * time.Millisecond, 50, limitBytes, 500 * time.Millisecond},
+				{time.Second, 40, "", 0},
+				{2 * time.Second, 100, "", 0},
+				{2 * time.Second, 1, limitBytes, time.Second},
+			},
+		},
+		{
+			name:   "bytes before packets",
+			limits: config.Limits{MaxBytesPerSec: 100, MaxPacketsPerSec: 1},
+			steps: []step{
+				{0, 10, "", 0},
+				{0, 100, limitBytes, time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		clock := &fakeClock{t: t0}
+		c := &conn{clock: clock.now}
+		for i, s := range tt.steps {
+			clock.t = t0.Add(s.at)
+			reason, wait := c.throttle(s.n, tt.limits)
+			if reason != s.reason || wait != s.wait {
+				t.Errorf("%s: step %d: %q %v, want %q %v", tt.name, i, reason, wait, s.reason, s.wait)
+			}
+		}
+	}
+}
+
+func TestConnLimits(t *testing.T) {
+	type step struct {
+		ip     string
+		del    int //>0 - закрыть соединение этого номера (с 1) вместо нового
+		reason string
+	}
+	tests := []struct {
+		name   string
+		limits config.Limits
+		steps  []step
+	}{
+		{
+			name:  "no limits",
+			steps: []step{{ip: "10.0.0.1"}, {ip: "10.0.0.1"}, {ip: "10.0.0.1"}},
+		},
+		{
+			name:   "per port",
+			limits: config.Limits{MaxConns: 2},
+			steps: []step{
+				{ip: "10.0.0.1"},
+				{ip: "10.0.0.2"},
+				{ip: "10.0.0.3", reason: limitConns},
+				{del: 1},
+				{ip: "10.0.0.3"},
+			},
+		},
+		{
+			name:   "per ip",
+			limits: config.Limits{MaxConnsPerIP: 1},
+			steps: []step{
+				{ip: "10.0.0.1"},
+				{ip: "10.0.0.1", reason: limitConnsIP},
+				{ip: "10.0.0.2"},
+				{del: 1},
+				{ip: "10.0.0.1"},
+			},
+		},
+		{
+			name:   "per port before per ip",
+			limits: config.Limits{MaxConns: 1, MaxConnsPerIP: 1},
+			steps: []step{
+				{ip: "10.0.0.1"},
+				{ip: "10.0.0.1", reason: limitConns},
+			},
+		},
+	}
+	for _, tt := range tests {
+		srv := &Server{limits: tt.limits}
+		var conns []*conn
+		for i, s := range tt.steps {
+			if s.del > 0 {
+				srv.deleteConn(conns[s.del-1])
+				continue
+			}
+			c := &conn{ip: s.ip}
+			conns = append(conns, c)
+			if reason := srv.addConn(c); reason != s.reason {
+				t.Errorf("%s: step %d: %q, want %q", tt.name, i, reason, s.reason)
+			}
+		}
+	}
+}
+
+func TestHandshakeDeadline(t *testing.T) {
+	tests := []struct {
+		name      string
+		idle      time.Duration
+		handshake time.Duration
+		want      time.Duration //срок до входа от t0
+		afterSend time.Duration //срок после ответа на t0+5s, до входа
+		afterEnd  time.Duration //срок после входа на t0+5s
+	}{
+		{"handshake", 180 * time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second, 185 * time.Second},
+		{"no handshake", 180 * time.Second, 0, 180 * time.Second, 185 * time.Second, 185 * time.Second},
+		{"handshake longer than idle", 3 * time.Second, 10 * time.Second, 3 * time.Second, 8 * time.Second, 8 * time.Second},
+	}
+	for _, tt := range tests {
+		clock := &fakeClock{t: t0}
+		fc := &fakeConn{}
+		c := &conn{Conn: fc, IdleTimeout: tt.idle, clock: clock.now}
+
+		c.startHandshake(tt.handshake)
+		if got := fc.deadline.Sub(t0); got != tt.want {
+			t.Errorf("%s: deadline %v, want %v", tt.name, got, tt.want)
+		}
+		clock.t = t0.Add(5 * time.Second)
+		c.UpdateDeadline()
+		if got := fc.deadline.Sub(t0); got != tt.afterSend {
+			t.Errorf("%s: deadline after send %v, want %v", tt.name, got, tt.afterSend)
+		}
+		c.endHandshake()
+		if got := fc.deadline.Sub(t0); got != tt.afterEnd {
+			t.Errorf("%s: deadline after login %v, want %v", tt.name, got, tt.afterEnd)
+		}
+	}
+}
+
+//TestHandshakeTimeout соединение без входа закрывается по сроку, вошедшее остается
+func TestHandshakeTimeout(t *testing.T) {
+	testEnv(t, "")
+	srv := &Server{Addr: "5000", Protocol: "wialon", limits: config.Limits{HandshakeTimeout: 1}}
+	addr := startServer(t, srv)
+
+	silent := dialDevice(t, addr)
+	d := dialDevice(t, addr)
+	d.login("dev039")
+
+	if !silent.closed(3 * time.Second) {
+		t.Fatal("connection without login not closed")
+	}
+	if d.closed(500 * time.Millisecond) {
+		t.Fatal("logged in connection closed")
+	}
+	if hits := srv.LimitHits(); hits[limitHandshake] != 1 {
+		t.Fatalf("limit hits %v", hits)
+	}
+}
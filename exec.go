@@ -1,41 +1,327 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/logger"
+	"gps_clients/server_gps_service/models"
+	"gps_clients/server_gps_service/mqtt"
+	"gps_clients/server_gps_service/registry"
+	"gps_clients/server_gps_service/retranslator"
+	"gps_clients/server_gps_service/session"
 	"gps_clients/server_gps_service/utils"
+	"gps_clients/server_gps_service/webhook"
 )
 
-var servers map[string]*Server
+var (
+	servers   map[string]*Server
+	serversMu sync.Mutex
+	reloadMu  sync.Mutex
+
+	//serveCtx отменяется при полной остановке службы
+	serveCtx, cancelServe = context.WithCancel(context.Background())
+	//serverErrors ошибки открытия портов и приема соединений
+	serverErrors = make(chan error, 16)
+
+	//errRestartRequired конфигурация изменена в параметрах, которые не применяются без перезапуска
+	errRestartRequired = errors.New("restart required to apply")
+)
+
+//sessions состояние устройств, общее для всех портов; сохраняется при паузе и перечитывании
+var sessions = session.NewManager()
+
+var (
+	devices       *registry.Registry
+	retranslators *retranslator.Manager
+	webhooks      *webhook.Manager
+	publishers    *mqtt.Manager
+)
+
+//initLogger настройка журнала из конфигурации, console - дублировать записи в stderr
+func initLogger(console bool) error {
+	c := config.Config.Log
+	if c.File == "" {
+		c.File = utils.GetProgramPath() + ".log"
+	}
+	return logger.Init(logger.Options{
+		Level:      c.Level,
+		Format:     c.Format,
+		File:       c.File,
+		MaxSize:    c.MaxSize,
+		MaxAge:     c.MaxAge,
+		MaxBackups: c.MaxBackups,
+		Daily:      c.Daily,
+		Console:    c.Console || console,
+		Debug:      c.Debug,
+	})
+}
+
+//validateConfig проверка всех параметров конфигурации
+func validateConfig(c config.Configuration) error {
+	errs := c.Validate()
+	for i, r := range c.Retranslators {
+		if err := retranslator.Check(r); err != nil {
+			errs.Add(fmt.Sprintf("retranslators[%d]", i), "%v", err)
+		}
+	}
+	return errs.Err()
+}
+
+func newServer(p config.Port) (*Server, error) {
+	srv := &Server{
+		Addr:         p.Port,
+		Protocol:     p.Protocol,
+		IdleTimeout:  p.IdleTimeout,
+		MaxReadBytes: p.MaxFrameSize,
+		limits:       p.Limits,
+	}
+	if p.TLS != nil {
+		certs, err := newCertStore(*p.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("port %s: %v", p.Port, err)
+		}
+		srv.tls = certs
+	}
+	return srv, nil
+}
 
 func initServer() {
 	servers = make(map[string]*Server)
 
-	ports, err := utils.MakePortsFromSlice(config.Config.Ports)
+	utils.ChkErrFatal(validateConfig(config.Config))
+	ports, err := config.Config.PortList()
 	utils.ChkErrFatal(err)
 
+	if config.Config.DevicesFile != "" {
+		devices, err = registry.Load(config.Config.DevicesFile)
+		utils.ChkErrFatal(err)
+	}
+
+	retranslators, err = retranslator.New(config.Config.Retranslators, config.Config.PathToSave, devices)
+	utils.ChkErrFatal(err)
+	models.AddSink(retranslators)
+
+	webhooks, err = webhook.New(config.Config.Webhooks, config.Config.PathToSave)
+	utils.ChkErrFatal(err)
+	models.AddSink(webhooks)
+
+	publishers, err = mqtt.New(config.Config.MQTT)
+	utils.ChkErrFatal(err)
+	models.AddSink(publishers)
+
 	for _, p := range ports {
-		srv := Server{
-			Addr:         p,
-			IdleTimeout:  180 * time.Second,
-			MaxReadBytes: 10240, //2048
+		srv, err := newServer(p)
+		utils.ChkErrFatal(err)
+		serve(srv)
+		servers[p.Port] = srv
+	}
+
+	startAPI(config.Config.APIAddr)
+}
+
+//serverList снимок запущенных серверов
+func serverList() []*Server {
+	defer serversMu.Unlock()
+	serversMu.Lock()
+	list := make([]*Server, 0, len(servers))
+	for _, s := range servers {
+		list = append(list, s)
+	}
+	return list
+}
+
+//serve запускает сервер порта; ошибка открытия порта или приема соединений передается в serverErrors
+func serve(srv *Server) {
+	go func() {
+		err := srv.ListenAndServe(serveCtx)
+		if err == nil || err == ErrServerClosed {
+			return
+		}
+		err = fmt.Errorf("port %s: %w", srv.Addr, err)
+		select {
+		case serverErrors <- err:
+		default:
+			logger.Error("%v", err)
 		}
+	}()
+}
 
-		go srv.ListenAndServe()
-		servers[p] = &srv
+//drainContext срок ожидания завершения соединений при остановке порта
+func drainContext() (context.Context, context.CancelFunc) {
+	d := time.Duration(config.Get().DrainTimeout) * time.Second
+	if d <= 0 {
+		d = config.DefaultDrainTimeout * time.Second
 	}
+	return context.WithTimeout(context.Background(), d)
 }
 
+//stopServers останавливает все порты одновременно, состояние устройств сохраняется
 func stopServers() {
-	for _, s := range servers {
-		s.Shutdown()
+	ctx, cancel := drainContext()
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, s := range serverList() {
+		wg.Add(1)
+		go func(s *Server) {
+			defer wg.Done()
+			s.Shutdown(ctx)
+		}(s)
 	}
+	wg.Wait()
 }
 
 func startServers() {
-	for _, s := range servers {
-		s.inShutdown = false
-		go s.ListenAndServe()
+	for _, s := range serverList() {
+		serve(s)
 	}
 }
+
+//shutdown полная остановка службы
+func shutdown() {
+	stopAPI()
+	stopServers()
+	cancelServe()
+	stopSinks()
+}
+
+func stopSinks() {
+	if retranslators != nil {
+		retranslators.Close()
+	}
+	if webhooks != nil {
+		webhooks.Close()
+	}
+	if publishers != nil {
+		publishers.Close()
+	}
+}
+
+func sameTLS(a, b *certStore) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.opts == b.opts
+}
+
+//restartKeys параметры конфигурации, которые применяются только при запуске службы:
+//приемники данных, журнал, API и реестр устройств создаются один раз
+func restartKeys(old, c config.Configuration) []string {
+	var keys []string
+	for _, v := range []struct {
+		name    string
+		changed bool
+	}{
+		{"serviceName", c.ServiceName != old.ServiceName},
+		{"descService", c.DescService != old.DescService},
+		{"devicesFile", c.DevicesFile != old.DevicesFile},
+		{"apiAddr", c.APIAddr != old.APIAddr},
+		{"log", !reflect.DeepEqual(c.Log, old.Log)},
+		{"retranslators", !reflect.DeepEqual(c.Retranslators, old.Retranslators)},
+		{"webhooks", !reflect.DeepEqual(c.Webhooks, old.Webhooks)},
+		{"mqtt", !reflect.DeepEqual(c.MQTT, old.MQTT)},
+	} {
+		if v.changed {
+			keys = append(keys, v.name)
+		}
+	}
+	return keys
+}
+
+//reload перечитывает конфигурацию и реестр устройств.
+//Новые порты запускаются, удаленные закрываются с ожиданием соединений,
+//соединения на неизмененных портах не прерываются.
+//Если изменены параметры из restartKeys, конфигурация не применяется совсем
+//и возвращается ошибка со списком этих параметров - нужен перезапуск службы.
+func reload() error {
+	defer reloadMu.Unlock()
+	reloadMu.Lock()
+
+	c, err := config.Load(configFile())
+	if err != nil {
+		return err
+	}
+
+	if err := validateConfig(c); err != nil {
+		return err
+	}
+	old := config.Get()
+	if keys := restartKeys(old, c); len(keys) > 0 {
+		return fmt.Errorf("%w: %s", errRestartRequired, strings.Join(keys, ", "))
+	}
+
+	list, err := c.PortList()
+	if err != nil {
+		return err
+	}
+	ports := make(map[string]*Server, len(list))
+	for _, p := range list {
+		srv, err := newServer(p)
+		if err != nil {
+			return err
+		}
+		ports[p.Port] = srv
+	}
+
+	if err := devices.Reload(); err != nil {
+		return err
+	}
+
+	config.Set(c)
+
+	defer serversMu.Unlock()
+	serversMu.Lock()
+
+	removed := make(map[string]*Server)
+	for p, s := range servers {
+		if srv, ok := ports[p]; ok && srv.Protocol == s.Protocol &&
+			srv.IdleTimeout == s.IdleTimeout && srv.MaxReadBytes == s.MaxReadBytes &&
+			sameTLS(srv.tls, s.tls) {
+			s.SetLimits(srv.Limits())
+			if s.tls != nil {
+				//сертификаты уже прочитаны в новом сервере, соединения порта не прерываются
+				s.tls.Set(srv.tls)
+			}
+			continue
+		}
+		removed[p] = s
+		delete(servers, p)
+	}
+
+	for p, srv := range ports {
+		if _, ok := servers[p]; ok {
+			continue
+		}
+		servers[p] = srv
+		if s, ok := removed[p]; ok {
+			//смена протокола: новый сервер слушает порт после закрытия прежнего
+			delete(removed, p)
+			go func(s, srv *Server) {
+				ctx, cancel := drainContext()
+				defer cancel()
+				s.Shutdown(ctx)
+				serve(srv)
+			}(s, srv)
+			continue
+		}
+		serve(srv)
+	}
+
+	for _, s := range removed {
+		go func(s *Server) {
+			ctx, cancel := drainContext()
+			defer cancel()
+			s.Shutdown(ctx)
+			s.log().Info("port removed")
+		}(s)
+	}
+
+	return nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/config"
+)
+
+const (
+	wialonLogin = "#L#%s;NA\r\n"
+	wialonPoint = "#D#180925;102030;5545.1234;N;03736.5678;E;10;90;150;8\r\n"
+)
+
+//freePort свободный TCP порт для ListenAndServe
+func freePort(t *testing.T) string {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+//useServers подменяет список портов службы на время теста
+func useServers(t *testing.T, list ...*Server) {
+	defer serversMu.Unlock()
+	serversMu.Lock()
+	old := servers
+	servers = make(map[string]*Server)
+	for _, s := range list {
+		servers[s.Addr] = s
+	}
+	t.Cleanup(func() {
+		stopServers()
+		defer serversMu.Unlock()
+		serversMu.Lock()
+		servers = old
+	})
+}
+
+//device соединение имитируемого устройства Wialon IPS
+type device struct {
+	t  *testing.T
+	c  net.Conn
+	rd *bufio.Reader
+}
+
+//dialDevice подключение к адресу; после запуска порт открывается не сразу
+func dialDevice(t *testing.T, addr string) *device {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c, err := net.Dial("tcp", addr)
+		if err == nil {
+			t.Cleanup(func() { c.Close() })
+			return &device{t: t, c: c, rd: bufio.NewReader(c)}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (d *device) send(s string) {
+	if _, err := d.c.Write([]byte(s)); err != nil {
+		d.t.Fatal(err)
+	}
+}
+
+//answer строки ответа сервера
+func (d *device) answer(lines int) string {
+	d.c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var sb strings.Builder
+	for i := 0; i < lines; i++ {
+		s, err := d.rd.ReadString('\n')
+		if err != nil {
+			d.t.Fatalf("answer %q: %v", sb.String(), err)
+		}
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+//closed true, если сервер закрыл соединение в течение wait
+func (d *device) closed(wait time.Duration) bool {
+	d.c.SetReadDeadline(time.Now().Add(wait))
+	_, err := d.rd.ReadByte()
+	return err != nil && !isTimeout(err)
+}
+
+//login вход и первая точка устройства отдельными пакетами
+func (d *device) login(name string) {
+	d.send(strings.Replace(wialonLogin, "%s", name, 1))
+	if a := d.answer(1); a != "#AL#1\r\n" {
+		d.t.Fatalf("login answer %q", a)
+	}
+	d.send(wialonPoint)
+	if a := d.answer(1); a != "#AD#1\r\n" {
+		d.t.Fatalf("point answer %q", a)
+	}
+}
+
+//TestPauseResume пауза закрывает порты и соединения, после возобновления состояние устройства прежнее
+func TestPauseResume(t *testing.T) {
+	testEnv(t, "")
+	srv := &Server{Addr: freePort(t), Protocol: "wialon", IdleTimeout: 5 * time.Second, MaxReadBytes: 1024}
+	useServers(t, srv)
+
+	startServers()
+	d := dialDevice(t, "127.0.0.1:"+srv.Addr)
+	d.login("dev037pause")
+
+	stopServers()
+	if !d.closed(time.Second) {
+		t.Fatal("connection not closed on pause")
+	}
+	if c, err := net.Dial("tcp", "127.0.0.1:"+srv.Addr); err == nil {
+		c.Close()
+		t.Fatal("port open on pause")
+	}
+
+	startServers()
+	list := srv.GetGPSList()
+	if len(list) != 1 || list[0].Name != "dev037pause" || list[0].GpsD.DateTime.IsZero() {
+		t.Fatalf("device state after resume %+v", list)
+	}
+
+	//та же точка после возобновления - повтор по индексу сессии
+	d = dialDevice(t, "127.0.0.1:"+srv.Addr)
+	d.login("dev037pause")
+	if accepted, rejected, _ := sink.counts("dev037pause"); accepted != 1 || rejected != 1 {
+		t.Fatalf("accepted %d, rejected %d after resume", accepted, rejected)
+	}
+}
+
+//busyDevice вошедшее устройство, второй пакет которого ждет освобождения сессии
+func busyDevice(t *testing.T, srv *Server, addr, name string) (*device, func()) {
+	d := dialDevice(t, addr)
+	d.login(name)
+
+	sess := sessions.Session(name)
+	sess.Lock()
+	d.send(strings.Replace(wialonPoint, "102030", "102031", 1))
+	//пакет принят и ждет сессию
+	deadline := time.Now().Add(5 * time.Second)
+	for !srv.busy() {
+		if time.Now().After(deadline) {
+			t.Fatal("packet not in progress")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return d, sess.Unlock
+}
+
+//busy есть соединение с пакетом в обработке
+func (srv *Server) busy() bool {
+	defer srv.mu.Unlock()
+	srv.mu.Lock()
+	for c := range srv.conns {
+		if atomic.LoadInt32(&c.state) == connActive {
+			return true
+		}
+	}
+	return false
+}
+
+//TestShutdownDrain соединение с пакетом в обработке закрывается после ответа, до срока
+func TestShutdownDrain(t *testing.T) {
+	testEnv(t, "")
+	srv := &Server{Addr: "5000", Protocol: "wialon"}
+	addr := startServer(t, srv)
+
+	d, unlock := busyDevice(t, srv, addr, "dev037drain")
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- srv.Shutdown(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	unlock()
+
+	if a := d.answer(1); a != "#AD#1\r\n" {
+		t.Fatalf("answer %q", a)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if !d.closed(time.Second) {
+		t.Fatal("connection not closed after answer")
+	}
+}
+
+//TestShutdownForceClose по истечении срока соединение закрывается без ответа
+func TestShutdownForceClose(t *testing.T) {
+	testEnv(t, "")
+	srv := &Server{Addr: "5000", Protocol: "wialon"}
+	addr := startServer(t, srv)
+
+	d, unlock := busyDevice(t, srv, addr, "dev037force")
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		done <- srv.Shutdown(ctx)
+	}()
+
+	if !d.closed(5 * time.Second) {
+		t.Fatal("connection not closed after drain deadline")
+	}
+	unlock()
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown: %v, want deadline exceeded", err)
+	}
+}
+
+//TestServeBindError ошибка открытия порта приходит в serverErrors
+func TestServeBindError(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	serve(&Server{Addr: port, Protocol: "wialon"})
+	select {
+	case err := <-serverErrors:
+		if !strings.Contains(err.Error(), "port "+port) {
+			t.Fatalf("error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no bind error")
+	}
+}
+
+//TestReloadRestartRequired конфигурация с измененными приемниками не применяется, ошибка называет параметры
+func TestReloadRestartRequired(t *testing.T) {
+	file := configFile()
+	write := func(body string) {
+		if err := ioutil.WriteFile(file, []byte(body), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { os.Remove(file) })
+	useServers(t)
+
+	ports := `"ports": ["` + freePort(t) + `"], "protocol": "wialon"`
+	write(`{` + ports + `, "minSatel": 3}`)
+	c, err := config.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := config.Get()
+	t.Cleanup(func() { config.Set(old) })
+	config.Set(c)
+
+	write(`{` + ports + `, "minSatel": 5, "apiAddr": "127.0.0.1:8080", "mqtt": [{"name": "m", "addr": "127.0.0.1:1883"}]}`)
+	err = reload()
+	if !errors.Is(err, errRestartRequired) || !strings.HasSuffix(err.Error(), ": apiAddr, mqtt") {
+		t.Fatalf("reload: %v", err)
+	}
+	if config.Get().MinSatel != 3 {
+		t.Fatalf("minSatel %d applied", config.Get().MinSatel)
+	}
+
+	write(`{` + ports + `, "minSatel": 5}`)
+	if err := reload(); err != nil {
+		t.Fatal(err)
+	}
+	if config.Get().MinSatel != 5 {
+		t.Fatalf("minSatel %d not applied", config.Get().MinSatel)
+	}
+}
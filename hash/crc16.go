@@ -44,3 +44,46 @@ func CheckSumCRC16(data []byte) uint16 {
 	}
 	return crc16
 }
+
+//CheckSumCRC16Modbus CRC-16/MODBUS: та же таблица, начальное значение 0xFFFF
+func CheckSumCRC16Modbus(data []byte) uint16 {
+	crc16 := uint16(0xFFFF)
+	for _, v := range data {
+		n := uint8(uint16(v) ^ crc16)
+		crc16 >>= 8
+		crc16 ^= MbTable[n]
+	}
+	return crc16
+}
+
+//CheckSumCRC16CCITT CRC-16/CCITT-FALSE: полином 0x1021, начальное 0xFFFF, без отражения (данные EGTS)
+func CheckSumCRC16CCITT(data []byte) uint16 {
+	crc16 := uint16(0xFFFF)
+	for _, v := range data {
+		crc16 ^= uint16(v) << 8
+		for i := 0; i < 8; i++ {
+			if crc16&0x8000 != 0 {
+				crc16 = crc16<<1 ^ 0x1021
+			} else {
+				crc16 <<= 1
+			}
+		}
+	}
+	return crc16
+}
+
+//CheckSumCRC16Kermit CRC-16/KERMIT: отраженный полином 0x8408, начальное 0 (Ruptela)
+func CheckSumCRC16Kermit(data []byte) uint16 {
+	var crc16 uint16
+	for _, v := range data {
+		crc16 ^= uint16(v)
+		for i := 0; i < 8; i++ {
+			if crc16&1 != 0 {
+				crc16 = crc16>>1 ^ 0x8408
+			} else {
+				crc16 >>= 1
+			}
+		}
+	}
+	return crc16
+}
@@ -0,0 +1,17 @@
+package hash
+
+//CheckSumCRC8 CRC-8: полином 0x31, начальное 0xFF, без отражения (Navtelecom FLEX, заголовок EGTS)
+func CheckSumCRC8(data []byte) byte {
+	crc := byte(0xFF)
+	for _, v := range data {
+		crc ^= v
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x31
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,17 @@
+package hash
+
+//CheckSumCRCITU CRC-ITU (CRC-16/X-25): полином 0x1021 (отраженный 0x8408), начальное 0xFFFF, инверсия результата
+func CheckSumCRCITU(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, v := range data {
+		crc ^= uint16(v)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return ^crc
+}
@@ -0,0 +1,53 @@
+package hash
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+//check - контрольное значение алгоритма для строки "123456789"
+const check = "123456789"
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCheckSum(t *testing.T) {
+	crc16 := func(f func([]byte) uint16) func([]byte) uint32 {
+		return func(b []byte) uint32 { return uint32(f(b)) }
+	}
+	tests := []struct {
+		name string
+		sum  func([]byte) uint32
+		data []byte
+		crc  uint32
+	}{
+		{"CRC-ITU", crc16(CheckSumCRCITU), []byte(check), 0x906E},
+		//пакеты из документации GT06: вход и heartbeat, от длины до серийного номера
+		{"CRC-ITU", crc16(CheckSumCRCITU), unhex(t, "0D0101234567890123450001"), 0x8CDD},
+		{"CRC-ITU", crc16(CheckSumCRCITU), unhex(t, "0A134004040001000F"), 0xDCEE},
+		//ответ на вход
+		{"CRC-ITU", crc16(CheckSumCRCITU), unhex(t, "05010001"), 0xD9DC},
+
+		//полином 0x31, начальное 0xFF, без отражения (Navtelecom FLEX, заголовок EGTS)
+		{"CRC-8", func(b []byte) uint32 { return uint32(CheckSumCRC8(b)) }, []byte(check), 0xF7},
+
+		{"CRC-16/ARC", crc16(CheckSumCRC16), []byte(check), 0xBB3D},
+		{"CRC-16/MODBUS", crc16(CheckSumCRC16Modbus), []byte(check), 0x4B37},
+		{"CRC-16/CCITT-FALSE", crc16(CheckSumCRC16CCITT), []byte(check), 0x29B1},
+		{"CRC-16/KERMIT", crc16(CheckSumCRC16Kermit), []byte(check), 0x2189},
+		//подтверждение Ruptela: команда 100, принято
+		{"CRC-16/KERMIT", crc16(CheckSumCRC16Kermit), unhex(t, "6401"), 0x13BC},
+		//запрос Modbus RTU, на линии младшим байтом вперед: A4 08
+		{"CRC-16/MODBUS", crc16(CheckSumCRC16Modbus), unhex(t, "0103000A0001"), 0x08A4},
+	}
+	for _, tt := range tests {
+		if crc := tt.sum(tt.data); crc != tt.crc {
+			t.Errorf("%s %x: crc %04x, want %04x", tt.name, tt.data, crc, tt.crc)
+		}
+	}
+}
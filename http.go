@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gps_clients/server_gps_service/capture"
+	"gps_clients/server_gps_service/clients"
+	"gps_clients/server_gps_service/logger"
+	"gps_clients/server_gps_service/utils"
+)
+
+//httpAllow методы HTTP-порта; HEAD и OPTIONS - проверка доступности, без данных
+const httpAllow = "GET, POST, HEAD, OPTIONS"
+
+//httpPort протокол порта принимается HTTP-сервером
+func httpPort(protocol string) bool {
+	p, err := clients.New(protocol)
+	if err != nil {
+		return false
+	}
+	_, ok := p.(clients.HTTPParser)
+	return ok
+}
+
+//httpListener прием соединений HTTP-порта с ограничениями и учетом как у TCP
+type httpListener struct {
+	net.Listener
+	srv *Server
+}
+
+func (ln httpListener) Accept() (net.Conn, error) {
+	for {
+		newConn, err := ln.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		c := &conn{
+			Conn:          newConn,
+			IdleTimeout:   ln.srv.IdleTimeout,
+			MaxReadBuffer: ln.srv.MaxReadBytes,
+			ip:            utils.GetIPAdr(newConn.RemoteAddr().String()),
+		}
+		if reason := ln.srv.addConn(c); reason != "" {
+			ln.srv.limitHit(reason, ln.srv.log().With(logger.Fields{Remote: newConn.RemoteAddr().String()}))
+			newConn.Close()
+			continue
+		}
+		return c, nil
+	}
+}
+
+//httpErrorLog ошибки net/http в журнал порта
+type httpErrorLog struct {
+	log logger.Entry
+}
+
+func (w httpErrorLog) Write(p []byte) (int, error) {
+	w.log.Error("%s", strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+//linkKey ключ соединения устройства в контексте запроса
+type linkKey struct{}
+
+//serveHTTP порт протокола поверх HTTP: соединения и запросы обслуживает net/http,
+//каждый запрос разбирается и сохраняется как пакет TCP (packet)
+func (srv *Server) serveHTTP(ctx context.Context, listen net.Listener) error {
+	srv.log().Info("http client run")
+
+	var links sync.Map
+	hs := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			srv.serveRequest(r.Context().Value(linkKey{}).(*link), w, r)
+		}),
+		ReadHeaderTimeout: time.Duration(srv.Limits().HandshakeTimeout) * time.Second,
+		ReadTimeout:       srv.IdleTimeout,
+		WriteTimeout:      srv.IdleTimeout,
+		IdleTimeout:       srv.IdleTimeout,
+		ErrorLog:          log.New(httpErrorLog{srv.log()}, "", 0),
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			//протокол проверен при запуске порта
+			l, _ := srv.newLink(c.(*conn))
+			links.Store(c, l)
+			return context.WithValue(ctx, linkKey{}, l)
+		},
+		ConnState: func(c net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateActive:
+				atomic.StoreInt32(&c.(*conn).state, connActive)
+			case http.StateIdle:
+				atomic.StoreInt32(&c.(*conn).state, connIdle)
+			case http.StateClosed, http.StateHijacked:
+				if l, ok := links.LoadAndDelete(c); ok {
+					srv.closeLink(l.(*link))
+				}
+			}
+		},
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&srv.inShutdown, 1)
+			listen.Close()
+		case <-done:
+		}
+	}()
+
+	//соединения закрывает Shutdown сервера порта, как и для TCP
+	err := hs.Serve(httpListener{Listener: listen, srv: srv})
+	if srv.shuttingDown() {
+		return ErrServerClosed
+	}
+	srv.log().Error("error listen: %v", err)
+	return err
+}
+
+//serveRequest запрос HTTP-порта: разбор и сохранение через packet, ответ кодом HTTP
+func (srv *Server) serveRequest(l *link, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodPost:
+	case http.MethodHead, http.MethodOptions:
+		w.Header().Set("Allow", httpAllow)
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		w.Header().Set("Allow", httpAllow)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	//тело читается целиком: 100-continue и chunked обрабатывает net/http
+	r.Body = http.MaxBytesReader(w, r.Body, srv.MaxReadBytes)
+	input, err := httputil.DumpRequest(r, true)
+	if err != nil {
+		l.log.Error("bad request body: %v", err)
+		code := http.StatusBadRequest
+		//ошибка MaxBytesReader без отдельного типа до go 1.19
+		if strings.Contains(err.Error(), "request body too large") {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	if reason, wait := l.conn.throttle(len(input), srv.Limits()); wait > 0 {
+		srv.limitHit(reason, l.log.With(logger.Fields{Device: l.name}))
+		time.Sleep(wait)
+	}
+	l.conn.captureFrame(capture.In, input)
+
+	l.parser.(clients.HTTPParser).SetRequest(r)
+	err = srv.packet(l, input)
+	switch {
+	case l.check.rejected != nil:
+		l.conn.captureFrame(capture.Out, GetBadPacketByte(l.parser))
+		w.Header().Set("Connection", "close")
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	case err != nil:
+		l.conn.captureFrame(capture.Out, GetBadPacketByte(l.parser))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	default:
+		l.conn.captureFrame(capture.Out, l.gps.GPS.CountData)
+		w.WriteHeader(http.StatusOK)
+	}
+}
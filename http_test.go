@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/models"
+)
+
+//osmandQuery параметры точки OsmAnd устройства id, время 18.09.2025 10:20:30 UTC + sec
+func osmandQuery(id string, sec int) string {
+	return url.Values{
+		"id":        {id},
+		"lat":       {"55.752"},
+		"lon":       {"37.6175"},
+		"timestamp": {fmt.Sprint(1758190830 + sec)},
+		"speed":     {"10"},
+	}.Encode()
+}
+
+//chunked тело частями по size байт
+func chunked(body string, size int) string {
+	var s string
+	for len(body) > size {
+		s += fmt.Sprintf("%x\r\n%s\r\n", size, body[:size])
+		body = body[size:]
+	}
+	return s + fmt.Sprintf("%x\r\n%s\r\n0\r\n\r\n", len(body), body)
+}
+
+//httpConn соединение с HTTP-портом, ответы читаются по методам отправленных запросов
+type httpConn struct {
+	t *testing.T
+	net.Conn
+	rd *bufio.Reader
+}
+
+func dialHTTP(t *testing.T, addr string) *httpConn {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+	return &httpConn{t: t, Conn: c, rd: bufio.NewReader(c)}
+}
+
+func (c *httpConn) send(raw string) {
+	if _, err := c.Write([]byte(raw)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *httpConn) response(method string) *http.Response {
+	resp, err := http.ReadResponse(c.rd, &http.Request{Method: method})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+//TestHTTPPort запросы OsmAnd разбираются HTTP-сервером порта и сохраняются как пакеты TCP
+func TestHTTPPort(t *testing.T) {
+	dir := testEnv(t, "")
+	addr := startServer(t, &Server{Addr: "5000", Protocol: "osmand"})
+
+	const json = `{"device_id":"dev048d","location":{"timestamp":"2025-09-18T10:20:30Z","coords":{"latitude":55.752,"longitude":37.6175}}}`
+	large := osmandQuery("dev048f", 0) + "&x=" + strings.Repeat("0", 2000)
+	tests := []struct {
+		name    string
+		raw     string
+		methods []string
+		codes   []int
+		id      string
+		saved   int
+	}{
+		{
+			name:    "get",
+			raw:     "GET /?" + osmandQuery("dev048a", 0) + " HTTP/1.1\r\nHost: gps\r\n\r\n",
+			methods: []string{"GET"},
+			codes:   []int{200},
+			id:      "dev048a",
+			saved:   1,
+		},
+		{
+			//две точки одной записью, ответы по порядку
+			name: "pipelining",
+			raw: "GET /?" + osmandQuery("dev048b", 0) + " HTTP/1.1\r\nHost: gps\r\n\r\n" +
+				"GET /?" + osmandQuery("dev048b", 10) + " HTTP/1.1\r\nHost: gps\r\n\r\n",
+			methods: []string{"GET", "GET"},
+			codes:   []int{200, 200},
+			id:      "dev048b",
+			saved:   2,
+		},
+		{
+			name: "post chunked",
+			raw: "POST / HTTP/1.1\r\nHost: gps\r\nContent-Type: application/x-www-form-urlencoded\r\n" +
+				"Transfer-Encoding: chunked\r\n\r\n" + chunked(osmandQuery("dev048c", 0), 16),
+			methods: []string{"POST"},
+			codes:   []int{200},
+			id:      "dev048c",
+			saved:   1,
+		},
+		{
+			name: "post json",
+			raw: "POST / HTTP/1.1\r\nHost: gps\r\nContent-Type: application/json\r\n" +
+				fmt.Sprintf("Content-Length: %d\r\n\r\n", len(json)) + json,
+			methods: []string{"POST"},
+			codes:   []int{200},
+			id:      "dev048d",
+			saved:   1,
+		},
+		{
+			name:    "bad request",
+			raw:     "GET /?id=dev048e&lat=x&lon=37.6 HTTP/1.1\r\nHost: gps\r\n\r\n",
+			methods: []string{"GET"},
+			codes:   []int{400},
+			id:      "dev048e",
+		},
+		{
+			//больше MaxReadBytes
+			name: "body too large",
+			raw: "POST / HTTP/1.1\r\nHost: gps\r\nContent-Type: application/x-www-form-urlencoded\r\n" +
+				fmt.Sprintf("Content-Length: %d\r\n\r\n", len(large)) + large,
+			methods: []string{"POST"},
+			codes:   []int{413},
+			id:      "dev048f",
+		},
+		{
+			//проверка доступности и неподдерживаемый метод - без разбора
+			name:    "head options put",
+			raw:     "HEAD / HTTP/1.1\r\nHost: gps\r\n\r\nOPTIONS / HTTP/1.1\r\nHost: gps\r\n\r\nPUT / HTTP/1.1\r\nHost: gps\r\nContent-Length: 0\r\n\r\n",
+			methods: []string{"HEAD", "OPTIONS", "PUT"},
+			codes:   []int{200, 200, 405},
+		},
+	}
+	for _, tt := range tests {
+		c := dialHTTP(t, addr)
+		c.send(tt.raw)
+		for i, method := range tt.methods {
+			resp := c.response(method)
+			if resp.StatusCode != tt.codes[i] {
+				t.Errorf("%s: %s status %d, want %d", tt.name, method, resp.StatusCode, tt.codes[i])
+			}
+			if tt.id == "" && resp.Header.Get("Allow") != httpAllow {
+				t.Errorf("%s: %s allow %q", tt.name, method, resp.Header.Get("Allow"))
+			}
+		}
+		if tt.id == "" {
+			continue
+		}
+		if accepted, _, _ := sink.counts(tt.id); accepted != tt.saved {
+			t.Errorf("%s: accepted %d, want %d", tt.name, accepted, tt.saved)
+		}
+	}
+	if files := savedFiles(t, dir); len(files) != 4 {
+		t.Fatalf("saved %v", files)
+	}
+}
+
+//TestHTTPExpectContinue тело отправляется после 100 Continue
+func TestHTTPExpectContinue(t *testing.T) {
+	testEnv(t, "")
+	addr := startServer(t, &Server{Addr: "5000", Protocol: "osmand"})
+
+	body := osmandQuery("dev048g", 0)
+	c := dialHTTP(t, addr)
+	c.send("POST / HTTP/1.1\r\nHost: gps\r\nContent-Type: application/x-www-form-urlencoded\r\n" +
+		fmt.Sprintf("Expect: 100-continue\r\nContent-Length: %d\r\n\r\n", len(body)))
+	if resp := c.response("POST"); resp.StatusCode != http.StatusContinue {
+		t.Fatalf("status %d, want 100", resp.StatusCode)
+	}
+	c.send(body)
+	if resp := c.response("POST"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if accepted, _, _ := sink.counts("dev048g"); accepted != 1 {
+		t.Fatalf("accepted %d", accepted)
+	}
+}
+
+//TestHTTPUnknownDevice устройство не из реестра получает 403, соединение закрывается, данные не сохраняются
+func TestHTTPUnknownDevice(t *testing.T) {
+	dir := testEnv(t, `[{"id": "123456789012345"}]`)
+	addr := startServer(t, &Server{Addr: "5000", Protocol: "osmand"})
+
+	c := dialHTTP(t, addr)
+	c.send("GET /?" + osmandQuery("dev048h", 0) + " HTTP/1.1\r\nHost: gps\r\n\r\n")
+	if resp := c.response("GET"); resp.StatusCode != http.StatusForbidden || !resp.Close {
+		t.Fatalf("status %d, close %v", resp.StatusCode, resp.Close)
+	}
+	if _, err := c.rd.ReadByte(); err == nil {
+		t.Fatal("connection not closed")
+	}
+	if files := savedFiles(t, dir); len(files) != 0 {
+		t.Fatalf("saved %v", files)
+	}
+	accepted, rejected, events := sink.counts("dev048h")
+	if accepted != 0 || rejected != 0 || len(events) != 1 || events[0] != models.EventUnknown {
+		t.Fatalf("sink: accepted %d, rejected %d, events %v", accepted, rejected, events)
+	}
+}
@@ -0,0 +1,95 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"text/template"
+
+	"gps_clients/server_gps_service/utils"
+)
+
+const unitDir = "/etc/systemd/system"
+
+var unitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description={{.Desc}}
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{.Exe}} run
+ExecReload=/bin/kill -HUP $MAINPID
+WorkingDirectory={{.Dir}}
+Restart=on-failure
+RestartSec=5
+WatchdogSec=30
+LimitNOFILE=65536
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+func unitPath(name string) string {
+	return filepath.Join(unitDir, name+".service")
+}
+
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %v: %v: %s", args, err, out)
+	}
+	return nil
+}
+
+func installService(name, fullname, desc string) error {
+	exepath, err := exePath()
+	if err != nil {
+		return err
+	}
+
+	path := unitPath(name)
+	if ok, _ := utils.Exists(path); ok {
+		return fmt.Errorf("service %s already exists", name)
+	}
+
+	if desc == "" {
+		desc = fullname
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	err = unitTemplate.Execute(f, struct {
+		Desc, Exe, Dir string
+	}{desc, exepath, filepath.Dir(exepath)})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", name)
+}
+
+func removeService(name string) error {
+	path := unitPath(name)
+	if ok, _ := utils.Exists(path); !ok {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	systemctl("disable", "--now", name)
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return systemctl("daemon-reload")
+}
@@ -0,0 +1,332 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Level уровень записи журнала
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+//ParseLevel уровень по имени, пустое имя - info
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %s", s)
+	}
+}
+
+//Fields поля записи журнала
+type Fields struct {
+	Port     string
+	Remote   string
+	Device   string
+	Protocol string
+	Len      int
+}
+
+func (f Fields) merge(o Fields) Fields {
+	if o.Port != "" {
+		f.Port = o.Port
+	}
+	if o.Remote != "" {
+		f.Remote = o.Remote
+	}
+	if o.Device != "" {
+		f.Device = o.Device
+	}
+	if o.Protocol != "" {
+		f.Protocol = o.Protocol
+	}
+	if o.Len != 0 {
+		f.Len = o.Len
+	}
+	return f
+}
+
+//EventLog внешний журнал событий (event log Windows), получает записи warn и error
+type EventLog interface {
+	Info(eid uint32, msg string) error
+	Warning(eid uint32, msg string) error
+	Error(eid uint32, msg string) error
+}
+
+//Options параметры журнала
+type Options struct {
+	Level      string
+	Format     string
+	File       string
+	MaxSize    int64
+	MaxAge     int
+	MaxBackups int
+	Daily      bool
+	Console    bool
+	Debug      []string
+}
+
+type logger struct {
+	mu      sync.Mutex
+	level   Level
+	json    bool
+	console bool
+	journal bool
+	file    *rotateWriter
+	elog    EventLog
+	debug   map[string]bool
+}
+
+var std = &logger{
+	level:   LevelInfo,
+	console: true,
+	journal: os.Getenv("JOURNAL_STREAM") != "",
+	debug:   make(map[string]bool),
+}
+
+//Init настраивает журнал, до вызова записи выводятся в stderr
+func Init(opt Options) error {
+	level, err := ParseLevel(opt.Level)
+	if err != nil {
+		return err
+	}
+
+	var isJSON bool
+	switch strings.ToLower(opt.Format) {
+	case "", "text":
+	case "json":
+		isJSON = true
+	default:
+		return fmt.Errorf("unknown log format %s", opt.Format)
+	}
+
+	var file *rotateWriter
+	if opt.File != "" {
+		file, err = newRotateWriter(opt.File, opt.MaxSize*1024*1024, opt.MaxAge, opt.MaxBackups, opt.Daily)
+		if err != nil {
+			return err
+		}
+	}
+
+	defer std.mu.Unlock()
+	std.mu.Lock()
+	if std.file != nil {
+		std.file.Close()
+	}
+	std.level = level
+	std.json = isJSON
+	std.console = opt.Console || file == nil
+	std.file = file
+	std.debug = make(map[string]bool)
+	for _, v := range opt.Debug {
+		std.debug[v] = true
+	}
+	return nil
+}
+
+//SetEventLog подключает внешний журнал событий
+func SetEventLog(e EventLog) {
+	defer std.mu.Unlock()
+	std.mu.Lock()
+	std.elog = e
+}
+
+//Close закрывает файл журнала
+func Close() error {
+	defer std.mu.Unlock()
+	std.mu.Lock()
+	if std.file == nil {
+		return nil
+	}
+	err := std.file.Close()
+	std.file = nil
+	std.console = true
+	return err
+}
+
+//SetDeviceDebug включает/выключает отладочные записи для устройства
+func SetDeviceDebug(device string, on bool) {
+	defer std.mu.Unlock()
+	std.mu.Lock()
+	if on {
+		std.debug[device] = true
+	} else {
+		delete(std.debug, device)
+	}
+}
+
+//DeviceDebug список устройств с включенной отладкой
+func DeviceDebug() []string {
+	defer std.mu.Unlock()
+	std.mu.Lock()
+	res := make([]string, 0, len(std.debug))
+	for k := range std.debug {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (l *logger) enabled(level Level, f Fields) bool {
+	defer l.mu.Unlock()
+	l.mu.Lock()
+	return level >= l.level || (f.Device != "" && l.debug[f.Device])
+}
+
+func (l *logger) formatText(t time.Time, level Level, msg string, f Fields) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %-5s %s", t.Format("02.01.2006 15:04:05"), strings.ToUpper(level.String()), msg)
+	if f.Port != "" {
+		fmt.Fprintf(&sb, " port=%s", f.Port)
+	}
+	if f.Remote != "" {
+		fmt.Fprintf(&sb, " remote=%s", f.Remote)
+	}
+	if f.Device != "" {
+		fmt.Fprintf(&sb, " device=%q", f.Device)
+	}
+	if f.Protocol != "" {
+		fmt.Fprintf(&sb, " protocol=%s", f.Protocol)
+	}
+	if f.Len != 0 {
+		fmt.Fprintf(&sb, " len=%d", f.Len)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+type jsonEntry struct {
+	Time     string `json:"time"`
+	Level    string `json:"level"`
+	Msg      string `json:"msg"`
+	Port     string `json:"port,omitempty"`
+	Remote   string `json:"remote,omitempty"`
+	Device   string `json:"device,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	Len      int    `json:"len,omitempty"`
+}
+
+func (l *logger) formatJSON(t time.Time, level Level, msg string, f Fields) string {
+	body, err := json.Marshal(jsonEntry{
+		Time:     t.Format(time.RFC3339Nano),
+		Level:    level.String(),
+		Msg:      msg,
+		Port:     f.Port,
+		Remote:   f.Remote,
+		Device:   f.Device,
+		Protocol: f.Protocol,
+		Len:      f.Len,
+	})
+	if err != nil {
+		return l.formatText(t, level, msg, f)
+	}
+	return string(body) + "\n"
+}
+
+func (l *logger) write(level Level, msg string, f Fields) {
+	t := time.Now().Local()
+
+	defer l.mu.Unlock()
+	l.mu.Lock()
+
+	var line string
+	if l.json {
+		line = l.formatJSON(t, level, msg, f)
+	} else {
+		line = l.formatText(t, level, msg, f)
+	}
+
+	if l.file != nil {
+		if _, err := io.WriteString(l.file, line); err != nil {
+			fmt.Fprintf(os.Stderr, "log: %v\n", err)
+		}
+	}
+
+	if l.console {
+		if l.journal {
+			//приоритет syslog для journald
+			priority := map[Level]int{LevelDebug: 7, LevelInfo: 6, LevelWarn: 4, LevelError: 3}[level]
+			fmt.Fprintf(os.Stderr, "<%d>%s", priority, line)
+		} else {
+			io.WriteString(os.Stderr, line)
+		}
+	}
+
+	if l.elog != nil {
+		switch level {
+		case LevelWarn:
+			l.elog.Warning(1, strings.TrimSpace(line))
+		case LevelError:
+			l.elog.Error(1, strings.TrimSpace(line))
+		}
+	}
+}
+
+//Entry журнал с заданными полями
+type Entry struct {
+	fields Fields
+}
+
+//With журнал с полями
+func With(f Fields) Entry {
+	return Entry{fields: f}
+}
+
+//With добавляет поля
+func (e Entry) With(f Fields) Entry {
+	return Entry{fields: e.fields.merge(f)}
+}
+
+//Enabled будет ли записана запись уровня level (для дорогих отладочных данных)
+func (e Entry) Enabled(level Level) bool {
+	return std.enabled(level, e.fields)
+}
+
+func (e Entry) log(level Level, format string, a ...interface{}) {
+	if !std.enabled(level, e.fields) {
+		return
+	}
+	std.write(level, strings.TrimRight(fmt.Sprintf(format, a...), "\r\n"), e.fields)
+}
+
+func (e Entry) Debug(format string, a ...interface{}) { e.log(LevelDebug, format, a...) }
+func (e Entry) Info(format string, a ...interface{})  { e.log(LevelInfo, format, a...) }
+func (e Entry) Warn(format string, a ...interface{})  { e.log(LevelWarn, format, a...) }
+func (e Entry) Error(format string, a ...interface{}) { e.log(LevelError, format, a...) }
+
+func Debug(format string, a ...interface{}) { Entry{}.log(LevelDebug, format, a...) }
+func Info(format string, a ...interface{})  { Entry{}.log(LevelInfo, format, a...) }
+func Warn(format string, a ...interface{})  { Entry{}.log(LevelWarn, format, a...) }
+func Error(format string, a ...interface{}) { Entry{}.log(LevelError, format, a...) }
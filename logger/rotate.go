@@ -0,0 +1,154 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const backupTimeFormat = "20060102-150405.000"
+
+//rotateWriter файл журнала с ротацией по размеру и/или по суткам
+//и удалением старых файлов по возрасту и количеству
+type rotateWriter struct {
+	name       string
+	maxSize    int64
+	maxAge     int
+	maxBackups int
+	daily      bool
+
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func newRotateWriter(name string, maxSize int64, maxAge, maxBackups int, daily bool) (*rotateWriter, error) {
+	w := &rotateWriter{
+		name:       name,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		daily:      daily,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.name), 0777); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = fi.Size()
+	w.opened = fi.ModTime()
+	if w.size == 0 {
+		w.opened = time.Now()
+	}
+	return nil
+}
+
+func (w *rotateWriter) needRotate(n int) bool {
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(n) > w.maxSize {
+		return true
+	}
+	if w.daily && w.size > 0 {
+		y1, m1, d1 := w.opened.Date()
+		y2, m2, d2 := time.Now().Date()
+		return y1 != y2 || m1 != m2 || d1 != d2
+	}
+	return false
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.needRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotateWriter) backupName(t time.Time) string {
+	ext := filepath.Ext(w.name)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(w.name, ext), t.Format(backupTimeFormat), ext)
+}
+
+func (w *rotateWriter) rotate() error {
+	w.file.Close()
+	w.file = nil
+
+	backup := w.backupName(time.Now())
+	if err := os.Rename(w.name, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.cleanup()
+	return nil
+}
+
+//cleanup удаляет старые файлы журнала
+func (w *rotateWriter) cleanup() {
+	if w.maxAge <= 0 && w.maxBackups <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(w.name)
+	pattern := strings.TrimSuffix(w.name, ext) + "-*" + ext
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		name string
+		t    time.Time
+	}
+	var list []backup
+	prefix := strings.TrimSuffix(filepath.Base(w.name), ext) + "-"
+	for _, f := range files {
+		ts := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), prefix), ext)
+		t, err := time.ParseInLocation(backupTimeFormat, ts, time.Local)
+		if err != nil {
+			continue
+		}
+		list = append(list, backup{name: f, t: t})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].t.After(list[j].t) })
+
+	for i, b := range list {
+		if (w.maxBackups > 0 && i >= w.maxBackups) ||
+			(w.maxAge > 0 && time.Since(b.t) > time.Duration(w.maxAge)*24*time.Hour) {
+			os.Remove(b.name)
+		}
+	}
+}
+
+func (w *rotateWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
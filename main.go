@@ -8,22 +8,37 @@ import (
 
 	"gps_clients/server_gps_service/config"
 	"gps_clients/server_gps_service/utils"
-
-	"golang.org/x/sys/windows/svc"
 )
 
+//toolList команды, доступные на всех платформах
+const toolList = "config, replay, simulate"
+
 func usage(errmsg string) {
 	fmt.Fprintf(os.Stderr,
 		"%s\n\n"+
 			"usage: %s <command>\n"+
 			"       where <command> is one of\n"+
-			"       install, remove, debug, start, stop, pause or resume.\n",
-		errmsg, os.Args[0])
+			"       %s,\n"+
+			"       or one of the tools: %s.\n",
+		errmsg, os.Args[0], commandList, toolList)
 	os.Exit(2)
 }
 
+//configFile файл конфигурации рядом с программой
+func configFile() string {
+	return utils.GetProgramPath() + ".json"
+}
+
 func main() {
-	if err := config.ReadConfig(utils.GetProgramPath() + ".json"); err != nil {
+	//проверка конфигурации работает и с файлом, который не читается
+	if len(os.Args) > 1 && strings.ToLower(os.Args[1]) == "config" {
+		if err := runConfig(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := config.ReadConfig(configFile()); err != nil {
 		log.Fatal(err)
 	}
 
@@ -35,7 +50,7 @@ func main() {
 	nameInstallService := strings.ReplaceAll(svcName, "_", " ")
 	descInstallService := config.Config.DescService
 
-	inService, err := svc.IsWindowsService()
+	inService, err := isService()
 	if err != nil {
 		log.Fatalf("failed to determine if we are running in service: %v", err)
 	}
@@ -51,23 +66,12 @@ func main() {
 
 	cmd := strings.ToLower(os.Args[1])
 	switch cmd {
-	case "debug":
-		runService(svcName, true)
-		return
-	case "install":
-		err = installService(svcName, nameInstallService, descInstallService)
-	case "remove":
-		err = removeService(svcName)
-	case "start":
-		err = startService(svcName)
-	case "stop":
-		err = controlService(svcName, svc.Stop, svc.Stopped)
-	case "pause":
-		err = controlService(svcName, svc.Pause, svc.Paused)
-	case "resume":
-		err = controlService(svcName, svc.Continue, svc.Running)
+	case "replay":
+		err = runReplay(os.Args[2:])
+	case "simulate":
+		err = runSimulate(os.Args[2:])
 	default:
-		usage(fmt.Sprintf("invalid command %s", cmd))
+		err = runCommand(cmd, svcName, nameInstallService, descInstallService)
 	}
 	if err != nil {
 		log.Fatalf("failed to %s %s: %v", cmd, svcName, err)
@@ -3,6 +3,7 @@ package models
 import (
 	"errors"
 	"fmt"
+	"gps_clients/server_gps_service/logger"
 	"gps_clients/server_gps_service/utils"
 	"os"
 	"strings"
@@ -24,10 +25,19 @@ type GPSInfo struct {
 	LastConnect string  `json:"lastconnect"`
 	LastInfo    string  `json:"lastinfo"`
 	LastError   string  `json:"lasterror"`
+	Title       string  `json:"title,omitempty"`
+	Owner       string  `json:"owner,omitempty"`
+	Group       string  `json:"group,omitempty"`
+	Port        string  `json:"-"`
 	CountData   []byte  `json:"-"`
 	GpsD        GPSData `json:"-"`
 }
 
+//Log журнал с полями устройства
+func (g *GPSInfo) Log() logger.Entry {
+	return logger.With(logger.Fields{Port: g.Port, Device: g.Name})
+}
+
 func (g *GPSInfo) SaveODPList(path string, sl []string) error {
 	if len(sl) < 1 {
 		return nil
@@ -42,7 +52,7 @@ func (g *GPSInfo) SaveODPList(path string, sl []string) error {
 		return err
 	}
 
-	path += g.Name + ".txt"
+	path += utils.SafeFileName(g.Name) + ".txt"
 
 	strToSave := ""
 
@@ -60,6 +70,8 @@ func (g *GPSInfo) SaveODPList(path string, sl []string) error {
 }
 
 func (g *GPSInfo) SaveToError(path string) error {
+	publishRejected(*g, []GPSInfo{*g})
+
 	if path == "" {
 		path = utils.GetPathWhereExe()
 	}
@@ -69,7 +81,7 @@ func (g *GPSInfo) SaveToError(path string) error {
 		return err
 	}
 
-	path += g.Name + ".txt"
+	path += utils.SafeFileName(g.Name) + ".txt"
 
 	if file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0777); err != nil {
 		return err
@@ -87,6 +99,8 @@ func (g *GPSInfo) SaveErrorList(path string, sl []GPSInfo) error {
 		return nil
 	}
 
+	publishRejected(*g, sl)
+
 	if path == "" {
 		path = utils.GetPathWhereExe()
 	}
@@ -96,7 +110,7 @@ func (g *GPSInfo) SaveErrorList(path string, sl []GPSInfo) error {
 		return err
 	}
 
-	path += g.Name + ".txt"
+	path += utils.SafeFileName(g.Name) + ".txt"
 
 	strToSave := ""
 
@@ -118,6 +132,8 @@ func (g *GPSInfo) SaveErrorList(path string, sl []GPSInfo) error {
 }
 
 func (g *GPSInfo) SaveToFile(path string) error {
+	publishAccepted(*g, []GPSData{g.GpsD})
+
 	if path == "" {
 		path = utils.GetPathWhereExe()
 	}
@@ -127,7 +143,7 @@ func (g *GPSInfo) SaveToFile(path string) error {
 		return err
 	}
 
-	path += g.Name + ".txt"
+	path += utils.SafeFileName(g.Name) + ".txt"
 
 	if file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0777); err != nil {
 		return err
@@ -143,6 +159,8 @@ func (g *GPSInfo) SaveToFileList(path string, info map[string][]GPSData) error {
 		return nil
 	}
 
+	publishAcceptedMap(*g, info)
+
 	if path == "" {
 		path = utils.GetPathWhereExe()
 	}
@@ -162,7 +180,7 @@ func (g *GPSInfo) SaveToFileList(path string, info map[string][]GPSData) error {
 			return err
 		}
 
-		path += g.Name + ".txt"
+		path += utils.SafeFileName(g.Name) + ".txt"
 
 		strToSave := ""
 		for _, s := range v {
@@ -195,25 +213,73 @@ func (g *GPSInfo) Chk(d GPSData, c ChkParams) error {
 		return fmt.Errorf("Спутников менее %d", c.Sat)
 	}
 
+	if c.Dedup != nil && c.Dedup.Seen(d) {
+		return ErrDuplicate
+	}
+
 	return nil
 }
 
+//Records записи пакета до сохранения: принятые по датам (ключ ddmmyy) и отклоненные
+type Records struct {
+	Save   map[string][]GPSData
+	Errors []GPSInfo
+}
+
+//AddRecord проверка записи и добавление в принятые или отклоненные; fix=false - навигация
+//недостоверна, запись отклоняется. Обновляет LastError, LastInfo и последнюю принятую точку.
+func (g *GPSInfo) AddRecord(r *Records, d GPSData, fix bool, c ChkParams) {
+	g.LastError = ""
+	if !fix {
+		g.LastError = "no gps fix"
+	}
+
+	if err := g.Chk(d, c); err != nil {
+		g.LastError = err.Error()
+	}
+
+	g.LastInfo = d.DateTime.Format("02.01.06 ") + d.ToString()
+
+	if g.LastError != "" {
+		errGPS := *g
+		errGPS.GpsD = d
+		r.Errors = append(r.Errors, errGPS)
+		return
+	}
+	g.GpsD = d
+	if r.Save == nil {
+		r.Save = make(map[string][]GPSData)
+	}
+	day := d.DateTime.Format("020106")
+	r.Save[day] = append(r.Save[day], d)
+}
+
+//SaveRecords сохранение отклоненных и принятых записей пакета
+func (g *GPSInfo) SaveRecords(path string, r Records) error {
+	if err := g.SaveErrorList(path, r.Errors); err != nil {
+		return err
+	}
+	return g.SaveToFileList(path, r.Save)
+}
+
 type GPSData struct {
-	DateTime time.Time
-	Lat      float64
-	Lng      float64
-	Alt      int64
-	Angle    int64
-	Sat      int64
-	Speed    int64
-	AccV     float64
-	BatV     float64
-	TempC    float64
-	Dut1     int64
-	Dut2     int64
-	OtherID  []string
-	UseDut   bool
-	UseTempC bool
+	DateTime    time.Time `json:"time"`
+	Lat         float64   `json:"lat"`
+	Lng         float64   `json:"lng"`
+	Alt         int64     `json:"alt"`
+	Angle       int64     `json:"angle"`
+	Sat         int64     `json:"sat"`
+	Speed       int64     `json:"speed"`
+	AccV        float64   `json:"accV"`
+	BatV        float64   `json:"batV"`
+	TempC       float64   `json:"tempC,omitempty"`
+	BatLevel    int64     `json:"batLevel,omitempty"` //заряд батареи, %
+	Dut1        int64     `json:"dut1,omitempty"`
+	Dut2        int64     `json:"dut2,omitempty"`
+	OtherID     []string  `json:"other,omitempty"`
+	UseDut      bool      `json:"useDut,omitempty"`
+	UseTempC    bool      `json:"useTempC,omitempty"`
+	UseBatLevel bool      `json:"useBatLevel,omitempty"`
 }
 
 func (g *GPSData) ToString() string {
@@ -230,6 +296,9 @@ func (g *GPSData) ToString() string {
 	if g.UseTempC {
 		fmt.Fprintf(&sb, "TempC=%.1f;", g.TempC)
 	}
+	if g.UseBatLevel {
+		fmt.Fprintf(&sb, "BatLevel=%d;", g.BatLevel)
+	}
 	if g.UseDut {
 		fmt.Fprintf(&sb, "Dut1=%d;Dut2=%d;Dut3=0;Dut4=0;", g.Dut1, g.Dut2)
 	}
@@ -241,8 +310,36 @@ func (g *GPSData) ToString() string {
 	return sb.String()
 }
 
+//DeviceChecker проверка, разрешено ли устройство (реестр устройств);
+//вызывается разборщиком до сохранения первых записей устройства
+type DeviceChecker interface {
+	CheckDevice(name string) error
+}
+
+//Deduper индекс уже принятых записей устройства
+type Deduper interface {
+	//Seen true, если запись уже принята; иначе запоминает ее
+	Seen(d GPSData) bool
+}
+
+//ErrUnknownDevice устройства нет в реестре
+var ErrUnknownDevice = errors.New("unknown device")
+
+//ErrDuplicate запись уже принята ранее (повтор пакета после потери подтверждения)
+var ErrDuplicate = errors.New("Повтор ранее принятой записи")
+
 type ChkParams struct {
-	Sat int64
+	Sat     int64
+	Devices DeviceChecker
+	Dedup   Deduper
+}
+
+//ChkName проверка имени устройства по реестру
+func (c ChkParams) ChkName(name string) error {
+	if c.Devices != nil {
+		return c.Devices.CheckDevice(name)
+	}
+	return nil
 }
 
 type ProtocolModel struct {
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddRecord(t *testing.T) {
+	tm := time.Date(2025, 9, 18, 23, 59, 59, 0, time.UTC)
+	tests := []struct {
+		d     GPSData
+		fix   bool
+		error string
+	}{
+		{GPSData{DateTime: tm, Sat: 8}, true, ""},
+		{GPSData{DateTime: tm.Add(time.Second), Sat: 8}, false, "no gps fix"},
+		{GPSData{DateTime: tm.Add(2 * time.Second), Sat: 2}, true, "Спутников менее 4"},
+		{GPSData{DateTime: tm.Add(-time.Second), Sat: 8}, true, "Последнее время меньше предидущего"},
+		{GPSData{DateTime: tm.Add(3 * time.Second), Sat: 8}, true, ""},
+	}
+
+	g := &GPSInfo{Name: "dev1"}
+	var r Records
+	for i, tt := range tests {
+		g.AddRecord(&r, tt.d, tt.fix, ChkParams{Sat: 4})
+		if g.LastError != tt.error {
+			t.Errorf("record %d: error %q, want %q", i, g.LastError, tt.error)
+		}
+	}
+
+	//принятые разложены по датам, последняя точка - последняя принятая
+	if len(r.Save) != 2 || len(r.Save["180925"]) != 1 || len(r.Save["190925"]) != 1 ||
+		!g.GpsD.DateTime.Equal(tm.Add(3*time.Second)) {
+		t.Fatalf("saved %v, last %v", r.Save, g.GpsD.DateTime)
+	}
+	if len(r.Errors) != 3 || r.Errors[0].LastError != "no gps fix" || !r.Errors[0].GpsD.DateTime.Equal(tm.Add(time.Second)) {
+		t.Fatalf("errors %+v", r.Errors)
+	}
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//типы событий
+const (
+	EventLogin      = "login"
+	EventDisconnect = "disconnect"
+	EventError      = "error"
+	EventUnknown    = "unknown"
+)
+
+//Event событие, обнаруженное сервером или трекером
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	Name string    `json:"device"`
+	Port string    `json:"port"`
+	Info string    `json:"info,omitempty"`
+}
+
+//Sink получатель принятых и отклоненных записей и событий (ретрансляция, webhook и т.п.)
+type Sink interface {
+	Accepted(g GPSInfo, data []GPSData)
+	Rejected(g GPSInfo, list []GPSInfo)
+	Event(e Event)
+}
+
+var (
+	sinks   []Sink
+	sinksMu sync.RWMutex
+)
+
+//AddSink регистрирует получателя записей
+func AddSink(s Sink) {
+	defer sinksMu.Unlock()
+	sinksMu.Lock()
+	sinks = append(sinks, s)
+}
+
+func publishAccepted(g GPSInfo, data []GPSData) {
+	if len(data) < 1 {
+		return
+	}
+	defer sinksMu.RUnlock()
+	sinksMu.RLock()
+	for _, s := range sinks {
+		s.Accepted(g, data)
+	}
+}
+
+func publishAcceptedMap(g GPSInfo, info map[string][]GPSData) {
+	var data []GPSData
+	for _, v := range info {
+		data = append(data, v...)
+	}
+	sort.SliceStable(data, func(i, j int) bool {
+		return data[i].DateTime.Before(data[j].DateTime)
+	})
+	publishAccepted(g, data)
+}
+
+func publishRejected(g GPSInfo, list []GPSInfo) {
+	if len(list) < 1 {
+		return
+	}
+	defer sinksMu.RUnlock()
+	sinksMu.RLock()
+	for _, s := range sinks {
+		s.Rejected(g, list)
+	}
+}
+
+//PublishEvent передает событие всем получателям
+func PublishEvent(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	defer sinksMu.RUnlock()
+	sinksMu.RLock()
+	for _, s := range sinks {
+		s.Event(e)
+	}
+}
+
+//Param дополнительный параметр записи из OtherID
+type Param struct {
+	Name  string
+	Value string
+}
+
+//Params разбирает OtherID ("id 66=1;", "Zajig=1;") в список параметров
+func (g *GPSData) Params() []Param {
+	var res []Param
+	for _, v := range g.OtherID {
+		for _, s := range strings.Split(v, ";") {
+			kv := strings.SplitN(s, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			name := strings.ReplaceAll(strings.TrimSpace(kv[0]), " ", "")
+			if name == "" {
+				continue
+			}
+			res = append(res, Param{Name: name, Value: strings.TrimSpace(kv[1])})
+		}
+	}
+	return res
+}
@@ -0,0 +1,269 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+//типы пакетов MQTT 3.1.1
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetPubrec     = 5
+	packetPubrel     = 6
+	packetPubcomp    = 7
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+//Options параметры подключения к брокеру
+type Options struct {
+	Addr      string
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+	Timeout   time.Duration
+}
+
+//Client минимальный синхронный клиент MQTT 3.1.1 только для публикации.
+//Методы не потокобезопасны, клиент используется из одной горутины.
+type Client struct {
+	opt      Options
+	conn     net.Conn
+	rd       *bufio.Reader
+	packetID uint16
+}
+
+//Dial подключается к брокеру и выполняет CONNECT
+func Dial(opt Options) (*Client, error) {
+	if opt.Timeout == 0 {
+		opt.Timeout = 30 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", opt.Addr, opt.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{opt: opt, conn: conn, rd: bufio.NewReader(conn)}
+	if err := c.connect(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	b := []byte{header}
+	n := len(body)
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			break
+		}
+	}
+	c.conn.SetDeadline(time.Now().Add(c.opt.Timeout))
+	_, err := c.conn.Write(append(b, body...))
+	return err
+}
+
+func (c *Client) read() (byte, []byte, error) {
+	c.conn.SetDeadline(time.Now().Add(c.opt.Timeout))
+	header, err := c.rd.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mul := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("mqtt: bad remaining length")
+		}
+		d, err := c.rd.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(d&0x7f) * mul
+		mul *= 128
+		if d&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.rd, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+//wait читает пакеты до получения пакета типа typ с идентификатором id
+func (c *Client) wait(typ byte, id uint16) error {
+	for {
+		header, body, err := c.read()
+		if err != nil {
+			return err
+		}
+		switch header >> 4 {
+		case typ:
+			if len(body) >= 2 && binary.BigEndian.Uint16(body) == id {
+				return nil
+			}
+		case packetPingresp:
+		default:
+			return fmt.Errorf("mqtt: unexpected packet type %d", header>>4)
+		}
+	}
+}
+
+func (c *Client) connect() error {
+	var flags byte = 0x02 //clean session
+	if c.opt.Username != "" {
+		flags |= 0x80
+	}
+	if c.opt.Password != "" {
+		flags |= 0x40
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	ka := uint16(c.opt.KeepAlive / time.Second)
+	body = append(body, byte(ka>>8), byte(ka))
+	body = appendString(body, c.opt.ClientID)
+	if c.opt.Username != "" {
+		body = appendString(body, c.opt.Username)
+	}
+	if c.opt.Password != "" {
+		body = appendString(body, c.opt.Password)
+	}
+
+	if err := c.write(packetConnect<<4, body); err != nil {
+		return err
+	}
+
+	header, resp, err := c.read()
+	if err != nil {
+		return err
+	}
+	if header>>4 != packetConnack || len(resp) != 2 {
+		return errors.New("mqtt: bad connack")
+	}
+	if resp[1] != 0 {
+		return fmt.Errorf("mqtt: connection refused, code %d", resp[1])
+	}
+	return nil
+}
+
+func (c *Client) nextID() uint16 {
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID = 1
+	}
+	return c.packetID
+}
+
+//Message сообщение PUBLISH. Идентификатор назначается при первой отправке с QoS 1 и 2;
+//после неудачной попытки сообщение отправляется повторно с тем же идентификатором и флагом DUP.
+//Для QoS 2 после полученного PUBREC на том же соединении повторяется только PUBREL;
+//клиент подключается с clean session, поэтому на новом соединении брокер не помнит сообщение
+//и оно отправляется заново с PUBLISH.
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+
+	id       uint16
+	sent     bool    //PUBLISH уже отправлялся
+	released *Client //QoS 2: соединение, на котором получен PUBREC
+}
+
+//Publish публикует сообщение и ждет подтверждения для QoS 1 и 2
+func (c *Client) Publish(msg *Message) error {
+	if msg.QoS > 2 {
+		return fmt.Errorf("mqtt: bad qos %d", msg.QoS)
+	}
+	if msg.QoS > 0 && msg.id == 0 {
+		msg.id = c.nextID()
+	}
+	id := msg.id
+
+	//сессия прежнего соединения сброшена брокером
+	if msg.released != nil && msg.released != c {
+		msg.released = nil
+	}
+
+	if msg.released == nil {
+		header := byte(packetPublish<<4) | msg.QoS<<1
+		if msg.Retain {
+			header |= 0x01
+		}
+		if msg.sent && msg.QoS > 0 {
+			header |= 0x08 //DUP
+		}
+
+		body := appendString(nil, msg.Topic)
+		if msg.QoS > 0 {
+			body = append(body, byte(id>>8), byte(id))
+		}
+		body = append(body, msg.Payload...)
+
+		msg.sent = true
+		if err := c.write(header, body); err != nil {
+			return err
+		}
+	}
+
+	switch msg.QoS {
+	case 1:
+		return c.wait(packetPuback, id)
+	case 2:
+		if msg.released == nil {
+			if err := c.wait(packetPubrec, id); err != nil {
+				return err
+			}
+			msg.released = c
+		}
+		if err := c.write(packetPubrel<<4|0x02, []byte{byte(id >> 8), byte(id)}); err != nil {
+			return err
+		}
+		return c.wait(packetPubcomp, id)
+	}
+	return nil
+}
+
+//Ping отправляет PINGREQ и ждет PINGRESP
+func (c *Client) Ping() error {
+	if err := c.write(packetPingreq<<4, nil); err != nil {
+		return err
+	}
+	header, _, err := c.read()
+	if err != nil {
+		return err
+	}
+	if header>>4 != packetPingresp {
+		return fmt.Errorf("mqtt: unexpected packet type %d", header>>4)
+	}
+	return nil
+}
+
+//Close отправляет DISCONNECT и закрывает соединение
+func (c *Client) Close() error {
+	c.write(packetDisconnect<<4, nil)
+	return c.conn.Close()
+}
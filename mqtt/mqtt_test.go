@@ -0,0 +1,281 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/models"
+)
+
+//received пакет PUBLISH или PUBREL, принятый брокером
+type received struct {
+	conn    int //номер соединения с 1
+	typ     byte
+	qos     byte
+	retain  bool
+	dup     bool
+	topic   string
+	id      uint16
+	payload []byte
+}
+
+//broker заглушка брокера MQTT 3.1.1 на loopback: CONNECT/CONNACK, PUBLISH с QoS 0-2, PINGREQ.
+//drop вызывается на каждый PUBLISH и PUBREL, true - соединение рвется без ответа.
+type broker struct {
+	t    *testing.T
+	ln   net.Listener
+	got  chan received
+	drop func(r received) bool
+
+	mu       sync.Mutex
+	connects int
+	clientID string
+}
+
+func newBroker(t *testing.T, drop func(r received) bool) *broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &broker{t: t, ln: ln, got: make(chan received, 100), drop: drop}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.connects++
+			n := b.connects
+			b.mu.Unlock()
+			go b.serve(c, n)
+		}
+	}()
+	return b
+}
+
+func (b *broker) addr() string {
+	return b.ln.Addr().String()
+}
+
+func (b *broker) serve(conn net.Conn, n int) {
+	defer conn.Close()
+	//разбор и запись пакетов те же, что у клиента
+	c := &Client{opt: Options{Timeout: 5 * time.Second}, conn: conn, rd: bufio.NewReader(conn)}
+
+	header, body, err := c.read()
+	if err != nil {
+		return
+	}
+	if header>>4 != packetConnect || len(body) < 12 || string(body[2:6]) != "MQTT" || body[6] != 4 {
+		b.t.Errorf("bad connect %x %x", header, body)
+		return
+	}
+	idLen := int(binary.BigEndian.Uint16(body[10:12]))
+	b.mu.Lock()
+	b.clientID = string(body[12 : 12+idLen])
+	b.mu.Unlock()
+	c.write(packetConnack<<4, []byte{0, 0})
+
+	for {
+		header, body, err := c.read()
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case packetPublish:
+			r := received{
+				conn:   n,
+				typ:    packetPublish,
+				qos:    header >> 1 & 0x03,
+				retain: header&0x01 != 0,
+				dup:    header&0x08 != 0,
+			}
+			l := int(binary.BigEndian.Uint16(body))
+			r.topic = string(body[2 : 2+l])
+			body = body[2+l:]
+			if r.qos > 0 {
+				r.id = binary.BigEndian.Uint16(body)
+				body = body[2:]
+			}
+			r.payload = body
+			b.got <- r
+			if b.drop != nil && b.drop(r) {
+				return
+			}
+			switch r.qos {
+			case 1:
+				c.write(packetPuback<<4, []byte{byte(r.id >> 8), byte(r.id)})
+			case 2:
+				c.write(packetPubrec<<4, []byte{byte(r.id >> 8), byte(r.id)})
+			}
+		case packetPubrel:
+			if header&0x0F != 0x02 {
+				b.t.Errorf("bad pubrel flags %x", header)
+			}
+			r := received{conn: n, typ: packetPubrel, id: binary.BigEndian.Uint16(body)}
+			b.got <- r
+			if b.drop != nil && b.drop(r) {
+				return
+			}
+			c.write(packetPubcomp<<4, body[:2])
+		case packetPingreq:
+			c.write(packetPingresp<<4, nil)
+		case packetDisconnect:
+			return
+		default:
+			b.t.Errorf("unexpected packet %x", header)
+			return
+		}
+	}
+}
+
+func (b *broker) next() received {
+	select {
+	case r := <-b.got:
+		return r
+	case <-time.After(5 * time.Second):
+		b.t.Fatal("no packet")
+	}
+	return received{}
+}
+
+func TestClientPublishQoS(t *testing.T) {
+	b := newBroker(t, nil)
+	c, err := Dial(Options{Addr: b.addr(), ClientID: "gps-test", KeepAlive: time.Minute, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	for qos := byte(0); qos <= 2; qos++ {
+		msg := &Message{Topic: "gps/5000/dev/position", Payload: []byte{'0' + qos}, QoS: qos, Retain: qos == 1}
+		if err := c.Publish(msg); err != nil {
+			t.Fatalf("qos %d: %v", qos, err)
+		}
+		r := b.next()
+		if r.typ != packetPublish || r.qos != qos || r.retain != (qos == 1) || r.dup ||
+			r.topic != msg.Topic || string(r.payload) != string(msg.Payload) {
+			t.Fatalf("qos %d: got %+v", qos, r)
+		}
+		if qos > 0 && r.id == 0 {
+			t.Fatalf("qos %d: zero packet id", qos)
+		}
+		if qos == 2 {
+			if rel := b.next(); rel.typ != packetPubrel || rel.id != r.id {
+				t.Fatalf("want pubrel %d, got %+v", r.id, rel)
+			}
+		}
+	}
+
+	if err := c.Publish(&Message{Topic: "x", QoS: 3}); err == nil {
+		t.Fatal("qos 3 accepted")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.clientID != "gps-test" {
+		t.Fatalf("client id %q", b.clientID)
+	}
+}
+
+func newManager(t *testing.T, cfg config.MQTT) *Manager {
+	d := minBackoff
+	minBackoff = 50 * time.Millisecond
+	m, err := New([]config.MQTT{cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		m.Close()
+		minBackoff = d
+	})
+	return m
+}
+
+//TestRetransmitDup после обрыва до PUBACK сообщение повторяется на новом соединении с тем же ID и DUP
+func TestRetransmitDup(t *testing.T) {
+	b := newBroker(t, func(r received) bool { return r.conn == 1 })
+	m := newManager(t, config.MQTT{Name: "test", Addr: b.addr(), QoS: 1})
+
+	m.Accepted(models.GPSInfo{Name: "dev1", Port: "5000"}, []models.GPSData{{Lat: 55.7}})
+
+	first, second := b.next(), b.next()
+	if first.conn != 1 || first.dup || second.conn != 2 || !second.dup || second.id != first.id ||
+		string(second.payload) != string(first.payload) {
+		t.Fatalf("first %+v, second %+v", first, second)
+	}
+}
+
+//TestRetransmitPubrel QoS 2: после обрыва на PUBREL новое соединение с clean session
+//получает сообщение заново - PUBLISH с DUP и затем PUBREL
+func TestRetransmitPubrel(t *testing.T) {
+	b := newBroker(t, func(r received) bool { return r.conn == 1 && r.typ == packetPubrel })
+	m := newManager(t, config.MQTT{Name: "test", Addr: b.addr(), QoS: 2})
+
+	m.Accepted(models.GPSInfo{Name: "dev1", Port: "5000"}, []models.GPSData{{Lat: 55.7}})
+
+	pub1, rel1, pub2, rel2 := b.next(), b.next(), b.next(), b.next()
+	if pub1.typ != packetPublish || pub1.conn != 1 || pub1.dup ||
+		rel1.typ != packetPubrel || rel1.id != pub1.id ||
+		pub2.typ != packetPublish || pub2.conn != 2 || !pub2.dup || pub2.id != pub1.id ||
+		string(pub2.payload) != string(pub1.payload) ||
+		rel2.typ != packetPubrel || rel2.conn != 2 || rel2.id != pub1.id {
+		t.Fatalf("got %+v, %+v, %+v, %+v", pub1, rel1, pub2, rel2)
+	}
+
+	//следующее сообщение идет обычным порядком
+	m.Accepted(models.GPSInfo{Name: "dev1", Port: "5000"}, []models.GPSData{{Lat: 55.8}})
+	if r := b.next(); r.typ != packetPublish || r.dup || r.conn != 2 {
+		t.Fatalf("got %+v", r)
+	}
+}
+
+func TestManagerTopics(t *testing.T) {
+	b := newBroker(t, nil)
+	m := newManager(t, config.MQTT{Name: "test", Addr: b.addr(), Retain: true, Devices: []string{"dev*"}})
+
+	tm := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	m.Accepted(models.GPSInfo{Name: "other", Port: "5000"}, []models.GPSData{{DateTime: tm}})
+	m.Accepted(models.GPSInfo{Name: "dev#1", Port: "5000"}, []models.GPSData{{DateTime: tm}, {DateTime: tm.Add(time.Second)}})
+	m.Rejected(models.GPSInfo{Name: "dev#1", Port: "5000"}, []models.GPSInfo{{LastError: "no gps fix", GpsD: models.GPSData{DateTime: tm}}})
+	m.Event(models.Event{Type: models.EventLogin, Name: "dev#1", Port: "5000"})
+	m.Event(models.Event{Type: models.EventError, Name: "dev#1", Port: "5000", Info: "bad crc"})
+
+	//только последняя позиция сохраняется брокером
+	for i, retain := range []bool{false, true} {
+		r := b.next()
+		var d models.GPSData
+		if err := json.Unmarshal(r.payload, &d); err != nil {
+			t.Fatal(err)
+		}
+		if r.topic != "gps/5000/dev_1/position" || r.retain != retain || !d.DateTime.Equal(tm.Add(time.Duration(i)*time.Second)) {
+			t.Fatalf("position %d: %+v", i, r)
+		}
+	}
+	for _, want := range []string{"no gps fix", "bad crc"} {
+		r := b.next()
+		var e ErrorRecord
+		if err := json.Unmarshal(r.payload, &e); err != nil {
+			t.Fatal(err)
+		}
+		if r.topic != "gps/5000/dev_1/error" || r.retain || e.Error != want {
+			t.Fatalf("error %q: %+v", want, r)
+		}
+	}
+	select {
+	case r := <-b.got:
+		t.Fatalf("unexpected %+v", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,244 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/logger"
+	"gps_clients/server_gps_service/models"
+)
+
+const (
+	queueSize        = 10000
+	maxBackoff       = 2 * time.Minute
+	defaultKeepAlive = 60 * time.Second
+)
+
+//minBackoff первая пауза перед переподключением, переменная для тестов
+var minBackoff = time.Second
+
+type message struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+//ErrorRecord отклоненная запись с причиной
+type ErrorRecord struct {
+	Error  string          `json:"error"`
+	Record *models.GPSData `json:"record,omitempty"`
+}
+
+//topicName убирает из имени символы, недопустимые в уровне топика
+func topicName(s string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
+
+//Manager публикация записей на все настроенные брокеры
+type Manager struct {
+	publishers []*publisher
+}
+
+//New запускает публикацию
+func New(cfgs []config.MQTT) (*Manager, error) {
+	m := &Manager{}
+	for _, c := range cfgs {
+		if c.Name == "" || c.Addr == "" {
+			m.Close()
+			return nil, errors.New("mqtt: empty name or addr")
+		}
+		if c.QoS > 2 {
+			m.Close()
+			return nil, fmt.Errorf("mqtt %s: bad qos %d", c.Name, c.QoS)
+		}
+		if c.Prefix == "" {
+			c.Prefix = "gps"
+		}
+		if c.ClientID == "" {
+			c.ClientID = "gps-" + c.Name
+		}
+
+		keepAlive := defaultKeepAlive
+		if c.KeepAlive > 0 {
+			keepAlive = time.Duration(c.KeepAlive) * time.Second
+		}
+
+		p := &publisher{
+			cfg: c,
+			opt: Options{
+				Addr:      c.Addr,
+				ClientID:  c.ClientID,
+				Username:  c.Username,
+				Password:  c.Password,
+				KeepAlive: keepAlive,
+			},
+			queue:      make(chan message, queueSize),
+			minBackoff: minBackoff,
+			stop:       make(chan struct{}),
+			done:       make(chan struct{}),
+		}
+		go p.run()
+		m.publishers = append(m.publishers, p)
+	}
+	return m, nil
+}
+
+//Accepted публикует принятые записи в <prefix>/<port>/<device>/position
+func (m *Manager) Accepted(g models.GPSInfo, data []models.GPSData) {
+	for _, p := range m.publishers {
+		if !p.match(g.Name) {
+			continue
+		}
+		topic := p.topic(g.Port, g.Name, "position")
+		for i := range data {
+			body, err := json.Marshal(data[i])
+			if err != nil {
+				continue
+			}
+			p.push(message{topic: topic, payload: body, retain: p.cfg.Retain && i == len(data)-1})
+		}
+	}
+}
+
+//Rejected публикует отклоненные записи в <prefix>/<port>/<device>/error
+func (m *Manager) Rejected(g models.GPSInfo, list []models.GPSInfo) {
+	for _, p := range m.publishers {
+		if !p.match(g.Name) {
+			continue
+		}
+		topic := p.topic(g.Port, g.Name, "error")
+		for _, v := range list {
+			d := v.GpsD
+			body, err := json.Marshal(ErrorRecord{Error: v.LastError, Record: &d})
+			if err != nil {
+				continue
+			}
+			p.push(message{topic: topic, payload: body})
+		}
+	}
+}
+
+//Event публикует ошибки разбора пакетов в <prefix>/<port>/<device>/error
+func (m *Manager) Event(e models.Event) {
+	if e.Type != models.EventError || e.Name == "" {
+		return
+	}
+	for _, p := range m.publishers {
+		if !p.match(e.Name) {
+			continue
+		}
+		body, err := json.Marshal(ErrorRecord{Error: e.Info})
+		if err != nil {
+			continue
+		}
+		p.push(message{topic: p.topic(e.Port, e.Name, "error"), payload: body})
+	}
+}
+
+//Close останавливает публикацию
+func (m *Manager) Close() {
+	for _, p := range m.publishers {
+		close(p.stop)
+		<-p.done
+	}
+}
+
+type publisher struct {
+	cfg        config.MQTT
+	opt        Options
+	client     *Client
+	queue      chan message
+	minBackoff time.Duration
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+func (p *publisher) match(name string) bool {
+	if len(p.cfg.Devices) == 0 {
+		return true
+	}
+	for _, v := range p.cfg.Devices {
+		if ok, _ := path.Match(v, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *publisher) topic(port, name, kind string) string {
+	return strings.Join([]string{p.cfg.Prefix, topicName(port), topicName(name), kind}, "/")
+}
+
+func (p *publisher) push(msg message) {
+	select {
+	case p.queue <- msg:
+	default:
+		logger.Error("mqtt %s: queue is full, message to %s dropped", p.cfg.Name, msg.topic)
+	}
+}
+
+func (p *publisher) run() {
+	defer close(p.done)
+	defer p.disconnect()
+
+	ping := time.NewTicker(p.opt.KeepAlive / 2)
+	defer ping.Stop()
+
+	backoff := p.minBackoff
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ping.C:
+			if p.client != nil {
+				if err := p.client.Ping(); err != nil {
+					logger.Error("mqtt %s: %v", p.cfg.Name, err)
+					p.disconnect()
+				}
+			}
+		case m := <-p.queue:
+			msg := &Message{Topic: m.topic, Payload: m.payload, QoS: p.cfg.QoS, Retain: m.retain}
+			for {
+				err := p.publish(msg)
+				if err == nil {
+					backoff = p.minBackoff
+					break
+				}
+				logger.Error("mqtt %s: %v, retry in %s", p.cfg.Name, err, backoff)
+				p.disconnect()
+				select {
+				case <-time.After(backoff):
+				case <-p.stop:
+					return
+				}
+				backoff *= 2
+				if backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+			}
+		}
+	}
+}
+
+func (p *publisher) publish(msg *Message) error {
+	if p.client == nil {
+		c, err := Dial(p.opt)
+		if err != nil {
+			return err
+		}
+		p.client = c
+	}
+	return p.client.Publish(msg)
+}
+
+func (p *publisher) disconnect() {
+	if p.client != nil {
+		p.client.Close()
+		p.client = nil
+	}
+}
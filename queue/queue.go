@@ -0,0 +1,213 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//ErrEmpty очередь пуста
+var ErrEmpty = errors.New("queue is empty")
+
+const ext = ".json"
+
+//Queue очередь на диске: каждый элемент хранится отдельным файлом,
+//порядок определяется порядковым номером в имени файла
+type Queue struct {
+	dir    string
+	limit  int
+	mu     sync.Mutex
+	seq    uint64
+	ids    []uint64
+	notify chan struct{}
+}
+
+//Open открывает (создает) очередь в папке dir, limit - максимальное
+//кол-во элементов (0 - без ограничения), при переполнении удаляются самые старые
+func Open(dir string, limit int) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		dir:    dir,
+		limit:  limit,
+		notify: make(chan struct{}, 1),
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ext) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), ext), 10, 64)
+		if err != nil {
+			continue
+		}
+		q.ids = append(q.ids, id)
+		if id > q.seq {
+			q.seq = id
+		}
+	}
+	sort.Slice(q.ids, func(i, j int) bool { return q.ids[i] < q.ids[j] })
+
+	return q, nil
+}
+
+func (q *Queue) fileName(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, ext))
+}
+
+//Push добавляет элемент в конец очереди
+func (q *Queue) Push(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	defer q.mu.Unlock()
+	q.mu.Lock()
+
+	q.seq++
+	id := q.seq
+	tmp := q.fileName(id) + ".tmp"
+	if err := ioutil.WriteFile(tmp, body, 0777); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, q.fileName(id)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	q.ids = append(q.ids, id)
+
+	for q.limit > 0 && len(q.ids) > q.limit {
+		os.Remove(q.fileName(q.ids[0]))
+		q.ids = q.ids[1:]
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+//Replace заменяет содержимое элемента, место в очереди сохраняется
+func (q *Queue) Replace(id uint64, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	defer q.mu.Unlock()
+	q.mu.Lock()
+
+	found := false
+	for _, v := range q.ids {
+		if v == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("queue item %d not found", id)
+	}
+
+	tmp := q.fileName(id) + ".tmp"
+	if err := ioutil.WriteFile(tmp, body, 0777); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, q.fileName(id)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+//Peek читает первый элемент очереди в v не удаляя его
+func (q *Queue) Peek(v interface{}) (uint64, error) {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+
+	if len(q.ids) == 0 {
+		return 0, ErrEmpty
+	}
+
+	id := q.ids[0]
+	body, err := ioutil.ReadFile(q.fileName(id))
+	if err != nil {
+		return id, err
+	}
+	return id, json.Unmarshal(body, v)
+}
+
+//PeekN читает до n первых элементов очереди не удаляя их, тела в JSON.
+//Если первый элемент не читается, возвращается его номер и ошибка.
+func (q *Queue) PeekN(n int) ([]uint64, []json.RawMessage, error) {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+
+	if len(q.ids) == 0 {
+		return nil, nil, ErrEmpty
+	}
+
+	var ids []uint64
+	var items []json.RawMessage
+	for _, id := range q.ids {
+		if len(ids) >= n {
+			break
+		}
+		body, err := ioutil.ReadFile(q.fileName(id))
+		if err != nil {
+			if len(ids) == 0 {
+				return []uint64{id}, nil, err
+			}
+			break
+		}
+		ids = append(ids, id)
+		items = append(items, body)
+	}
+	return ids, items, nil
+}
+
+//Remove удаляет элемент из очереди
+func (q *Queue) Remove(id uint64) error {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+
+	for i, v := range q.ids {
+		if v == id {
+			q.ids = append(q.ids[:i], q.ids[i+1:]...)
+			break
+		}
+	}
+
+	err := os.Remove(q.fileName(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+//Len кол-во элементов в очереди
+func (q *Queue) Len() int {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	return len(q.ids)
+}
+
+//Wait канал сигнализирует о добавлении нового элемента
+func (q *Queue) Wait() <-chan struct{} {
+	return q.notify
+}
@@ -0,0 +1,44 @@
+package queue
+
+import "testing"
+
+func TestReplaceKeepsOrder(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b"} {
+		if err := q.Push(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var v string
+	id, err := q.Peek(&v)
+	if err != nil || v != "a" {
+		t.Fatalf("peek %q, %v", v, err)
+	}
+	if err := q.Replace(id, "a2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Replace(id+100, "x"); err == nil {
+		t.Fatal("replace of missing item succeeded")
+	}
+
+	//после переоткрытия порядок и содержимое те же
+	q, err = Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"a2", "b"} {
+		id, err := q.Peek(&v)
+		if err != nil || v != want {
+			t.Fatalf("peek %q, %v, want %q", v, err, want)
+		}
+		q.Remove(id)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("len %d", q.Len())
+	}
+}
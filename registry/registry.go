@@ -0,0 +1,112 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+//Device описание разрешенного устройства
+type Device struct {
+	ID       string `json:"id"`
+	Protocol string `json:"protocol"`
+	Owner    string `json:"owner"`
+	Group    string `json:"group"`
+	Name     string `json:"name"`
+	//TerminalID идентификатор терминала для ретрансляции по EGTS
+	TerminalID uint32 `json:"terminalId,omitempty"`
+}
+
+//Registry список разрешенных устройств из JSON файла.
+//Пустой (nil) реестр разрешает все устройства.
+type Registry struct {
+	file    string
+	mu      sync.RWMutex
+	devices map[string]Device
+}
+
+//Load читает реестр из файла
+func Load(file string) (*Registry, error) {
+	r := &Registry{file: file}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//Reload перечитывает файл реестра, при ошибке остается прежний список
+func (r *Registry) Reload() error {
+	if r == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadFile(r.file)
+	if err != nil {
+		return err
+	}
+
+	var list []Device
+	if err := json.Unmarshal(body, &list); err != nil {
+		return fmt.Errorf("registry %s: %v", r.file, err)
+	}
+
+	devices := make(map[string]Device, len(list))
+	for i, d := range list {
+		if d.ID == "" {
+			return fmt.Errorf("registry %s: empty id in item %d", r.file, i)
+		}
+		if _, ok := devices[d.ID]; ok {
+			return fmt.Errorf("registry %s: duplicate id %s", r.file, d.ID)
+		}
+		devices[d.ID] = d
+	}
+
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	r.devices = devices
+	return nil
+}
+
+//Get описание устройства
+func (r *Registry) Get(id string) (Device, bool) {
+	if r == nil {
+		return Device{}, false
+	}
+	defer r.mu.RUnlock()
+	r.mu.RLock()
+	d, ok := r.devices[id]
+	return d, ok
+}
+
+//Allowed устройство есть в реестре (или реестр не используется)
+func (r *Registry) Allowed(id string) bool {
+	if r == nil {
+		return true
+	}
+	_, ok := r.Get(id)
+	return ok
+}
+
+//AllowedProtocol устройство есть в реестре и протокол совпадает (если указан)
+func (r *Registry) AllowedProtocol(id, protocol string) bool {
+	if r == nil {
+		return true
+	}
+	d, ok := r.Get(id)
+	if !ok {
+		return false
+	}
+	return d.Protocol == "" || strings.EqualFold(d.Protocol, protocol)
+}
+
+//Len кол-во устройств в реестре
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	defer r.mu.RUnlock()
+	r.mu.RLock()
+	return len(r.devices)
+}
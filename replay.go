@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gps_clients/server_gps_service/capture"
+	"gps_clients/server_gps_service/clients"
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/models"
+)
+
+//replaySink печать разобранных записей
+type replaySink struct{}
+
+func (replaySink) Accepted(g models.GPSInfo, data []models.GPSData) {
+	for _, d := range data {
+		fmt.Printf("  + %s %s %s\n", g.Name, d.DateTime.Format("02.01.06"), strings.TrimSpace(d.ToString()))
+	}
+}
+
+func (replaySink) Rejected(g models.GPSInfo, list []models.GPSInfo) {
+	for _, v := range list {
+		fmt.Printf("  - %s %s: %s %s\n", g.Name, v.LastError, v.GpsD.DateTime.Format("02.01.06"), strings.TrimSpace(v.GpsD.ToString()))
+	}
+}
+
+func (replaySink) Event(e models.Event) {}
+
+//runReplay разбор файла захвата без сети: replay [-protocol name] [-out dir] <file>
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	protocol := fs.String("protocol", "", "protocol parser (default from capture file)")
+	out := fs.String("out", "", "directory for saved records (default temporary, removed after replay)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: replay [-protocol name] [-out dir] <file>")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := capture.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	if *protocol == "" {
+		*protocol = r.Header.Protocol
+	}
+
+	var frames []capture.Frame
+	for {
+		fr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		frames = append(frames, fr)
+	}
+
+	if *out == "" {
+		dir, err := ioutil.TempDir("", "replay")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		*out = dir
+	}
+
+	parser, err := clients.New(*protocol)
+	if err != nil {
+		return err
+	}
+	gps := parser.Model()
+	gps.ChkPar.Sat = config.Config.MinSatel
+	gps.Path = *out
+	gps.GPS.Port = r.Header.Port
+
+	models.AddSink(replaySink{})
+
+	fmt.Printf("replay %s: protocol %s, port %s, %d frames\n", fs.Arg(0), *protocol, r.Header.Port, len(frames))
+
+	var packets, diffs int
+	for i, fr := range frames {
+		if fr.Dir != capture.In {
+			continue
+		}
+		packets++
+
+		fmt.Printf("#%d %s %s <- %s len=%d\n", packets, fr.Time.Local().Format("02.01.2006 15:04:05.000"), r.Header.Port, fr.Remote, len(fr.Data))
+
+		var ack []byte
+		if strings.HasPrefix(string(fr.Data), "getinfo") {
+			fmt.Println("  getinfo")
+			continue
+		}
+
+		gps.Input = append([]byte(nil), fr.Data...)
+		if err := ParseGPSData(parser); err != nil {
+			fmt.Printf("  error: %v\n", err)
+			ack = GetBadPacketByte(parser)
+		} else {
+			ack = gps.GPS.CountData
+		}
+
+		var recorded []byte
+		hasRecorded := i+1 < len(frames) && frames[i+1].Dir == capture.Out
+		if hasRecorded {
+			recorded = frames[i+1].Data
+		}
+
+		switch {
+		case !hasRecorded:
+			fmt.Printf("  ack %x (no ack recorded)\n", ack)
+		case bytes.Equal(ack, recorded):
+			fmt.Printf("  ack %x\n", ack)
+		default:
+			diffs++
+			fmt.Printf("  ack %x DIFFERS from recorded %x\n", ack, recorded)
+		}
+	}
+
+	fmt.Printf("%d packets, %d ack differences\n", packets, diffs)
+	return nil
+}
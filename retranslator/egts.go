@@ -0,0 +1,305 @@
+package retranslator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"gps_clients/server_gps_service/hash"
+	"gps_clients/server_gps_service/models"
+)
+
+//типы пакетов, сервисы и подзаписи EGTS
+const (
+	egtsPTResponse = 0
+	egtsPTAppData  = 1
+
+	egtsAuthService     = 1
+	egtsTeledataService = 2
+
+	egtsSRRecordResponse = 0
+	egtsSRTermIdentity   = 1
+	egtsSRResultCode     = 9
+	egtsSRPosData        = 16
+	egtsSRExtPosData     = 17
+	egtsSRLiquidLevel    = 27
+)
+
+var egtsEpoch = time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+
+//EGTS кодирование в протокол EGTS (ГОСТ Р 54619): авторизация EGTS_SR_TERM_IDENTITY,
+//записи сервиса телематики с EGTS_SR_POS_DATA, EGTS_SR_EXT_POS_DATA и ДУТ.
+//Идентификатор терминала задается настройкой ретранслятора или реестром устройств,
+//IMEI передается для 15-значных имен.
+type EGTS struct {
+	tid  uint32
+	pid  uint16
+	rn   uint16
+	sent uint16
+	//first номер первой записи последнего отправленного пакета
+	first uint16
+	//ack подтверждения пакетов сервера, уходят вместе со следующими данными
+	ack []byte
+}
+
+func (T *EGTS) Login(name, password string) []byte {
+	b := make([]byte, 5, 20)
+	binary.LittleEndian.PutUint32(b, T.tid)
+	if len(name) == 15 {
+		b[4] = 0x02 //IMEIE
+		b = append(b, name...)
+	}
+	T.sent = T.pid
+	T.first = T.rn
+	return T.packet(egtsPTAppData, T.record(egtsAuthService, 0, time.Time{}, subrecord(egtsSRTermIdentity, b)))
+}
+
+func (T *EGTS) ChkLogin(r *bufio.Reader) error {
+	pr, ok, err := T.readResponse(r)
+	if err != nil {
+		return err
+	}
+	if pr != 0 || ok == 0 {
+		return fmt.Errorf("login rejected: %d", pr)
+	}
+	return nil
+}
+
+func (T *EGTS) Encode(data []models.GPSData) []byte {
+	var sfrd []byte
+	T.first = T.rn
+	for _, d := range data {
+		sfrd = append(sfrd, T.record(egtsTeledataService, T.tid, d.DateTime, egtsRecordData(d))...)
+	}
+
+	T.sent = T.pid
+	out := append(T.ack, T.packet(egtsPTAppData, sfrd)...)
+	T.ack = nil
+	return out
+}
+
+func (T *EGTS) ChkAck(r *bufio.Reader, count int) error {
+	pr, ok, err := T.readResponse(r)
+	if err != nil {
+		return err
+	}
+	if pr != 0 {
+		return fmt.Errorf("%w: result code %d", ErrRejected, pr)
+	}
+	if ok == 0 {
+		return fmt.Errorf("%w: accepted 0 of %d", ErrRejected, count)
+	}
+	if ok < count {
+		//остаток пакета после первой непринятой записи отправляется повторно
+		return &PartialError{Accepted: ok, Count: count}
+	}
+	if ok != count {
+		return fmt.Errorf("accepted %d of %d", ok, count)
+	}
+	return nil
+}
+
+//readResponse ждет подтверждение последнего отправленного пакета: результат обработки пакета
+//и число записей, принятых без ошибки подряд с первой записи пакета. Пакеты данных сервера (код результата авторизации)
+//по пути подтверждаются.
+func (T *EGTS) readResponse(r *bufio.Reader) (pr byte, ok int, err error) {
+	for {
+		pid, pt, sfrd, err := readEGTS(r)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if pt == egtsPTAppData {
+			answer := make([]byte, 3)
+			binary.LittleEndian.PutUint16(answer, pid)
+			err := egtsRecords(sfrd, func(rn uint16, sst byte, srt byte, srd []byte) error {
+				if srt == egtsSRResultCode && len(srd) > 0 && srd[0] != 0 {
+					return fmt.Errorf("authorization rejected: %d", srd[0])
+				}
+				if srt == egtsSRResultCode {
+					answer = append(answer, T.record(sst, 0, time.Time{},
+						subrecord(egtsSRRecordResponse, []byte{byte(rn), byte(rn >> 8), 0}))...)
+				}
+				return nil
+			})
+			if err != nil {
+				return 0, 0, err
+			}
+			T.ack = append(T.ack, T.packet(egtsPTResponse, answer)...)
+			continue
+		}
+		if pt != egtsPTResponse || len(sfrd) < 3 {
+			return 0, 0, fmt.Errorf("unexpected packet type %d", pt)
+		}
+		if binary.LittleEndian.Uint16(sfrd[0:2]) != T.sent {
+			continue
+		}
+
+		accepted := make(map[uint16]bool)
+		err = egtsRecords(sfrd[3:], func(rn uint16, sst byte, srt byte, srd []byte) error {
+			if srt == egtsSRRecordResponse && len(srd) >= 3 && srd[2] == 0 {
+				accepted[binary.LittleEndian.Uint16(srd[0:2])] = true
+			}
+			return nil
+		})
+		for accepted[T.first+uint16(ok)] {
+			ok++
+		}
+		return sfrd[2], ok, err
+	}
+}
+
+//readEGTS транспортный пакет: номер, тип и данные
+func readEGTS(r *bufio.Reader) (pid uint16, pt byte, sfrd []byte, err error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, 0, nil, err
+	}
+	if head[0] != 0x01 || head[3] < 11 {
+		return 0, 0, nil, fmt.Errorf("unexpected answer %x", head)
+	}
+	head = append(head, make([]byte, int(head[3])-4)...)
+	if _, err := io.ReadFull(r, head[4:]); err != nil {
+		return 0, 0, nil, err
+	}
+	if crc := hash.CheckSumCRC8(head[:len(head)-1]); crc != head[len(head)-1] {
+		return 0, 0, nil, fmt.Errorf("bad header crc in answer %x", head)
+	}
+
+	fdl := int(binary.LittleEndian.Uint16(head[5:7]))
+	if fdl == 0 {
+		return binary.LittleEndian.Uint16(head[7:9]), head[9], nil, nil
+	}
+	sfrd = make([]byte, fdl+2)
+	if _, err := io.ReadFull(r, sfrd); err != nil {
+		return 0, 0, nil, err
+	}
+	if crc := hash.CheckSumCRC16CCITT(sfrd[:fdl]); binary.LittleEndian.Uint16(sfrd[fdl:]) != crc {
+		return 0, 0, nil, fmt.Errorf("bad crc in answer %x", sfrd)
+	}
+	return binary.LittleEndian.Uint16(head[7:9]), head[9], sfrd[:fdl], nil
+}
+
+//egtsRecords обходит подзаписи всех записей данных пакета
+func egtsRecords(sfrd []byte, fn func(rn uint16, sst byte, srt byte, srd []byte) error) error {
+	for len(sfrd) > 0 {
+		if len(sfrd) < 7 {
+			return errors.New("bad record length in answer")
+		}
+		rl := int(binary.LittleEndian.Uint16(sfrd[0:2]))
+		rn := binary.LittleEndian.Uint16(sfrd[2:4])
+		pos := 5
+		for _, bit := range []byte{0x01, 0x02, 0x04} {
+			if sfrd[4]&bit != 0 {
+				pos += 4
+			}
+		}
+		if len(sfrd) < pos+2+rl {
+			return errors.New("bad record length in answer")
+		}
+		sst := sfrd[pos]
+		rd := sfrd[pos+2 : pos+2+rl]
+		sfrd = sfrd[pos+2+rl:]
+
+		for len(rd) >= 3 {
+			srl := int(binary.LittleEndian.Uint16(rd[1:3]))
+			if len(rd) < 3+srl {
+				return errors.New("bad subrecord length in answer")
+			}
+			if err := fn(rn, sst, rd[0], rd[3:3+srl]); err != nil {
+				return err
+			}
+			rd = rd[3+srl:]
+		}
+	}
+	return nil
+}
+
+func (T *EGTS) packet(pt byte, sfrd []byte) []byte {
+	b := []byte{0x01, 0x00, 0x00, 11, 0x00, byte(len(sfrd)), byte(len(sfrd) >> 8),
+		byte(T.pid), byte(T.pid >> 8), pt}
+	T.pid++
+	b = append(b, hash.CheckSumCRC8(b))
+	if len(sfrd) == 0 {
+		return b
+	}
+	b = append(b, sfrd...)
+	crc := hash.CheckSumCRC16CCITT(sfrd)
+	return append(b, byte(crc), byte(crc>>8))
+}
+
+//record запись сервиса; для данных указываются идентификатор объекта и время
+func (T *EGTS) record(service byte, oid uint32, tm time.Time, rd []byte) []byte {
+	b := make([]byte, 5, 15+len(rd))
+	binary.LittleEndian.PutUint16(b, uint16(len(rd)))
+	binary.LittleEndian.PutUint16(b[2:], T.rn)
+	T.rn++
+	if !tm.IsZero() {
+		b[4] = 0x05 //OBFE, TMFE
+		b = append(b, make([]byte, 8)...)
+		binary.LittleEndian.PutUint32(b[5:], oid)
+		binary.LittleEndian.PutUint32(b[9:], uint32(tm.Sub(egtsEpoch)/time.Second))
+	}
+	b = append(b, service, service)
+	return append(b, rd...)
+}
+
+func subrecord(srt byte, srd []byte) []byte {
+	return append([]byte{srt, byte(len(srd)), byte(len(srd) >> 8)}, srd...)
+}
+
+func egtsRecordData(d models.GPSData) []byte {
+	var buf bytes.Buffer
+	b := make([]byte, 4)
+
+	pos := make([]byte, 0, 24)
+	binary.LittleEndian.PutUint32(b, uint32(d.DateTime.Sub(egtsEpoch)/time.Second))
+	pos = append(pos, b...)
+	binary.LittleEndian.PutUint32(b, uint32(math.Round(math.Abs(d.Lat)/90*0xFFFFFFFF)))
+	pos = append(pos, b...)
+	binary.LittleEndian.PutUint32(b, uint32(math.Round(math.Abs(d.Lng)/180*0xFFFFFFFF)))
+	pos = append(pos, b...)
+
+	//координаты достоверны, есть высота
+	flg := byte(0x81)
+	if d.Lat < 0 {
+		flg |= 0x20
+	}
+	if d.Lng < 0 {
+		flg |= 0x40
+	}
+	if d.Speed > 0 {
+		flg |= 0x10
+	}
+	pos = append(pos, flg)
+
+	spd := uint16(d.Speed*10)&0x3FFF | uint16(d.Angle>>8&1)<<15
+	alt := d.Alt
+	if alt < 0 {
+		spd |= 0x4000
+		alt = -alt
+	}
+	binary.LittleEndian.PutUint16(b, spd)
+	pos = append(pos, b[:2]...)
+	pos = append(pos, byte(d.Angle))
+	pos = append(pos, 0, 0, 0) //ODM
+	pos = append(pos, 0, 0)    //DIN, SRC
+	pos = append(pos, byte(alt), byte(alt>>8), byte(alt>>16))
+	buf.Write(subrecord(egtsSRPosData, pos))
+
+	buf.Write(subrecord(egtsSRExtPosData, []byte{0x08, byte(d.Sat)}))
+
+	if d.UseDut {
+		for i, v := range []int64{d.Dut1, d.Dut2} {
+			lls := []byte{byte(i + 1), 0, 0, 0, 0, 0, 0}
+			binary.LittleEndian.PutUint32(lls[3:], uint32(v))
+			buf.Write(subrecord(egtsSRLiquidLevel, lls))
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,192 @@
+package retranslator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/clients"
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/hash"
+	"gps_clients/server_gps_service/models"
+	"gps_clients/server_gps_service/registry"
+)
+
+//egtsSFRD проверка заголовка транспортного пакета, CRC8 заголовка и CRC16 данных
+func egtsSFRD(t *testing.T, b []byte) []byte {
+	if len(b) < 11 || b[0] != 0x01 || b[3] != 11 {
+		t.Fatalf("bad header %x", b)
+	}
+	if crc := hash.CheckSumCRC8(b[:10]); crc != b[10] {
+		t.Fatalf("header crc %02x, want %02x", b[10], crc)
+	}
+	fdl := int(binary.LittleEndian.Uint16(b[5:7]))
+	if len(b) != 11+fdl+2 {
+		t.Fatalf("length %d, want %d", len(b), 11+fdl+2)
+	}
+	sfrd := b[11 : 11+fdl]
+	if crc := hash.CheckSumCRC16CCITT(sfrd); binary.LittleEndian.Uint16(b[11+fdl:]) != crc {
+		t.Fatalf("data crc %x, want %04x", b[11+fdl:], crc)
+	}
+	return sfrd
+}
+
+//TestEGTSEncode идентификатор терминала для IMEI берется из настройки, пакеты принимаются разборщиком сервера
+func TestEGTSEncode(t *testing.T) {
+	const imei = "868204005647838"
+	enc := &EGTS{tid: 100500}
+
+	login := enc.Login(imei, "")
+	sfrd := egtsSFRD(t, login)
+	//запись без OID и времени, сервис авторизации, EGTS_SR_TERM_IDENTITY: TID, флаги, IMEI
+	srd := sfrd[7+3:]
+	if sfrd[4] != 0 || sfrd[5] != egtsAuthService || sfrd[7] != egtsSRTermIdentity ||
+		binary.LittleEndian.Uint32(srd) != 100500 || srd[4] != 0x02 || string(srd[5:]) != imei {
+		t.Fatalf("login %x", sfrd)
+	}
+
+	tm := time.Date(2025, 9, 18, 10, 20, 30, 0, time.UTC)
+	data := []models.GPSData{
+		{DateTime: tm, Lat: 55.752, Lng: 37.6175, Alt: 150, Angle: 300, Sat: 8, Speed: 60},
+		{DateTime: tm.Add(time.Second), Lat: -33.8688, Lng: -151.2093, Alt: -5, Angle: 90, Sat: 9, Speed: 0},
+	}
+	packet := enc.Encode(data)
+	sfrd = egtsSFRD(t, packet)
+	//OBFE и TMFE: OID - идентификатор терминала, не имя устройства
+	if sfrd[4] != 0x05 || binary.LittleEndian.Uint32(sfrd[5:9]) != 100500 ||
+		binary.LittleEndian.Uint32(sfrd[9:13]) != uint32(tm.Sub(egtsEpoch)/time.Second) {
+		t.Fatalf("record %x", sfrd[:15])
+	}
+
+	p := &clients.EGTS{}
+	p.Path = t.TempDir() + "/"
+	p.Input = append(login, packet...)
+	if err := p.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GPS.Name != imei {
+		t.Fatalf("name %q", p.GPS.Name)
+	}
+	got, want := p.GPS.GpsD, data[1]
+	if !got.DateTime.Equal(want.DateTime) || math.Abs(got.Lat-want.Lat) > 1e-6 || math.Abs(got.Lng-want.Lng) > 1e-6 ||
+		got.Alt != want.Alt || got.Angle != want.Angle || got.Sat != want.Sat || got.Speed != want.Speed {
+		t.Fatalf("decoded %+v, want %+v", got, want)
+	}
+
+	//ответы сервера: подтверждение входа с кодом результата, затем подтверждение данных
+	enc.sent, enc.first = 0, 0
+	r := bufio.NewReader(bytes.NewReader(p.GPS.CountData))
+	if err := enc.ChkLogin(r); err != nil {
+		t.Fatalf("login answer: %v", err)
+	}
+	enc.sent, enc.first = 1, 1
+	if err := enc.ChkAck(r, len(data)); err != nil {
+		t.Fatalf("data answer: %v", err)
+	}
+	//подтверждение кода результата уходит со следующими данными
+	if len(enc.ack) == 0 {
+		t.Fatal("result code not acknowledged")
+	}
+}
+
+//TestEGTSChkAck записи подтверждаются по порядку: принятые до первой ошибки не отправляются повторно
+func TestEGTSChkAck(t *testing.T) {
+	tests := []struct {
+		statuses []byte //результаты записей с номерами 10, 11, ...
+		count    int
+		rejected bool
+		accepted int //>0 - частичное подтверждение
+		fail     bool
+	}{
+		{statuses: []byte{0, 0, 0}, count: 3},
+		{statuses: []byte{131, 0, 0}, count: 3, rejected: true},
+		{statuses: []byte{0, 0, 131}, count: 3, accepted: 2},
+		{statuses: []byte{0, 131, 0}, count: 3, accepted: 1},
+		{statuses: []byte{0, 0}, count: 3, accepted: 2},
+		{statuses: []byte{0, 0, 0, 0}, count: 3, fail: true},
+	}
+	for _, tt := range tests {
+		srv := &EGTS{pid: 7}
+		answer := []byte{5, 0, 0}
+		for i, status := range tt.statuses {
+			rn := 10 + i
+			answer = append(answer, srv.record(egtsTeledataService, 0, time.Time{},
+				subrecord(egtsSRRecordResponse, []byte{byte(rn), byte(rn >> 8), status}))...)
+		}
+		enc := &EGTS{sent: 5, first: 10}
+		err := enc.ChkAck(bufio.NewReader(bytes.NewReader(srv.packet(egtsPTResponse, answer))), tt.count)
+
+		var partial *PartialError
+		switch {
+		case tt.rejected:
+			if !errors.Is(err, ErrRejected) {
+				t.Errorf("%v: want ErrRejected, got %v", tt.statuses, err)
+			}
+		case tt.accepted > 0:
+			if !errors.As(err, &partial) || partial.Accepted != tt.accepted || partial.Count != tt.count {
+				t.Errorf("%v: want partial, got %v", tt.statuses, err)
+			}
+		case tt.fail:
+			if err == nil || errors.Is(err, ErrRejected) || errors.As(err, &partial) {
+				t.Errorf("%v: want retry error, got %v", tt.statuses, err)
+			}
+		default:
+			if err != nil {
+				t.Errorf("%v: %v", tt.statuses, err)
+			}
+		}
+	}
+}
+
+//TestEGTSTerminalID без идентификатора терминала данные устройства не ретранслируются
+func TestEGTSTerminalID(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "devices.json")
+	if err := ioutil.WriteFile(file, []byte(`[{"id": "356307042441013", "terminalId": 8}, {"id": "868204005647838"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	devices, err := registry.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ids  map[string]uint32
+		name string
+		tid  uint32 //0 - не ретранслируется
+	}{
+		//настройка ретранслятора раньше реестра
+		{map[string]uint32{"356307042441013": 7}, "356307042441013", 7},
+		{nil, "356307042441013", 8},
+		{map[string]uint32{"dev1": 9}, "dev1", 9},
+		{nil, "868204005647838", 0},
+		{nil, "868204005647839", 0},
+	}
+	for _, tt := range tests {
+		m, err := New([]config.Retranslator{{Name: "egts", Addr: "127.0.0.1:1", Protocol: "egts", TerminalIDs: tt.ids}},
+			t.TempDir(), devices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := m.targets[0].worker(tt.name)
+		m.Close()
+		if tt.tid == 0 {
+			if !errors.Is(err, ErrNoTerminalID) {
+				t.Errorf("%s: %v, want ErrNoTerminalID", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tid := w.enc.(*EGTS).tid; tid != tt.tid {
+			t.Errorf("%s: tid %d, want %d", tt.name, tid, tt.tid)
+		}
+	}
+}
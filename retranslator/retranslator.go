@@ -0,0 +1,396 @@
+package retranslator
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/logger"
+	"gps_clients/server_gps_service/models"
+	"gps_clients/server_gps_service/queue"
+	"gps_clients/server_gps_service/registry"
+	"gps_clients/server_gps_service/utils"
+)
+
+//ErrRejected принимающий сервер отклонил данные, повторная отправка не поможет
+var ErrRejected = errors.New("data rejected by server")
+
+//ErrNoTerminalID для устройства не задан идентификатор терминала EGTS, данные не ретранслируются
+var ErrNoTerminalID = errors.New("no egts terminal id")
+
+//PartialError принимающий сервер принял только первые Accepted записей пакета
+type PartialError struct {
+	Accepted int
+	Count    int
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("accepted %d of %d", e.Accepted, e.Count)
+}
+
+const (
+	maxBatch       = 50
+	minBackoff     = time.Second
+	idleClose      = 5 * time.Minute
+	defaultTimeout = 30 * time.Second
+	defaultBackoff = 5 * time.Minute
+)
+
+//Batch пакет записей одного устройства в очереди ретрансляции
+type Batch struct {
+	Name string           `json:"name"`
+	Data []models.GPSData `json:"data"`
+}
+
+//Encoder кодирование данных в протокол принимающего сервера
+type Encoder interface {
+	Login(name, password string) []byte
+	ChkLogin(r *bufio.Reader) error
+	Encode(data []models.GPSData) []byte
+	ChkAck(r *bufio.Reader, count int) error
+}
+
+func newEncoder(cfg config.Retranslator) (Encoder, error) {
+	switch strings.ToLower(cfg.Protocol) {
+	case "", "wialon", "wialonips":
+		return &WialonIPS{}, nil
+	case "teltonika", "codec8":
+		return NewTeltonika(cfg.IOMap)
+	case "egts":
+		return &EGTS{}, nil
+	default:
+		return nil, fmt.Errorf("unknown retranslator protocol %s", cfg.Protocol)
+	}
+}
+
+//Check проверка протокола и таблицы IO ID ретранслятора
+func Check(cfg config.Retranslator) error {
+	_, err := newEncoder(cfg)
+	return err
+}
+
+//Manager ретрансляция принятых записей на все настроенные сервера
+type Manager struct {
+	targets []*target
+}
+
+//New запускает ретрансляцию, очереди хранятся в path/Retranslator.
+//Из реестра devices берутся идентификаторы терминалов EGTS.
+func New(cfgs []config.Retranslator, path string, devices *registry.Registry) (*Manager, error) {
+	if path == "" {
+		path = utils.GetPathWhereExe()
+	}
+
+	m := &Manager{}
+	for _, c := range cfgs {
+		if c.Name == "" || c.Addr == "" {
+			m.Close()
+			return nil, errors.New("retranslator: empty name or addr")
+		}
+		if _, err := newEncoder(c); err != nil {
+			m.Close()
+			return nil, err
+		}
+
+		t := &target{
+			cfg:        c,
+			devices:    devices,
+			dir:        filepath.Join(path, "Retranslator", c.Name),
+			timeout:    defaultTimeout,
+			maxBackoff: defaultBackoff,
+			workers:    make(map[string]*worker),
+			stop:       make(chan struct{}),
+		}
+		if c.Timeout > 0 {
+			t.timeout = time.Duration(c.Timeout) * time.Second
+		}
+		if c.MaxBackoff > 0 {
+			t.maxBackoff = time.Duration(c.MaxBackoff) * time.Second
+		}
+		if err := t.restore(); err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.targets = append(m.targets, t)
+	}
+	return m, nil
+}
+
+//Accepted ставит принятые записи в очереди подходящих серверов
+func (m *Manager) Accepted(g models.GPSInfo, data []models.GPSData) {
+	name := g.Name
+	for _, t := range m.targets {
+		if !t.match(name) {
+			continue
+		}
+		w, err := t.worker(name)
+		if err != nil {
+			logger.With(logger.Fields{Device: name}).Error("retranslator %s: %v", t.cfg.Name, err)
+			continue
+		}
+		//записи делятся на пакеты отдельно для каждого сервера
+		rest := data
+		for len(rest) > 0 {
+			n := len(rest)
+			if n > maxBatch {
+				n = maxBatch
+			}
+			if err := w.queue.Push(Batch{Name: name, Data: rest[:n]}); err != nil {
+				logger.With(logger.Fields{Device: name}).Error("retranslator %s: %v", t.cfg.Name, err)
+				break
+			}
+			rest = rest[n:]
+		}
+	}
+}
+
+//Rejected отклоненные записи не ретранслируются
+func (m *Manager) Rejected(g models.GPSInfo, list []models.GPSInfo) {}
+
+//Event события не ретранслируются
+func (m *Manager) Event(e models.Event) {}
+
+//Close останавливает ретрансляцию, неотправленные данные остаются на диске
+func (m *Manager) Close() {
+	for _, t := range m.targets {
+		close(t.stop)
+		t.wg.Wait()
+	}
+}
+
+type target struct {
+	cfg        config.Retranslator
+	devices    *registry.Registry
+	dir        string
+	timeout    time.Duration
+	maxBackoff time.Duration
+
+	mu      sync.Mutex
+	workers map[string]*worker
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func matchList(list []string, name string) bool {
+	for _, p := range list {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *target) match(name string) bool {
+	if len(t.cfg.Devices) > 0 && !matchList(t.cfg.Devices, name) {
+		return false
+	}
+	return !matchList(t.cfg.Exclude, name)
+}
+
+//terminalID идентификатор терминала EGTS: из настройки ретранслятора, затем из реестра устройств
+func (t *target) terminalID(name string) (uint32, bool) {
+	if id, ok := t.cfg.TerminalIDs[name]; ok && id != 0 {
+		return id, true
+	}
+	if d, ok := t.devices.Get(name); ok && d.TerminalID != 0 {
+		return d.TerminalID, true
+	}
+	return 0, false
+}
+
+//restore запускает отправку очередей, оставшихся с прошлого запуска
+func (t *target) restore() error {
+	dirs, err := ioutil.ReadDir(t.dir)
+	if err != nil {
+		if ok, _ := utils.Exists(t.dir); !ok {
+			return nil
+		}
+		return err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		name, err := hex.DecodeString(d.Name())
+		if err != nil {
+			continue
+		}
+		if _, err := t.worker(string(name)); errors.Is(err, ErrNoTerminalID) {
+			//очередь остается на диске до настройки идентификатора
+			logger.With(logger.Fields{Device: string(name)}).Warn("retranslator %s: %v", t.cfg.Name, err)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *target) worker(name string) (*worker, error) {
+	defer t.mu.Unlock()
+	t.mu.Lock()
+
+	if w, ok := t.workers[name]; ok {
+		return w, nil
+	}
+
+	enc, err := newEncoder(t.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := enc.(*EGTS); ok {
+		tid, ok := t.terminalID(name)
+		if !ok {
+			return nil, ErrNoTerminalID
+		}
+		e.tid = tid
+	}
+
+	q, err := queue.Open(filepath.Join(t.dir, hex.EncodeToString([]byte(name))), t.cfg.MaxQueue)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &worker{t: t, name: name, enc: enc, queue: q}
+	t.workers[name] = w
+	t.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+type worker struct {
+	t     *target
+	name  string
+	enc   Encoder
+	queue *queue.Queue
+
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func (w *worker) log() logger.Entry {
+	return logger.With(logger.Fields{Device: w.name})
+}
+
+func (w *worker) run() {
+	defer w.t.wg.Done()
+	defer w.close()
+
+	backoff := minBackoff
+	idle := time.NewTimer(idleClose)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-w.t.stop:
+			return
+		default:
+		}
+
+		var b Batch
+		id, err := w.queue.Peek(&b)
+		if err == queue.ErrEmpty {
+			select {
+			case <-w.queue.Wait():
+			case <-idle.C:
+				w.close()
+				idle.Reset(idleClose)
+			case <-w.t.stop:
+				return
+			}
+			continue
+		}
+		if err != nil {
+			w.log().Error("retranslator %s: bad queue item %d: %v", w.t.cfg.Name, id, err)
+			w.queue.Remove(id)
+			continue
+		}
+
+		err = w.send(b.Data)
+		var partial *PartialError
+		if errors.As(err, &partial) && partial.Accepted > 0 && partial.Accepted < len(b.Data) {
+			//непринятый остаток остается в очереди на месте пакета
+			w.log().Warn("retranslator %s: %v, rest requeued", w.t.cfg.Name, err)
+			if err := w.queue.Replace(id, Batch{Name: b.Name, Data: b.Data[partial.Accepted:]}); err != nil {
+				w.log().Error("retranslator %s: %v", w.t.cfg.Name, err)
+			}
+			backoff = minBackoff
+			continue
+		}
+		if err == nil || errors.Is(err, ErrRejected) {
+			if err != nil {
+				w.log().Warn("retranslator %s: %v", w.t.cfg.Name, err)
+			}
+			w.queue.Remove(id)
+			backoff = minBackoff
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(idleClose)
+			continue
+		}
+
+		w.log().Error("retranslator %s: %v, retry in %s", w.t.cfg.Name, err, backoff)
+		w.close()
+		select {
+		case <-time.After(backoff):
+		case <-w.t.stop:
+			return
+		}
+		backoff *= 2
+		if backoff > w.t.maxBackoff {
+			backoff = w.t.maxBackoff
+		}
+	}
+}
+
+func (w *worker) connect() error {
+	c, err := net.DialTimeout("tcp", w.t.cfg.Addr, w.t.timeout)
+	if err != nil {
+		return err
+	}
+	w.conn = c
+	w.rd = bufio.NewReader(c)
+
+	w.conn.SetDeadline(time.Now().Add(w.t.timeout))
+	if _, err := w.conn.Write(w.enc.Login(w.name, w.t.cfg.Password)); err != nil {
+		return err
+	}
+	if err := w.enc.ChkLogin(w.rd); err != nil {
+		return fmt.Errorf("login: %v", err)
+	}
+	return nil
+}
+
+func (w *worker) send(data []models.GPSData) error {
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+
+	w.conn.SetDeadline(time.Now().Add(w.t.timeout))
+	if _, err := w.conn.Write(w.enc.Encode(data)); err != nil {
+		return err
+	}
+	return w.enc.ChkAck(w.rd, len(data))
+}
+
+func (w *worker) close() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+		w.rd = nil
+	}
+}
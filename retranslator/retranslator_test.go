@@ -0,0 +1,60 @@
+package retranslator
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/models"
+)
+
+//TestAcceptedAllTargets каждый сервер получает все записи, а не остаток после предыдущего
+func TestAcceptedAllTargets(t *testing.T) {
+	//закрытый порт: записи остаются в очередях
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	m, err := New([]config.Retranslator{
+		{Name: "first", Addr: addr, Protocol: "wialon"},
+		{Name: "second", Addr: addr, Protocol: "wialon"},
+	}, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	tm := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	var data []models.GPSData
+	for i := 0; i < maxBatch+10; i++ {
+		data = append(data, models.GPSData{DateTime: tm.Add(time.Duration(i) * time.Second), Lat: 55.7, Lng: 37.6, Sat: 8})
+	}
+	m.Accepted(models.GPSInfo{Name: "dev1"}, data)
+
+	for _, tg := range m.targets {
+		w, err := tg.worker("dev1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, items, err := w.queue.PeekN(10)
+		if err != nil {
+			t.Fatalf("%s: %v", tg.cfg.Name, err)
+		}
+		var count int
+		for _, item := range items {
+			var b Batch
+			if err := json.Unmarshal(item, &b); err != nil {
+				t.Fatal(err)
+			}
+			count += len(b.Data)
+		}
+		if len(items) != 2 || count != len(data) {
+			t.Errorf("%s: %d batches, %d records, want 2 and %d", tg.cfg.Name, len(items), count, len(data))
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package retranslator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/hash"
+	"gps_clients/server_gps_service/models"
+)
+
+//DefaultIOMap соответствие типизированных датчиков IO ID по умолчанию
+var DefaultIOMap = []config.IOElement{
+	{Param: "AccV", ID: 66, Size: 2, Scale: 1000},
+	{Param: "BatV", ID: 67, Size: 2, Scale: 1000},
+	{Param: "TempC", ID: 72, Size: 4, Scale: 10},
+	{Param: "Dut1", ID: 201, Size: 2, Scale: 1},
+	{Param: "Dut2", ID: 203, Size: 2, Scale: 1},
+}
+
+//Teltonika кодирование в протокол Teltonika Codec 8
+type Teltonika struct {
+	ioMap []config.IOElement
+}
+
+//NewTeltonika создает кодировщик с таблицей IO ID (пустая - DefaultIOMap)
+func NewTeltonika(ioMap []config.IOElement) (*Teltonika, error) {
+	if len(ioMap) == 0 {
+		ioMap = DefaultIOMap
+	}
+	for _, v := range ioMap {
+		if v.ID < 0 || v.ID > 255 {
+			return nil, fmt.Errorf("teltonika io %s: id %d out of range", v.Param, v.ID)
+		}
+		switch v.Size {
+		case 1, 2, 4, 8:
+		default:
+			return nil, fmt.Errorf("teltonika io %s: bad size %d", v.Param, v.Size)
+		}
+	}
+	return &Teltonika{ioMap: ioMap}, nil
+}
+
+func (T *Teltonika) Login(name, password string) []byte {
+	b := make([]byte, 2, len(name)+2)
+	binary.BigEndian.PutUint16(b, uint16(len(name)))
+	return append(b, name...)
+}
+
+func (T *Teltonika) ChkLogin(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b != 1 {
+		return fmt.Errorf("login rejected: %d", b)
+	}
+	return nil
+}
+
+func (T *Teltonika) ChkAck(r *bufio.Reader, count int) error {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(b)
+	if n == 0 {
+		return fmt.Errorf("%w: accepted 0 of %d", ErrRejected, count)
+	}
+	if int(n) < count {
+		//записи принимаются по порядку, остаток пакета отправляется повторно
+		return &PartialError{Accepted: int(n), Count: count}
+	}
+	if int(n) != count {
+		return fmt.Errorf("accepted %d of %d", n, count)
+	}
+	return nil
+}
+
+func (T *Teltonika) Encode(data []models.GPSData) []byte {
+	var body bytes.Buffer
+	body.WriteByte(0x08)
+	body.WriteByte(byte(len(data)))
+	for _, d := range data {
+		T.writeRecord(&body, d)
+	}
+	body.WriteByte(byte(len(data)))
+
+	packet := make([]byte, 8, body.Len()+12)
+	binary.BigEndian.PutUint32(packet[4:], uint32(body.Len()))
+	packet = append(packet, body.Bytes()...)
+
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, uint32(hash.CheckSumCRC16(body.Bytes())))
+	return append(packet, crc...)
+}
+
+type ioValue struct {
+	id    byte
+	value uint64
+}
+
+func (T *Teltonika) typedValue(d models.GPSData, param string) (float64, bool) {
+	switch param {
+	case "AccV":
+		return d.AccV, true
+	case "BatV":
+		return d.BatV, true
+	case "TempC":
+		return d.TempC, d.UseTempC
+	case "Dut1":
+		return float64(d.Dut1), d.UseDut
+	case "Dut2":
+		return float64(d.Dut2), d.UseDut
+	}
+	for _, p := range d.Params() {
+		if p.Name != param {
+			continue
+		}
+		v, err := strconv.ParseFloat(p.Value, 64)
+		return v, err == nil
+	}
+	return 0, false
+}
+
+//ioGroups раскладывает датчики записи по группам 1, 2, 4, 8 байт
+func (T *Teltonika) ioGroups(d models.GPSData) [4][]ioValue {
+	var groups [4][]ioValue
+	used := make(map[int]bool)
+
+	for _, m := range T.ioMap {
+		v, ok := T.typedValue(d, m.Param)
+		if !ok || used[m.ID] {
+			continue
+		}
+		scale := m.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		used[m.ID] = true
+		value := uint64(int64(math.Round(v * scale)))
+		groups[sizeGroup(m.Size)] = append(groups[sizeGroup(m.Size)], ioValue{id: byte(m.ID), value: value})
+	}
+
+	//параметры вида "id 239=1;" полученные от Teltonika-подобных трекеров передаются как есть
+	for _, p := range d.Params() {
+		if !strings.HasPrefix(p.Name, "id") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(p.Name, "id"))
+		if err != nil || id < 0 || id > 255 || used[id] {
+			continue
+		}
+		v, err := strconv.ParseInt(p.Value, 10, 64)
+		if err != nil {
+			continue
+		}
+		used[id] = true
+		size := 8
+		switch {
+		case v >= 0 && v <= math.MaxUint8:
+			size = 1
+		case v >= 0 && v <= math.MaxUint16:
+			size = 2
+		case v >= math.MinInt32 && v <= math.MaxUint32:
+			size = 4
+		}
+		groups[sizeGroup(size)] = append(groups[sizeGroup(size)], ioValue{id: byte(id), value: uint64(v)})
+	}
+	return groups
+}
+
+func sizeGroup(size int) int {
+	switch size {
+	case 1:
+		return 0
+	case 2:
+		return 1
+	case 4:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func (T *Teltonika) writeRecord(buf *bytes.Buffer, d models.GPSData) {
+	b := make([]byte, 8)
+
+	binary.BigEndian.PutUint64(b, uint64(d.DateTime.UnixNano()/1e6))
+	buf.Write(b)
+	buf.WriteByte(0) //Prioritet
+
+	binary.BigEndian.PutUint32(b, uint32(int32(math.Round(d.Lng*10000000))))
+	buf.Write(b[:4])
+	binary.BigEndian.PutUint32(b, uint32(int32(math.Round(d.Lat*10000000))))
+	buf.Write(b[:4])
+	binary.BigEndian.PutUint16(b, uint16(d.Alt))
+	buf.Write(b[:2])
+	binary.BigEndian.PutUint16(b, uint16(d.Angle))
+	buf.Write(b[:2])
+	buf.WriteByte(byte(d.Sat))
+	binary.BigEndian.PutUint16(b, uint16(d.Speed))
+	buf.Write(b[:2])
+
+	groups := T.ioGroups(d)
+	total := 0
+	for _, g := range groups {
+		total += len(g)
+	}
+
+	buf.WriteByte(0) //Event IO ID
+	buf.WriteByte(byte(total))
+	for i, g := range groups {
+		size := 1 << uint(i)
+		buf.WriteByte(byte(len(g)))
+		for _, v := range g {
+			buf.WriteByte(v.id)
+			binary.BigEndian.PutUint64(b, v.value)
+			buf.Write(b[8-size:])
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package retranslator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/clients"
+	"gps_clients/server_gps_service/hash"
+	"gps_clients/server_gps_service/models"
+)
+
+//TestTeltonikaRoundTrip пакет кодировщика принимается разборщиком сервера
+func TestTeltonikaRoundTrip(t *testing.T) {
+	tm := time.Date(2025, 9, 18, 10, 20, 30, 0, time.UTC)
+	data := []models.GPSData{
+		{DateTime: tm, Lat: 55.7520, Lng: 37.6175, Alt: 150, Angle: 90, Sat: 8, Speed: 10, AccV: 12.5},
+		{DateTime: tm.Add(time.Second), Lat: 55.7521, Lng: 37.6176, Alt: 151, Angle: 91, Sat: 9, Speed: 11, AccV: 12.6},
+	}
+
+	enc, err := NewTeltonika(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := enc.Encode(data)
+
+	l := binary.BigEndian.Uint32(packet[4:8])
+	if int(l)+12 != len(packet) || packet[8] != 0x08 || packet[9] != 2 || packet[len(packet)-5] != 2 {
+		t.Fatalf("bad packet %x", packet)
+	}
+	if crc := binary.BigEndian.Uint32(packet[len(packet)-4:]); crc != uint32(hash.CheckSumCRC16(packet[8:8+l])) {
+		t.Fatalf("crc %x", crc)
+	}
+
+	p := &clients.Teltonika{}
+	p.GPS.Name = "356307042441013"
+	p.Path = t.TempDir() + "/"
+	p.Input = packet
+	if err := p.ParseData(); err != nil {
+		t.Fatal(err)
+	}
+	if string(p.GPS.CountData) != "\x00\x00\x00\x02" {
+		t.Fatalf("ack %x", p.GPS.CountData)
+	}
+	got, want := p.GPS.GpsD, data[1]
+	if !got.DateTime.Equal(want.DateTime) || math.Abs(got.Lat-want.Lat) > 1e-6 || math.Abs(got.Lng-want.Lng) > 1e-6 ||
+		got.Alt != want.Alt || got.Angle != want.Angle || got.Sat != want.Sat || got.Speed != want.Speed || got.AccV != want.AccV {
+		t.Fatalf("decoded %+v, want %+v", got, want)
+	}
+}
+
+func TestTeltonikaChkAck(t *testing.T) {
+	tests := []struct {
+		answer   uint32
+		count    int
+		rejected bool
+		accepted int //>0 - частичное подтверждение
+		fail     bool
+	}{
+		{answer: 3, count: 3},
+		{answer: 0, count: 3, rejected: true},
+		{answer: 2, count: 3, accepted: 2},
+		{answer: 4, count: 3, fail: true},
+	}
+	for _, tt := range tests {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, tt.answer)
+		err := (&Teltonika{}).ChkAck(bufio.NewReader(bytes.NewReader(b)), tt.count)
+
+		var partial *PartialError
+		switch {
+		case tt.rejected:
+			if !errors.Is(err, ErrRejected) {
+				t.Errorf("%d of %d: want ErrRejected, got %v", tt.answer, tt.count, err)
+			}
+		case tt.accepted > 0:
+			if !errors.As(err, &partial) || partial.Accepted != tt.accepted || partial.Count != tt.count {
+				t.Errorf("%d of %d: want partial, got %v", tt.answer, tt.count, err)
+			}
+		case tt.fail:
+			if err == nil || errors.Is(err, ErrRejected) || errors.As(err, &partial) {
+				t.Errorf("%d of %d: want retry error, got %v", tt.answer, tt.count, err)
+			}
+		default:
+			if err != nil {
+				t.Errorf("%d of %d: %v", tt.answer, tt.count, err)
+			}
+		}
+	}
+	//обрыв ответа
+	if err := (&Teltonika{}).ChkAck(bufio.NewReader(bytes.NewReader([]byte{0, 0})), 1); err == nil {
+		t.Error("short answer accepted")
+	}
+}
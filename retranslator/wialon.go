@@ -0,0 +1,148 @@
+package retranslator
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gps_clients/server_gps_service/models"
+)
+
+//WialonIPS кодирование в протокол Wialon IPS 1.1
+type WialonIPS struct{}
+
+func (w *WialonIPS) Login(name, password string) []byte {
+	if password == "" {
+		password = "NA"
+	}
+	return []byte(fmt.Sprintf("#L#%s;%s\r\n", name, password))
+}
+
+func (w *WialonIPS) ChkLogin(r *bufio.Reader) error {
+	code, err := readWialonAnswer(r, "#AL#")
+	if err != nil {
+		return err
+	}
+	switch code {
+	case "1":
+		return nil
+	case "01":
+		return fmt.Errorf("wrong password")
+	default:
+		return fmt.Errorf("login rejected: #AL#%s", code)
+	}
+}
+
+func (w *WialonIPS) Encode(data []models.GPSData) []byte {
+	if len(data) == 1 {
+		return []byte("#D#" + wialonRecord(data[0]) + "\r\n")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("#B#")
+	for i, d := range data {
+		if i > 0 {
+			sb.WriteString("|")
+		}
+		sb.WriteString(wialonRecord(d))
+	}
+	sb.WriteString("\r\n")
+	return []byte(sb.String())
+}
+
+func (w *WialonIPS) ChkAck(r *bufio.Reader, count int) error {
+	prefix := "#AD#"
+	if count > 1 {
+		prefix = "#AB#"
+	}
+
+	code, err := readWialonAnswer(r, prefix)
+	if err != nil {
+		return err
+	}
+
+	if count > 1 {
+		n, err := strconv.Atoi(code)
+		if err != nil {
+			return fmt.Errorf("bad answer %s%s", prefix, code)
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: %s%s", ErrRejected, prefix, code)
+		}
+		if n < count {
+			//записи принимаются по порядку, остаток пакета отправляется повторно
+			return &PartialError{Accepted: n, Count: count}
+		}
+		return nil
+	}
+
+	if code != "1" {
+		return fmt.Errorf("%w: %s%s", ErrRejected, prefix, code)
+	}
+	return nil
+}
+
+func readWialonAnswer(r *bufio.Reader, prefix string) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, prefix) {
+		return "", fmt.Errorf("unexpected answer %q, want %s", line, prefix)
+	}
+	return strings.TrimPrefix(line, prefix), nil
+}
+
+//wialonCoord градусы в формат DDMM.MMMM с полушарием
+func wialonCoord(v float64, digits int, pos, neg string) string {
+	hemi := pos
+	if v < 0 {
+		hemi = neg
+		v = -v
+	}
+	deg := math.Floor(v)
+	min := (v - deg) * 60
+	return fmt.Sprintf("%0*d%07.4f;%s", digits, int(deg), min, hemi)
+}
+
+func wialonRecord(d models.GPSData) string {
+	var params []string
+	params = append(params,
+		fmt.Sprintf("accv:2:%.2f", d.AccV),
+		fmt.Sprintf("batv:2:%.2f", d.BatV))
+	if d.UseTempC {
+		params = append(params, fmt.Sprintf("temp:2:%.1f", d.TempC))
+	}
+	if d.UseDut {
+		params = append(params,
+			fmt.Sprintf("dut1:1:%d", d.Dut1),
+			fmt.Sprintf("dut2:1:%d", d.Dut2))
+	}
+	for _, p := range d.Params() {
+		name := strings.NewReplacer(",", "", ":", "", ";", "", "|", "").Replace(p.Name)
+		if _, err := strconv.ParseInt(p.Value, 10, 64); err == nil {
+			params = append(params, fmt.Sprintf("%s:1:%s", name, p.Value))
+		} else if _, err := strconv.ParseFloat(p.Value, 64); err == nil {
+			params = append(params, fmt.Sprintf("%s:2:%s", name, p.Value))
+		} else {
+			value := strings.NewReplacer(",", " ", ";", " ", "|", " ").Replace(p.Value)
+			params = append(params, fmt.Sprintf("%s:3:%s", name, value))
+		}
+	}
+
+	t := d.DateTime.UTC()
+	//date;time;lat1;lat2;lon1;lon2;speed;course;alt;sats;hdop;inputs;outputs;adc;ibutton;params
+	return fmt.Sprintf("%s;%s;%s;%s;%d;%d;%d;%d;NA;NA;NA;;NA;%s",
+		t.Format("020106"),
+		t.Format("150405"),
+		wialonCoord(d.Lat, 2, "N", "S"),
+		wialonCoord(d.Lng, 3, "E", "W"),
+		d.Speed,
+		d.Angle,
+		d.Alt,
+		d.Sat,
+		strings.Join(params, ","))
+}
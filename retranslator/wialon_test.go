@@ -0,0 +1,132 @@
+package retranslator
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/models"
+)
+
+func TestWialonChkAck(t *testing.T) {
+	tests := []struct {
+		answer   string
+		count    int
+		rejected bool
+		accepted int //>0 - частичное подтверждение
+		fail     bool
+	}{
+		{answer: "#AD#1\r\n", count: 1},
+		{answer: "#AD#0\r\n", count: 1, rejected: true},
+		{answer: "#AB#3\r\n", count: 3},
+		{answer: "#AB#0\r\n", count: 3, rejected: true},
+		{answer: "#AB#2\r\n", count: 3, accepted: 2},
+		{answer: "#AB#x\r\n", count: 3, fail: true},
+		{answer: "#AD#1\r\n", count: 3, fail: true},
+	}
+	for _, tt := range tests {
+		w := &WialonIPS{}
+		err := w.ChkAck(bufio.NewReader(strings.NewReader(tt.answer)), tt.count)
+
+		var partial *PartialError
+		switch {
+		case tt.rejected:
+			if !errors.Is(err, ErrRejected) {
+				t.Errorf("%q: want ErrRejected, got %v", tt.answer, err)
+			}
+		case tt.accepted > 0:
+			if !errors.As(err, &partial) || partial.Accepted != tt.accepted || partial.Count != tt.count {
+				t.Errorf("%q: want partial %d of %d, got %v", tt.answer, tt.accepted, tt.count, err)
+			}
+		case tt.fail:
+			if err == nil || errors.Is(err, ErrRejected) || errors.As(err, &partial) {
+				t.Errorf("%q: want retry error, got %v", tt.answer, err)
+			}
+		default:
+			if err != nil {
+				t.Errorf("%q: %v", tt.answer, err)
+			}
+		}
+	}
+}
+
+//TestWialonPartialRequeue непринятый остаток пакета отправляется повторно, а не теряется
+func TestWialonPartialRequeue(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	batches := make(chan int, 4)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		rd := bufio.NewReader(c)
+		for {
+			line, err := rd.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "#L#"):
+				c.Write([]byte("#AL#1\r\n"))
+			case strings.HasPrefix(line, "#B#"):
+				n := strings.Count(line, "|") + 1
+				batches <- n
+				//первый пакет принят частично
+				if n == 3 {
+					c.Write([]byte("#AB#1\r\n"))
+				} else {
+					c.Write([]byte("#AB#" + string(rune('0'+n)) + "\r\n"))
+				}
+			case strings.HasPrefix(line, "#D#"):
+				batches <- 1
+				c.Write([]byte("#AD#1\r\n"))
+			}
+		}
+	}()
+
+	m, err := New([]config.Retranslator{{Name: "test", Addr: ln.Addr().String(), Protocol: "wialon"}}, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	tm := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	var data []models.GPSData
+	for i := 0; i < 3; i++ {
+		data = append(data, models.GPSData{DateTime: tm.Add(time.Duration(i) * time.Second), Lat: 55.7, Lng: 37.6, Sat: 8})
+	}
+	m.Accepted(models.GPSInfo{Name: "dev1"}, data)
+
+	for _, want := range []int{3, 2} {
+		select {
+		case n := <-batches:
+			if n != want {
+				t.Fatalf("batch of %d records, want %d", n, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no batch of %d records", want)
+		}
+	}
+
+	w, err := m.targets[0].worker("dev1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for w.queue.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue not empty: %d", w.queue.Len())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,18 +1,25 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"path"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"gps_clients/server_gps_service/capture"
 	"gps_clients/server_gps_service/clients"
 	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/logger"
 	"gps_clients/server_gps_service/models"
+	"gps_clients/server_gps_service/session"
 	"gps_clients/server_gps_service/utils"
 )
 
@@ -29,92 +36,198 @@ func ParseGPSData(s SrvFuncer) error {
 	return s.ParseData()
 }
 
+//ErrServerClosed сервер остановлен через Shutdown или отмену контекста
+var ErrServerClosed = errors.New("server closed")
+
+//причины срабатывания ограничений, совпадают с параметрами limits конфигурации
+const (
+	limitConns     = "maxConns"
+	limitConnsIP   = "maxConnsPerIp"
+	limitBytes     = "maxBytesPerSec"
+	limitPackets   = "maxPacketsPerSec"
+	limitHandshake = "handshakeTimeout"
+)
+
+//состояния соединения для плавной остановки
+const (
+	connIdle   int32 = iota //ожидание пакета, можно закрыть
+	connActive              //обработка пакета, закрыть после ответа
+)
+
 type Server struct {
 	Addr         string
+	Protocol     string
 	IdleTimeout  time.Duration
 	MaxReadBytes int64
-	LastRequest  time.Time
 
-	GPS map[string]models.GPSInfo
+	mu          sync.Mutex
+	LastRequest time.Time
+	listener    net.Listener
+	conns       map[*conn]struct{}
+	allcons     int
+	limits      config.Limits
+	tls         *certStore
+	perIP       map[string]int64
+	hits        map[string]int64
+
+	inShutdown int32
+}
 
-	listener   net.Listener
-	conns      map[*conn]struct{}
-	allcons    int
-	mu         sync.Mutex
-	inShutdown bool
+func (srv *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&srv.inShutdown) != 0
 }
 
-func (srv *Server) ListenAndServe() error {
+//ListenAndServe открывает порт и принимает соединения до Shutdown или отмены ctx.
+//Ошибка открытия порта возвращается сразу, после остановки - ErrServerClosed.
+func (srv *Server) ListenAndServe(ctx context.Context) error {
 	if srv.Addr == "" {
-		elog.Error(1, "empty port server")
 		return errors.New("empty port server")
 	}
 
-	srv.GPS = make(map[string]models.GPSInfo)
-
 	listen, err := net.Listen("tcp", ":"+srv.Addr)
 	if err != nil {
-		elog.Error(1, srv.Addr+": "+err.Error())
 		return err
 	}
+	if srv.tls != nil {
+		listen = srv.tls.Listener(listen)
+	}
+	return srv.Serve(ctx, listen)
+}
 
-	elog.Info(1, fmt.Sprintf("%s\t tcp client run on %s",
-		time.Now().Local().Format("02.01.2006 15:04:05"),
-		srv.Addr))
+//Serve принимает соединения на listen до Shutdown или отмены ctx
+func (srv *Server) Serve(ctx context.Context, listen net.Listener) error {
+	srv.mu.Lock()
+	srv.listener = listen
+	srv.mu.Unlock()
+	atomic.StoreInt32(&srv.inShutdown, 0)
 
-	defer listen.Close()
+	if httpPort(srv.Protocol) {
+		return srv.serveHTTP(ctx, listen)
+	}
 
-	srv.listener = listen
+	if srv.tls != nil {
+		srv.log().Info("tls client run")
+	} else {
+		srv.log().Info("tcp client run")
+	}
 
-	for {
-		if srv.inShutdown {
-			if len(srv.conns) == 0 {
-				return nil
-			}
-			continue
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&srv.inShutdown, 1)
+			listen.Close()
+		case <-done:
 		}
+	}()
 
+	defer listen.Close()
+
+	var delay time.Duration
+	for {
 		newConn, err := listen.Accept()
 		if err != nil {
-			if srv.inShutdown {
+			if srv.shuttingDown() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				//временная ошибка (нет дескрипторов и т.п.) - повтор с задержкой
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				srv.log().Error("error listen: %v; retrying in %v", err, delay)
+				time.Sleep(delay)
 				continue
 			}
-			elog.Error(1,
-				fmt.Sprintf("%s\t error listen: %s",
-					time.Now().Local().Format("02.01.2006 15:04:05"),
-					srv.Addr+": "+err.Error()))
-
-			//AddToLog(GetProgramPath()+"-error.txt", fmt.Sprint(srv.inShutdown)+" - "+err.Error())
-			continue
+			srv.log().Error("error listen: %v", err)
+			return err
 		}
+		delay = 0
 
 		conn := &conn{
 			Conn:          newConn,
 			IdleTimeout:   srv.IdleTimeout,
 			MaxReadBuffer: srv.MaxReadBytes,
+			ip:            utils.GetIPAdr(newConn.RemoteAddr().String()),
 		}
 
-		srv.addConn(conn)
-		srv.LastRequest = time.Now()
-		conn.SetDeadline(time.Now().Add(conn.IdleTimeout))
+		if reason := srv.addConn(conn); reason != "" {
+			srv.limitHit(reason, srv.log().With(logger.Fields{Remote: newConn.RemoteAddr().String()}))
+			newConn.Close()
+			continue
+		}
+		conn.startHandshake(time.Duration(srv.Limits().HandshakeTimeout) * time.Second)
 		go srv.handle(conn)
 	}
 }
 
-func (srv *Server) addConn(c *conn) {
+//addConn учет нового соединения; непустая причина - соединение не принято из-за ограничения
+func (srv *Server) addConn(c *conn) string {
 	defer srv.mu.Unlock()
 	srv.mu.Lock()
+	if srv.limits.MaxConns > 0 && int64(len(srv.conns)) >= srv.limits.MaxConns {
+		return limitConns
+	}
+	if srv.limits.MaxConnsPerIP > 0 && srv.perIP[c.ip] >= srv.limits.MaxConnsPerIP {
+		return limitConnsIP
+	}
 	if srv.conns == nil {
 		srv.conns = make(map[*conn]struct{})
+		srv.perIP = make(map[string]int64)
 	}
 	srv.conns[c] = struct{}{}
+	srv.perIP[c.ip]++
 	srv.allcons++
+	srv.LastRequest = time.Now()
+	return ""
 }
 
 func (srv *Server) deleteConn(conn *conn) {
 	defer srv.mu.Unlock()
 	srv.mu.Lock()
 	delete(srv.conns, conn)
+	if srv.perIP[conn.ip]--; srv.perIP[conn.ip] <= 0 {
+		delete(srv.perIP, conn.ip)
+	}
+}
+
+//Limits текущие ограничения соединений порта
+func (srv *Server) Limits() config.Limits {
+	defer srv.mu.Unlock()
+	srv.mu.Lock()
+	return srv.limits
+}
+
+//SetLimits замена ограничений без перезапуска порта, действует на новые соединения и пакеты
+func (srv *Server) SetLimits(l config.Limits) {
+	defer srv.mu.Unlock()
+	srv.mu.Lock()
+	srv.limits = l
+}
+
+//limitHit учет и запись в журнал срабатывания ограничения
+func (srv *Server) limitHit(reason string, log logger.Entry) {
+	srv.mu.Lock()
+	if srv.hits == nil {
+		srv.hits = make(map[string]int64)
+	}
+	srv.hits[reason]++
+	srv.mu.Unlock()
+	log.Warn("limit %s exceeded", reason)
+}
+
+//LimitHits число срабатываний ограничений по причинам
+func (srv *Server) LimitHits() map[string]int64 {
+	defer srv.mu.Unlock()
+	srv.mu.Lock()
+	res := make(map[string]int64, len(srv.hits))
+	for k, v := range srv.hits {
+		res[k] = v
+	}
+	return res
 }
 
 //CountLiveConn return count live connects
@@ -131,98 +244,257 @@ func (srv *Server) CountAllConn() int {
 	return srv.allcons
 }
 
-//Shutdown close server
-func (srv *Server) Shutdown() {
-	countForStop := 10
-	srv.inShutdown = true
-	elog.Info(1, srv.Addr+" is shutting down...")
+//closeConns закрывает соединения; all=false - только ожидающие пакета
+func (srv *Server) closeConns(all bool) {
+	defer srv.mu.Unlock()
+	srv.mu.Lock()
+	for c := range srv.conns {
+		if all || atomic.LoadInt32(&c.state) == connIdle {
+			//закрывается только сокет, остальное освобождает handle
+			c.Conn.Close()
+		}
+	}
+}
+
+//Shutdown закрывает порт и соединения, ожидающие пакета; соединения с пакетом
+//в обработке закрываются после ответа. По отмене ctx оставшиеся закрываются принудительно.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&srv.inShutdown, 1)
+	srv.log().Info("shutting down...")
+
+	srv.mu.Lock()
+	if srv.listener != nil {
+		srv.listener.Close()
+	}
+	srv.mu.Unlock()
 
-	srv.listener.Close()
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
+
+	var err error
+	done := ctx.Done()
 	for {
-		<-ticker.C
-		elog.Info(1, fmt.Sprintf("server %s waiting on %v connections", srv.Addr, len(srv.conns)))
+		srv.closeConns(err != nil)
+		n := srv.CountLiveConn()
+		if n == 0 {
+			return err
+		}
 
-		if len(srv.conns) == 0 {
-			return
+		select {
+		case <-ticker.C:
+			srv.log().Info("waiting on %v connections", n)
+		case <-done:
+			srv.log().Info("force close %v connections", n)
+			err = ctx.Err()
+			done = nil
 		}
-		countForStop--
-		if countForStop == 0 {
-			elog.Info(1, srv.Addr+" Force close connections...")
-			for c := range srv.conns {
-				c.Close()
-			}
-			elog.Info(1, srv.Addr+" Force close connections completed")
+	}
+}
+
+//GetGPSList состояние устройств, последний раз подключавшихся к порту
+func (srv *Server) GetGPSList() []models.GPSInfo {
+	return sessions.List(srv.Addr)
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+func matchList(list []string, name string) bool {
+	for _, p := range list {
+		if ok, _ := path.Match(p, name); ok {
+			return true
 		}
 	}
+	return false
 }
 
-func (srv *Server) SetGPS(gps models.GPSInfo) {
-	defer srv.mu.Unlock()
-	srv.mu.Lock()
-	srv.GPS[gps.Name] = gps
+//startCapture запись кадров соединения в <capture.dir>/<sub>/<время>-<порт клиента>.cap
+func (srv *Server) startCapture(c *conn, sub string, log logger.Entry) {
+	cfg := config.Get()
+	dir := cfg.Capture.Dir
+	if dir == "" {
+		dir = cfg.PathToSave
+		if dir == "" {
+			dir = utils.GetPathWhereExe()
+		}
+		dir = filepath.Join(dir, "Capture")
+	}
+
+	name := filepath.Join(dir, sub, fmt.Sprintf("%s-%s.cap",
+		time.Now().Format("20060102-150405"),
+		utils.GetPortAdr(c.Conn.RemoteAddr().String())))
+
+	err := c.startCapture(name, capture.Header{Protocol: srv.Protocol, Port: srv.Addr})
+	if err != nil {
+		log.Error("capture: %v", err)
+		return
+	}
+	log.Info("capture to %s", name)
 }
 
-func (srv *Server) GetGPS(name string) models.GPSInfo {
-	defer srv.mu.Unlock()
-	srv.mu.Lock()
-	if v, ok := srv.GPS[name]; ok {
-		return v
+func (srv *Server) log() logger.Entry {
+	return logger.With(logger.Fields{Port: srv.Addr, Protocol: srv.Protocol})
+}
+
+//deviceCheck проверка (сертификат соединения, реестр) и вход устройства соединения;
+//разборщик вызывает ее через ChkName до сохранения записей.
+//Отказ запоминается, соединение закрывается после разбора пакета.
+//При входе захватывается сессия устройства: записи первого пакета проверяются
+//по последней точке и индексу повторов сессии.
+type deviceCheck struct {
+	srv      *Server
+	conn     *conn
+	gps      *models.ProtocolModel
+	sess     *session.Session
+	prev     string //адрес соединения, вытесненного входом
+	rejected error
+}
+
+func (d *deviceCheck) CheckDevice(name string) error {
+	if d.sess == nil {
+		if err := d.srv.tls.checkDevice(d.conn.Conn, name); err != nil {
+			d.rejected = err
+			return d.rejected
+		}
 	}
-	return models.GPSInfo{}
+	if !devices.AllowedProtocol(name, d.srv.Protocol) {
+		d.rejected = fmt.Errorf("%w %q", models.ErrUnknownDevice, name)
+		return d.rejected
+	}
+	if d.sess == nil {
+		d.login(name)
+	}
+	return nil
 }
 
-func (srv *Server) GetGPSList() []models.GPSInfo {
-	var gps []models.GPSInfo
-	defer srv.mu.Unlock()
-	srv.mu.Lock()
-	for _, v := range srv.GPS {
-		gps = append(gps, v)
+//login захват сессии устройства, снимается в handle после обработки пакета
+func (d *deviceCheck) login(name string) {
+	d.sess = sessions.Session(name)
+	d.sess.Lock()
+	d.prev = sessions.Login(d.sess, d.srv.Addr, d.conn.Conn.RemoteAddr().String(), d.conn.Conn)
+	if d.gps.GPS.GpsD.DateTime.IsZero() {
+		d.gps.GPS.GpsD = d.sess.Info.GpsD
+	}
+	d.gps.ChkPar.Dedup = d.sess
+	if dev, ok := devices.Get(name); ok {
+		d.gps.GPS.Title = dev.Name
+		d.gps.GPS.Owner = dev.Owner
+		d.gps.GPS.Group = dev.Group
 	}
-	return gps
 }
 
-func (srv *Server) handle(conn *conn) {
-	defer func() {
-		elog.Info(1, fmt.Sprintf("%s\t%s<-%s - connect close",
-			time.Now().Local().Format("02.01.2006 15:04:05"),
-			utils.GetPortAdr(conn.Conn.LocalAddr().String()),
-			utils.GetPortAdr(conn.Conn.RemoteAddr().String())))
-		conn.Close()
-		srv.deleteConn(conn)
-	}()
+//link соединение с устройством: разборщик протокола, проверка входа и сессия после входа
+type link struct {
+	conn   *conn
+	parser clients.Parser
+	gps    *models.ProtocolModel
+	check  *deviceCheck
+	//sess сессия устройства после входа, владелец сессии - сокет соединения
+	sess *session.Session
+	name string
+	log  logger.Entry
+}
 
-	elog.Info(1, fmt.Sprintf("%s\t%s<-%s - new connect",
-		time.Now().Local().Format("02.01.2006 15:04:05"),
-		utils.GetPortAdr(conn.Conn.LocalAddr().String()),
-		utils.GetPortAdr(conn.Conn.RemoteAddr().String())))
+//newLink разборщик и проверка входа нового соединения
+func (srv *Server) newLink(conn *conn) (*link, error) {
+	l := &link{
+		conn: conn,
+		log:  srv.log().With(logger.Fields{Remote: conn.Conn.RemoteAddr().String()}),
+	}
+	l.log.Info("new connect")
 
-	input := make([]byte, srv.MaxReadBytes)
+	parser, err := clients.New(srv.Protocol)
+	if err != nil {
+		return l, err
+	}
+	l.parser = parser
+	l.gps = parser.Model()
+	l.check = &deviceCheck{srv: srv, conn: conn, gps: l.gps}
+	l.gps.ChkPar.Devices = l.check
+
+	if matchList(config.Get().Capture.Ports, srv.Addr) {
+		srv.startCapture(conn, "port-"+srv.Addr, l.log)
+	}
+	return l, nil
+}
+
+//closeLink выход устройства и закрытие соединения
+func (srv *Server) closeLink(l *link) {
+	if f, ok := l.parser.(clients.Flusher); ok && l.sess != nil {
+		srv.flush(l, f)
+	}
+	if l.sess != nil {
+		sessions.Logout(l.sess, l.conn.Conn)
+	}
+	if l.name != "" {
+		models.PublishEvent(models.Event{
+			Type: models.EventDisconnect,
+			Name: l.name,
+			Port: srv.Addr,
+		})
+	}
+	l.log.With(logger.Fields{Device: l.name}).Info("connect close")
+	l.conn.Close()
+	srv.deleteConn(l.conn)
+}
 
-	gps := &clients.GryphonPro{} // GryphonM01{} Teltonika{}
-	gps.ChkPar.Sat = config.Config.MinSatel
-	gps.Path = config.Config.PathToSave
+//flush запись точки, собранной разборщиком к закрытию соединения, как после пакета
+func (srv *Server) flush(l *link, f clients.Flusher) {
+	gps := l.gps
+	l.sess.Lock()
+	gps.GPS = l.sess.Info
+	gps.GPS.CountData = nil
+	gps.Path = config.Get().PathToSave
+
+	err := f.Flush()
+	l.sess.Update(gps.GPS, err)
+	l.sess.Unlock()
+	if err != nil {
+		l.log.With(logger.Fields{Device: l.name}).Error("%v", err)
+	}
+}
+
+func (srv *Server) handle(conn *conn) {
+	l, err := srv.newLink(conn)
+	defer srv.closeLink(l)
+	if err != nil {
+		l.log.Error("%v", err)
+		return
+	}
+
+	input := make([]byte, srv.MaxReadBytes)
 
 	for {
+		if srv.shuttingDown() {
+			return
+		}
+		atomic.StoreInt32(&conn.state, connIdle)
+
 		reqlen, err := conn.Read(input)
 		if err != nil {
-			if err != io.EOF {
-				elog.Error(1, fmt.Sprintf("%s\t%s<-%s - GPS: %s - %s",
-					time.Now().Local().Format("02.01.2006 15:04:05"),
-					utils.GetPortAdr(conn.Conn.LocalAddr().String()),
-					utils.GetPortAdr(conn.Conn.RemoteAddr().String()),
-					gps.GPS.Name,
-					err.Error()))
+			switch {
+			case l.sess != nil && l.sess.Replaced(conn.Conn):
+				l.log.With(logger.Fields{Device: l.name}).Info("connection replaced by new login")
+			case l.name == "" && isTimeout(err):
+				srv.limitHit(limitHandshake, l.log)
+			case err != io.EOF && !srv.shuttingDown():
+				l.log.With(logger.Fields{Device: l.gps.GPS.Name}).Error("%v", err)
 			}
 			return
 		}
+		atomic.StoreInt32(&conn.state, connActive)
+
+		if reason, wait := conn.throttle(reqlen, srv.Limits()); wait > 0 {
+			srv.limitHit(reason, l.log.With(logger.Fields{Device: l.name}))
+			time.Sleep(wait)
+		}
+
+		conn.captureFrame(capture.In, input[:reqlen])
 
 		if strings.HasPrefix(string(input[:reqlen]), "getinfo") {
-			elog.Info(1, fmt.Sprintf("%s\t%s<-%s - get info",
-				time.Now().Local().Format("02.01.2006 15:04:05"),
-				utils.GetPortAdr(conn.Conn.LocalAddr().String()),
-				utils.GetPortAdr(conn.Conn.RemoteAddr().String())))
+			l.log.Info("get info")
 			var port models.PortInfo
 			port.Name = srv.Addr
 			port.Gps = srv.GetGPSList()
@@ -231,40 +503,112 @@ func (srv *Server) handle(conn *conn) {
 				conn.Send([]byte(err.Error()))
 			}
 			conn.Send(body)
-		} else {
-			gps.Input = input[:reqlen]
+			conn.Send(GetBadPacketByte(l.parser))
+			continue
+		}
 
-			if gps.GPS.Name != "" {
-				gps.GPS = srv.GetGPS(gps.GPS.Name)
+		if err := srv.packet(l, input[:reqlen]); err != nil {
+			//ответ протокола на ошибку (например, #AL#0 Wialon IPS), иначе общий ответ разборщика
+			if len(l.gps.GPS.CountData) > 0 {
+				conn.Send(l.gps.GPS.CountData)
+			} else {
+				conn.Send(GetBadPacketByte(l.parser))
+			}
+			if l.check.rejected != nil {
+				return
 			}
+			continue
+		}
+		conn.Send(l.gps.GPS.CountData)
+	}
+}
 
-			err = ParseGPSData(gps)
+//packet разбор и сохранение пакета соединения. Ошибка - пакет не принят;
+//при отказе устройству (l.check.rejected) соединение нужно закрыть после ответа
+func (srv *Server) packet(l *link, input []byte) error {
+	gps := l.gps
+	gps.Input = input
 
-			if gps.GPS.Name != "" {
-				srv.SetGPS(gps.GPS)
-			}
+	//пакеты устройства со всех соединений разбираются по очереди от последней принятой точки
+	if l.sess != nil {
+		l.sess.Lock()
+		gps.GPS = l.sess.Info
+	}
+	//ответ устройству собирается разборщиком заново на каждый пакет
+	gps.GPS.CountData = nil
 
-			if err != nil {
-				elog.Error(1, fmt.Sprintf("%s\t%s<-%s - GPS: %s - %s",
-					time.Now().Local().Format("02.01.2006 15:04:05"),
-					utils.GetPortAdr(conn.Conn.LocalAddr().String()),
-					utils.GetPortAdr(conn.Conn.RemoteAddr().String()),
-					gps.GPS.Name,
-					err.Error()))
-				conn.Send(GetBadPacketByte(gps))
-				continue
-			}
+	gps.GPS.Port = srv.Addr
 
-			elog.Info(1, fmt.Sprintf("%s\t%s<-%s - GPS: %s",
-				time.Now().Local().Format("02.01.2006 15:04:05"),
-				utils.GetPortAdr(conn.Conn.LocalAddr().String()),
-				utils.GetPortAdr(conn.Conn.RemoteAddr().String()),
-				gps.GPS.Name))
+	//параметры проверки и путь берутся на каждый пакет - меняются при перечитывании конфигурации
+	cfg := config.Get()
+	gps.ChkPar.Sat = cfg.MinSatel
+	gps.Path = cfg.PathToSave
 
-			conn.Send(gps.GPS.CountData)
-			continue
+	plog := l.log.With(logger.Fields{Device: gps.GPS.Name, Len: len(input)})
+	if plog.Enabled(logger.LevelDebug) {
+		plog.Debug("packet %x", gps.Input)
+	}
+
+	err := ParseGPSData(l.parser)
+	plog = plog.With(logger.Fields{Device: gps.GPS.Name})
+
+	//разборщик без вызова ChkName проверяется после разбора
+	check := l.check
+	if check.rejected == nil && check.sess == nil && gps.GPS.Name != "" {
+		check.CheckDevice(gps.GPS.Name)
+	}
+	if check.rejected != nil {
+		plog.Warn("device rejected: %v", check.rejected)
+		models.PublishEvent(models.Event{
+			Type: models.EventUnknown,
+			Name: gps.GPS.Name,
+			Port: srv.Addr,
+			Info: fmt.Sprintf("%s: %v", l.conn.Conn.RemoteAddr(), check.rejected),
+		})
+		if check.sess != nil {
+			l.sess = check.sess
+			l.sess.Unlock()
+		}
+		return check.rejected
+	}
+
+	if gps.GPS.Name != "" {
+		if l.sess == nil {
+			l.sess = check.sess
+			if check.prev != "" {
+				plog.Warn("re-login, previous connection %s closed", check.prev)
+			}
+		}
+		l.sess.Update(gps.GPS, err)
+		l.sess.Unlock()
+
+		if l.name == "" {
+			l.name = gps.GPS.Name
+			l.conn.endHandshake()
+			if l.conn.capture == nil && matchList(cfg.Capture.Devices, l.name) {
+				srv.startCapture(l.conn, utils.SafeFileName(l.name), plog)
+				l.conn.captureFrame(capture.In, input)
+			}
+			models.PublishEvent(models.Event{
+				Type: models.EventLogin,
+				Name: l.name,
+				Port: srv.Addr,
+				Info: l.conn.Conn.RemoteAddr().String(),
+			})
 		}
+	}
 
-		conn.Send(GetBadPacketByte(gps))
+	if err != nil {
+		plog.Error("%v", err)
+		models.PublishEvent(models.Event{
+			Type: models.EventError,
+			Name: gps.GPS.Name,
+			Port: srv.Addr,
+			Info: err.Error(),
+		})
+		return err
 	}
+
+	plog.Info("gps data")
+	return nil
 }
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/models"
+	"gps_clients/server_gps_service/registry"
+)
+
+//testSink счетчики записей и событий по устройствам, общий для тестов пакета
+type testSink struct {
+	mu       sync.Mutex
+	accepted map[string]int
+	rejected map[string]int
+	events   map[string][]string
+}
+
+var (
+	sink     = &testSink{accepted: map[string]int{}, rejected: map[string]int{}, events: map[string][]string{}}
+	sinkOnce sync.Once
+)
+
+func (s *testSink) Accepted(g models.GPSInfo, data []models.GPSData) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	s.accepted[g.Name] += len(data)
+}
+
+func (s *testSink) Rejected(g models.GPSInfo, list []models.GPSInfo) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	s.rejected[g.Name] += len(list)
+}
+
+func (s *testSink) Event(e models.Event) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	s.events[e.Name] = append(s.events[e.Name], e.Type)
+}
+
+func (s *testSink) counts(name string) (int, int, []string) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	return s.accepted[name], s.rejected[name], s.events[name]
+}
+
+//testEnv конфигурация с PathToSave во временном каталоге и реестр устройств из list
+func testEnv(t *testing.T, list string) string {
+	sinkOnce.Do(func() { models.AddSink(sink) })
+
+	dir := t.TempDir()
+	cfg := config.Get()
+	t.Cleanup(func() { config.Set(cfg) })
+	c := cfg
+	c.PathToSave = dir + "/"
+	config.Set(c)
+
+	if list != "" {
+		file := filepath.Join(t.TempDir(), "devices.json")
+		if err := ioutil.WriteFile(file, []byte(list), 0666); err != nil {
+			t.Fatal(err)
+		}
+		r, err := registry.Load(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		devices = r
+		t.Cleanup(func() { devices = nil })
+	}
+	return dir
+}
+
+//startServer порт протокола на loopback, останавливается в конце теста
+func startServer(t *testing.T, srv *Server) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.IdleTimeout == 0 {
+		srv.IdleTimeout = 5 * time.Second
+	}
+	if srv.MaxReadBytes == 0 {
+		srv.MaxReadBytes = 1024
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return ln.Addr().String()
+}
+
+//exchange отправляет пакет и читает ответ до закрытия соединения сервером или паузы wait
+func exchange(t *testing.T, addr string, packet []byte, wait time.Duration) (answer []byte, closed bool) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write(packet); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 256)
+	c.SetReadDeadline(time.Now().Add(wait))
+	for {
+		n, err := c.Read(buf)
+		answer = append(answer, buf[:n]...)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return answer, false
+			}
+			return answer, true
+		}
+	}
+}
+
+//savedFiles файлы записей и ошибок в каталоге PathToSave
+func savedFiles(t *testing.T, dir string) []string {
+	var list []string
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			list = append(list, p)
+		}
+		return nil
+	})
+	return list
+}
+
+//TestUnknownDeviceNotSaved устройство не из реестра или с чужим протоколом отклоняется до сохранения первого пакета
+func TestUnknownDeviceNotSaved(t *testing.T) {
+	tests := []struct {
+		protocol string
+		name     string
+		packet   string
+		answer   string
+	}{
+		{
+			protocol: "teltonika",
+			name:     "356307042441013",
+			packet:   "\x00\x0f356307042441013",
+			answer:   "\x00",
+		},
+		{
+			protocol: "wialon",
+			name:     "356307042441014",
+			packet:   "#L#356307042441014;NA\r\n#D#180925;102030;5545.1234;N;03736.5678;E;10;90;150;8\r\n",
+			answer:   "#AL#0\r\n",
+		},
+		{
+			//устройство зарегистрировано с другим протоколом, положение в первом же пакете;
+			//отрицательного ответа в протоколе нет
+			protocol: "h02",
+			name:     "356307042441015",
+			packet:   "*HQ,356307042441015,V1,102030,A,5545.1234,N,03736.5678,E,10.00,90,180925,FFFFFBFF#",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			dir := testEnv(t, `[{"id": "123456789012345"}, {"id": "356307042441015", "protocol": "egts"}]`)
+			addr := startServer(t, &Server{Addr: "5000", Protocol: tt.protocol})
+
+			answer, closed := exchange(t, addr, []byte(tt.packet), 2*time.Second)
+			if string(answer) != tt.answer || !closed {
+				t.Fatalf("answer %q closed %v, want %q and close", answer, closed, tt.answer)
+			}
+			if files := savedFiles(t, dir); len(files) != 0 {
+				t.Fatalf("saved %v", files)
+			}
+			accepted, rejected, events := sink.counts(tt.name)
+			if accepted != 0 || rejected != 0 || len(events) != 1 || events[0] != models.EventUnknown {
+				t.Fatalf("sink: accepted %d, rejected %d, events %v", accepted, rejected, events)
+			}
+		})
+	}
+}
+
+//TestKnownDeviceSaved устройство из реестра сохраняется как обычно
+func TestKnownDeviceSaved(t *testing.T) {
+	dir := testEnv(t, `[{"id": "356307042441016", "protocol": "h02"}]`)
+	addr := startServer(t, &Server{Addr: "5000", Protocol: "h02"})
+
+	exchange(t, addr, []byte("*HQ,356307042441016,V1,102030,A,5545.1234,N,03736.5678,E,10.00,90,180925,FFFFFBFF#"), 300*time.Millisecond)
+
+	if files := savedFiles(t, dir); len(files) != 1 || filepath.Base(files[0]) != "356307042441016.txt" {
+		t.Fatalf("saved %v", files)
+	}
+	if accepted, _, _ := sink.counts("356307042441016"); accepted != 1 {
+		t.Fatalf("sink accepted %d", accepted)
+	}
+}
+
+//TestFirstPacketDedup записи первого пакета нового соединения проверяются по сессии устройства
+func TestFirstPacketDedup(t *testing.T) {
+	testEnv(t, "")
+	addr := startServer(t, &Server{Addr: "5000", Protocol: "wialon"})
+
+	packet := []byte("#L#dev038;NA\r\n" + wialonPoint)
+	for i := 0; i < 2; i++ {
+		if answer, _ := exchange(t, addr, packet, 300*time.Millisecond); string(answer) != "#AL#1\r\n#AD#1\r\n" {
+			t.Fatalf("answer %q", answer)
+		}
+	}
+	if accepted, rejected, _ := sink.counts("dev038"); accepted != 1 || rejected != 1 {
+		t.Fatalf("accepted %d, rejected %d", accepted, rejected)
+	}
+}
+
+//TestNMEAFlushOnClose точка NMEA без GGA записывается при закрытии соединения
+func TestNMEAFlushOnClose(t *testing.T) {
+	testEnv(t, "")
+	addr := startServer(t, &Server{Addr: "5000", Protocol: "nmea"})
+
+	rmc := "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A\r\n"
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write([]byte("dev050s\r\n" + rmc)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if accepted, _, _ := sink.counts("dev050s"); accepted != 0 {
+		t.Fatalf("accepted %d before close", accepted)
+	}
+	c.Close()
+
+	for i := 0; i < 20; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if accepted, _, _ := sink.counts("dev050s"); accepted == 1 {
+			return
+		}
+	}
+	t.Fatal("point not saved on close")
+}
@@ -0,0 +1,94 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gps_clients/server_gps_service/logger"
+	"gps_clients/server_gps_service/utils"
+)
+
+//commandList команды, доступные на Linux
+const commandList = "run, debug, install or remove"
+
+//isService под systemd служба запускается командой run
+func isService() (bool, error) {
+	return false, nil
+}
+
+func runCommand(cmd, name, fullname, desc string) error {
+	switch cmd {
+	case "run", "debug":
+		runService(name, cmd == "debug")
+		return nil
+	case "install":
+		return installService(name, fullname, desc)
+	case "remove":
+		return removeService(name)
+	default:
+		usage(fmt.Sprintf("invalid command %s", cmd))
+	}
+	return nil
+}
+
+func runService(name string, isDebug bool) {
+	utils.ChkErrFatal(initLogger(isDebug || os.Getenv("JOURNAL_STREAM") != ""))
+	defer logger.Close()
+
+	initServer()
+	logger.Info("starting %s service", name)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(sig)
+
+	if err := sdNotify("READY=1"); err != nil {
+		logger.Warn("sd_notify: %v", err)
+	}
+
+	stopWatchdog := make(chan struct{})
+	defer close(stopWatchdog)
+	if interval := watchdogInterval(); interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					sdNotify("WATCHDOG=1")
+				case <-stopWatchdog:
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case err := <-serverErrors:
+			logger.Error("%v", err)
+		case s := <-sig:
+			switch s {
+			case syscall.SIGHUP:
+				sdNotify("RELOADING=1")
+				if err := reload(); err != nil {
+					logger.Error("%s reload failed: %v", name, err)
+				} else {
+					logger.Info("%s reloaded", name)
+				}
+				sdNotify("READY=1")
+			default:
+				sdNotify("STOPPING=1")
+				logger.Info("%s received %s", name, s)
+				shutdown()
+				logger.Info("%s service stopped", name)
+				return
+			}
+		}
+	}
+}
@@ -5,25 +5,62 @@ import (
 	"strings"
 	"time"
 
+	"gps_clients/server_gps_service/logger"
+	"gps_clients/server_gps_service/utils"
+
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/debug"
 	"golang.org/x/sys/windows/svc/eventlog"
 )
 
-var elog debug.Log
+//commandList команды, доступные на Windows
+const commandList = "install, remove, debug, start, stop, pause, resume or reload"
+
+func isService() (bool, error) {
+	return svc.IsWindowsService()
+}
+
+func runCommand(cmd, name, fullname, desc string) error {
+	switch cmd {
+	case "debug":
+		runService(name, true)
+		return nil
+	case "install":
+		return installService(name, fullname, desc)
+	case "remove":
+		return removeService(name)
+	case "start":
+		return startService(name)
+	case "stop":
+		return controlService(name, svc.Stop, svc.Stopped)
+	case "pause":
+		return controlService(name, svc.Pause, svc.Paused)
+	case "resume":
+		return controlService(name, svc.Continue, svc.Running)
+	case "reload":
+		return controlService(name, svc.ParamChange, svc.Running)
+	default:
+		usage(fmt.Sprintf("invalid command %s", cmd))
+	}
+	return nil
+}
 
 type myservice struct{}
 
 func (m *myservice) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
-	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
+	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue | svc.AcceptParamChange
 	changes <- svc.Status{State: svc.StartPending}
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 	//startExecute()
 loop:
 	for {
-		//select {
-		/*case*/
-		c := <-r //:
+		var c svc.ChangeRequest
+		select {
+		case err := <-serverErrors:
+			logger.Error("%v", err)
+			continue
+		case c = <-r:
+		}
 		switch c.Cmd {
 		case svc.Interrogate:
 			changes <- c.CurrentStatus
@@ -32,9 +69,9 @@ loop:
 		case svc.Stop, svc.Shutdown:
 			testOutput := strings.Join(args, "-")
 			testOutput += fmt.Sprintf("-%d", c.Context)
-			elog.Info(1, testOutput)
+			logger.Info("%s", testOutput)
 			//AddToLog(GetProgramPath()+"-test.txt", testOutput)
-			stopServers()
+			shutdown()
 			break loop
 		case svc.Pause:
 			//stopExecute()
@@ -50,39 +87,46 @@ loop:
 			//AddToLog(GetProgramPath()+"-test.txt", "start continue service")
 			startServers()
 			//AddToLog(GetProgramPath()+"-test.txt", "service continued")
+		case svc.ParamChange:
+			if err := reload(); err != nil {
+				logger.Error("reload failed: %v", err)
+			} else {
+				logger.Info("reloaded")
+			}
+			changes <- c.CurrentStatus
 		default:
-			elog.Error(1, fmt.Sprintf("unexpected control request #%d", c))
+			logger.Error("unexpected control request #%d", c)
 			//AddToLog(GetProgramPath()+"-test.txt", fmt.Sprintf("unexpected control request #%d", c))
 		}
-		//}
 	}
 	changes <- svc.Status{State: svc.StopPending}
 	return
 }
 
 func runService(name string, isDebug bool) {
-	var err error
-	if isDebug {
-		elog = debug.New(name)
-	} else {
-		elog, err = eventlog.Open(name)
+	if !isDebug {
+		elog, err := eventlog.Open(name)
 		if err != nil {
 			return
 		}
+		defer elog.Close()
+		logger.SetEventLog(elog)
 	}
-	defer elog.Close()
+
+	utils.ChkErrFatal(initLogger(isDebug))
+	defer logger.Close()
 
 	initServer()
-	elog.Info(1, fmt.Sprintf("starting %s service", name))
+	logger.Info("starting %s service", name)
 	run := svc.Run
 	if isDebug {
 		run = debug.Run
 	}
-	err = run(name, &myservice{})
+	err := run(name, &myservice{})
 	if err != nil {
-		elog.Error(1, fmt.Sprintf("%s service failed: %v", name, err))
+		logger.Error("%s service failed: %v", name, err)
 		return
 	}
 
-	elog.Info(1, fmt.Sprintf("%s service stopped", name))
+	logger.Info("%s service stopped", name)
 }
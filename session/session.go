@@ -0,0 +1,218 @@
+package session
+
+import (
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"gps_clients/server_gps_service/models"
+)
+
+//DedupSize сколько последних принятых записей устройства помнит индекс повторов
+const DedupSize = 512
+
+//Session состояние одного устройства, общее для всех его соединений.
+//Пакеты устройства обрабатываются под Lock, поэтому два соединения
+//с одним ID не могут одновременно менять последнюю точку и счетчики.
+type Session struct {
+	mu sync.Mutex
+
+	ID     string
+	Info   models.GPSInfo
+	Port   string
+	Remote string
+	Login  time.Time
+
+	Packets    int64
+	Records    int64
+	Errors     int64
+	Duplicates int64
+	Logins     int64
+
+	owner io.Closer
+
+	seen  map[dedupKey]struct{}
+	order []dedupKey
+	next  int
+}
+
+//dedupKey запись считается повтором при совпадении времени и координат
+type dedupKey struct {
+	time     int64
+	lat, lng int64
+}
+
+func keyOf(d models.GPSData) dedupKey {
+	return dedupKey{
+		time: d.DateTime.Unix(),
+		lat:  int64(math.Round(d.Lat * 1e6)),
+		lng:  int64(math.Round(d.Lng * 1e6)),
+	}
+}
+
+//Lock захват устройства на время обработки пакета
+func (s *Session) Lock() {
+	s.mu.Lock()
+}
+
+//Unlock освобождение устройства после обработки пакета
+func (s *Session) Unlock() {
+	s.mu.Unlock()
+}
+
+//Seen проверка повтора записи, вызывается из парсера под Lock.
+//Новая запись запоминается, самая старая вытесняется после DedupSize записей.
+func (s *Session) Seen(d models.GPSData) bool {
+	k := keyOf(d)
+	if _, ok := s.seen[k]; ok {
+		s.Duplicates++
+		return true
+	}
+
+	if s.seen == nil {
+		s.seen = make(map[dedupKey]struct{}, DedupSize)
+	}
+	if len(s.order) < DedupSize {
+		s.order = append(s.order, k)
+	} else {
+		delete(s.seen, s.order[s.next])
+		s.order[s.next] = k
+		s.next = (s.next + 1) % DedupSize
+	}
+	s.seen[k] = struct{}{}
+	s.Records++
+	return false
+}
+
+//Update сохраняет состояние устройства после пакета, вызывается под Lock
+func (s *Session) Update(info models.GPSInfo, err error) {
+	info.CountData = nil
+	s.Info = info
+	s.Packets++
+	if err != nil {
+		s.Errors++
+	}
+}
+
+//Stat счетчики устройства для API
+type Stat struct {
+	ID         string    `json:"id"`
+	Port       string    `json:"port"`
+	Remote     string    `json:"remote"`
+	Online     bool      `json:"online"`
+	Login      time.Time `json:"login"`
+	LastPoint  time.Time `json:"lastPoint"`
+	Packets    int64     `json:"packets"`
+	Records    int64     `json:"records"`
+	Errors     int64     `json:"errors"`
+	Duplicates int64     `json:"duplicates"`
+	Logins     int64     `json:"logins"`
+}
+
+//Manager владеет сессиями всех устройств, сессии сохраняются между
+//соединениями и при перечитывании конфигурации
+type Manager struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+//NewManager пустой менеджер сессий
+func NewManager() *Manager {
+	return &Manager{sessions: make(map[string]*Session)}
+}
+
+//Session сессия устройства, создается при первом обращении
+func (m *Manager) Session(id string) *Session {
+	defer m.mu.Unlock()
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	if !ok {
+		s = &Session{ID: id}
+		m.sessions[id] = s
+	}
+	return s
+}
+
+//Login привязывает соединение owner к сессии устройства.
+//Если устройство уже подключено другим соединением, оно закрывается,
+//его адрес возвращается в prev. Вызывается под Lock сессии.
+func (m *Manager) Login(s *Session, port, remote string, owner io.Closer) (prev string) {
+	if s.owner != nil && s.owner != owner {
+		prev = s.Remote
+		s.owner.Close()
+	}
+	s.owner = owner
+	s.Port = port
+	s.Remote = remote
+	s.Login = time.Now()
+	s.Logins++
+	return prev
+}
+
+//Logout отвязывает соединение owner, если сессию не занял более новый вход.
+//false - соединение было вытеснено повторным входом устройства.
+func (m *Manager) Logout(s *Session, owner io.Closer) bool {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	if s.owner != owner {
+		return false
+	}
+	s.owner = nil
+	return true
+}
+
+//Replaced true, если соединение owner вытеснено повторным входом устройства
+func (s *Session) Replaced(owner io.Closer) bool {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	return s.owner != owner
+}
+
+func (m *Manager) list() []*Session {
+	defer m.mu.Unlock()
+	m.mu.Lock()
+	list := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+//List состояние устройств, последний раз подключавшихся к порту
+func (m *Manager) List(port string) []models.GPSInfo {
+	var res []models.GPSInfo
+	for _, s := range m.list() {
+		s.mu.Lock()
+		if s.Port == port {
+			res = append(res, s.Info)
+		}
+		s.mu.Unlock()
+	}
+	return res
+}
+
+//Stats счетчики всех устройств
+func (m *Manager) Stats() []Stat {
+	var res []Stat
+	for _, s := range m.list() {
+		s.mu.Lock()
+		res = append(res, Stat{
+			ID:         s.ID,
+			Port:       s.Port,
+			Remote:     s.Remote,
+			Online:     s.owner != nil,
+			Login:      s.Login,
+			LastPoint:  s.Info.GpsD.DateTime,
+			Packets:    s.Packets,
+			Records:    s.Records,
+			Errors:     s.Errors,
+			Duplicates: s.Duplicates,
+			Logins:     s.Logins,
+		})
+		s.mu.Unlock()
+	}
+	return res
+}
@@ -0,0 +1,158 @@
+package session
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/models"
+)
+
+//pipe серверная сторона соединения устройства, вторая сторона - устройство
+func pipe(t *testing.T) (server, device net.Conn) {
+	server, device = net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		device.Close()
+	})
+	return server, device
+}
+
+//TestRelogin повторный вход с тем же ID закрывает прежнее соединение, состояние устройства остается
+func TestRelogin(t *testing.T) {
+	m := NewManager()
+	srv1, dev1 := pipe(t)
+	srv2, _ := pipe(t)
+	tm := time.Date(2025, 9, 18, 10, 20, 30, 0, time.UTC)
+
+	s := m.Session("dev1")
+	s.Lock()
+	if prev := m.Login(s, "5000", "10.0.0.1:1000", srv1); prev != "" {
+		t.Fatalf("first login closed %s", prev)
+	}
+	s.Update(models.GPSInfo{Name: "dev1", GpsD: models.GPSData{DateTime: tm}}, nil)
+	s.Unlock()
+
+	//прежнее устройство ждет ответа
+	read := make(chan error, 1)
+	go func() {
+		_, err := dev1.Read(make([]byte, 1))
+		read <- err
+	}()
+
+	s2 := m.Session("dev1")
+	if s2 != s {
+		t.Fatal("new session for the same id")
+	}
+	s2.Lock()
+	prev := m.Login(s2, "5001", "10.0.0.2:2000", srv2)
+	info := s2.Info
+	s2.Unlock()
+
+	if prev != "10.0.0.1:1000" {
+		t.Fatalf("prev %q", prev)
+	}
+	select {
+	case err := <-read:
+		if err == nil {
+			t.Fatal("old connection not closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("old connection not closed")
+	}
+	if !info.GpsD.DateTime.Equal(tm) {
+		t.Fatalf("state lost on re-login: %+v", info)
+	}
+
+	//выход прежнего соединения не отвязывает новое
+	if !s.Replaced(srv1) || s.Replaced(srv2) {
+		t.Fatal("bad owner after re-login")
+	}
+	if m.Logout(s, srv1) {
+		t.Fatal("replaced connection logged out the session")
+	}
+	st := m.Stats()
+	if len(st) != 1 || !st[0].Online || st[0].Port != "5001" || st[0].Logins != 2 {
+		t.Fatalf("stats %+v", st)
+	}
+	if !m.Logout(s, srv2) {
+		t.Fatal("logout of the owner failed")
+	}
+	if st := m.Stats(); st[0].Online {
+		t.Fatal("online after logout")
+	}
+}
+
+//TestSerialized пакеты двух соединений одного устройства обрабатываются по очереди
+func TestSerialized(t *testing.T) {
+	m := NewManager()
+	const n = 200
+	tm := time.Date(2025, 9, 18, 10, 20, 30, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for c := 0; c < 2; c++ {
+		srv, _ := pipe(t)
+		wg.Add(1)
+		go func(owner net.Conn) {
+			defer wg.Done()
+			s := m.Session("dev1")
+			for i := 0; i < n; i++ {
+				s.Lock()
+				if i == 0 {
+					m.Login(s, "5000", owner.LocalAddr().String(), owner)
+				}
+				//как в handle: прочитать последнюю точку, принять следующую, сохранить
+				info := s.Info
+				if info.GpsD.DateTime.IsZero() {
+					info.GpsD.DateTime = tm
+				}
+				d := models.GPSData{DateTime: info.GpsD.DateTime.Add(time.Second)}
+				if s.Seen(d) {
+					t.Errorf("record %v seen twice", d.DateTime)
+				}
+				info.GpsD = d
+				s.Update(info, nil)
+				s.Unlock()
+			}
+		}(srv)
+	}
+	wg.Wait()
+
+	st := m.Stats()[0]
+	if st.Packets != 2*n || st.Records != 2*n || st.Duplicates != 0 ||
+		!st.LastPoint.Equal(tm.Add(2*n*time.Second)) {
+		t.Fatalf("stats %+v", st)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	s := &Session{}
+	tm := time.Date(2025, 9, 18, 10, 20, 30, 0, time.UTC)
+	d := models.GPSData{DateTime: tm, Lat: 55.752, Lng: 37.6175}
+
+	if s.Seen(d) {
+		t.Fatal("new record seen")
+	}
+	if !s.Seen(d) {
+		t.Fatal("repeat not seen")
+	}
+	//другие координаты в то же время - новая запись
+	if s.Seen(models.GPSData{DateTime: tm, Lat: 55.753, Lng: 37.6175}) {
+		t.Fatal("other point seen")
+	}
+	if s.Duplicates != 1 || s.Records != 2 {
+		t.Fatalf("duplicates %d, records %d", s.Duplicates, s.Records)
+	}
+
+	//после DedupSize новых записей самая старая забывается
+	for i := 1; i < DedupSize; i++ {
+		s.Seen(models.GPSData{DateTime: tm.Add(time.Duration(i) * time.Second)})
+	}
+	if s.Seen(d) {
+		t.Fatal("oldest record not evicted")
+	}
+	if !s.Seen(models.GPSData{DateTime: tm.Add(time.Duration(DedupSize-1) * time.Second)}) {
+		t.Fatal("recent record evicted")
+	}
+}
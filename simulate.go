@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"gps_clients/server_gps_service/simulator"
+)
+
+//runSimulate имитация устройств: simulate [flags] <addr>
+func runSimulate(args []string) error {
+	var opts simulator.Options
+
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	fs.StringVar(&opts.Protocol, "protocol", "teltonika", "device protocol: teltonika, wialon, gryphonpro, gryphonm01, gt06")
+	fs.StringVar(&opts.Codec, "codec", "8", "teltonika codec: 8 or 8e")
+	fs.IntVar(&opts.Conns, "conns", 10, "concurrent devices")
+	fs.Float64Var(&opts.Rate, "rate", 1, "packets per second per device")
+	fs.IntVar(&opts.Records, "records", 1, "records per packet")
+	fs.IntVar(&opts.Count, "count", 0, "packets per device (0 - until -duration)")
+	fs.DurationVar(&opts.Duration, "duration", 0, "test duration (default 1m when -count is not set)")
+	fs.DurationVar(&opts.Timeout, "timeout", 10*time.Second, "ack timeout")
+	fs.Uint64Var(&opts.IMEI, "imei", 350000000000000, "IMEI of the first device, next devices get IMEI+1, IMEI+2...")
+	fs.StringVar(&opts.Password, "password", "", "login password (wialon)")
+	useTLS := fs.Bool("tls", false, "connect with TLS")
+	insecure := fs.Bool("insecure", false, "do not verify server certificate")
+	cert := fs.String("cert", "", "client certificate file")
+	key := fs.String("key", "", "client key file")
+	fs.Parse(args)
+
+	if *useTLS {
+		opts.TLS = &tls.Config{InsecureSkipVerify: *insecure}
+		if *cert != "" {
+			c, err := tls.LoadX509KeyPair(*cert, *key)
+			if err != nil {
+				return err
+			}
+			opts.TLS.Certificates = []tls.Certificate{c}
+		}
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: simulate [flags] <host:port>")
+	}
+	opts.Addr = fs.Arg(0)
+
+	stop := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		if _, ok := <-sig; ok {
+			close(stop)
+		}
+	}()
+
+	fmt.Printf("simulate %d %s devices -> %s, %.2f packets/s, %d records/packet\n",
+		opts.Conns, opts.Protocol, opts.Addr, opts.Rate, opts.Records)
+
+	res, err := simulator.Run(opts, stop)
+	if err != nil {
+		return err
+	}
+	res.Report(os.Stdout)
+	return nil
+}
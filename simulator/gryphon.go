@@ -0,0 +1,149 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"strings"
+
+	"gps_clients/server_gps_service/models"
+	"gps_clients/server_gps_service/retranslator"
+)
+
+var (
+	gryphonProAck = []byte{0xaa, 0x14, 0xff, 0x16}
+	gryphonProBad = []byte{0xaa, 0x14, 0xff, 0x15}
+)
+
+//GryphonPro кодирование пакетов трекера GryphonPro (бинарный, CRC32 по первым 32 байтам)
+type GryphonPro struct{}
+
+func (g *GryphonPro) Login(name, password string) []byte {
+	//18 байт цифр номера, ведущие нули сервер пропускает
+	digits := make([]byte, 18)
+	for i := 0; i < len(name) && i < len(digits); i++ {
+		digits[len(digits)-1-i] = name[len(name)-1-i] - '0'
+	}
+
+	b := []byte{0xaa, 0x00, 0x14, 0xaa}
+	b = append(b, digits...)
+	return g.frame(b)
+}
+
+func (g *GryphonPro) ChkLogin(r *bufio.Reader) error {
+	return g.ChkAck(r, 0)
+}
+
+func (g *GryphonPro) Encode(data []models.GPSData) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xaa, 0x00, 0x14, 0xbb})
+	buf.WriteByte(byte(len(data)))
+
+	b := make([]byte, 4)
+	for _, d := range data {
+		binary.BigEndian.PutUint32(b, uint32(d.DateTime.Unix()))
+		buf.Write(b)
+		binary.BigEndian.PutUint32(b, uint32(int32(math.Round(d.Lat*10000000))))
+		buf.Write(b)
+		binary.BigEndian.PutUint32(b, uint32(int32(math.Round(d.Lng*10000000))))
+		buf.Write(b)
+		binary.BigEndian.PutUint16(b, uint16(d.Alt))
+		buf.Write(b[:2])
+		buf.WriteByte(byte(float64(d.Angle) / 1.41))
+		buf.WriteByte(byte(d.Speed))
+		buf.WriteByte(byte(d.Sat))
+		buf.WriteByte(25)   //GSM
+		buf.WriteByte(0x20) //состояние, бит 5 - питание от сети
+
+		//датчики: id, длина, значение
+		buf.WriteByte(2)
+		buf.Write([]byte{2, 4})
+		binary.BigEndian.PutUint32(b, uint32(math.Round(d.AccV*100)))
+		buf.Write(b)
+		buf.Write([]byte{75, 2})
+		binary.BigEndian.PutUint16(b, uint16(d.Dut1))
+		buf.Write(b[:2])
+	}
+	return g.frame(buf.Bytes())
+}
+
+func (g *GryphonPro) ChkAck(r *bufio.Reader, count int) error {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	switch {
+	case bytes.Equal(b, gryphonProAck):
+		return nil
+	case bytes.Equal(b, gryphonProBad):
+		return fmt.Errorf("%w: %x", retranslator.ErrRejected, b)
+	default:
+		return fmt.Errorf("unexpected answer %x", b)
+	}
+}
+
+//frame дополняет пакет до 32 байт и добавляет CRC32
+func (g *GryphonPro) frame(b []byte) []byte {
+	for len(b) < 32 {
+		b = append(b, 0)
+	}
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(b[:32]))
+	return append(b, crc...)
+}
+
+//GryphonM01 кодирование HTTP-подобных строк трекера GryphonM01
+type GryphonM01 struct {
+	name string
+}
+
+//Login M01 передает номер в каждом пакете, отдельного входа нет
+func (g *GryphonM01) Login(name, password string) []byte {
+	g.name = name
+	return nil
+}
+
+func (g *GryphonM01) ChkLogin(r *bufio.Reader) error {
+	return nil
+}
+
+func (g *GryphonM01) Encode(data []models.GPSData) []byte {
+	var list []string
+	for _, d := range data {
+		t := d.DateTime.UTC()
+		//260711,114432,5026.50150,3038.7875,1434,34.11,0,106.3,116.52,6,0
+		list = append(list, fmt.Sprintf("%s,%s,%s,%s,%d,%.2f,0,%d,%d,%d,0",
+			t.Format("020106"),
+			t.Format("150405"),
+			nmeaCoord(d.Lat),
+			nmeaCoord(d.Lng),
+			int64(math.Round(d.AccV*100)),
+			float64(d.Speed)/1.852,
+			d.Alt,
+			d.Angle,
+			d.Sat))
+	}
+	return []byte(fmt.Sprintf("GET /dt.php?s=3&a=%s&d=%s\r\n", g.name, strings.Join(list, "_")))
+}
+
+func (g *GryphonM01) ChkAck(r *bufio.Reader, count int) error {
+	b := make([]byte, 3)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	if string(b) != "ok;" {
+		return fmt.Errorf("unexpected answer %q", b)
+	}
+	return nil
+}
+
+//nmeaCoord градусы в формат DDMM.MMMMM без полушария
+func nmeaCoord(v float64) string {
+	v = math.Abs(v)
+	deg := math.Floor(v)
+	return fmt.Sprintf("%.5f", deg*100+(v-deg)*60)
+}
@@ -0,0 +1,96 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"gps_clients/server_gps_service/hash"
+	"gps_clients/server_gps_service/models"
+)
+
+//GT06 кодирование пакетов Concox GT06: каждая запись - отдельный пакет 0x22, все передаются разом
+type GT06 struct {
+	serial uint16
+}
+
+func (g *GT06) Login(name, password string) []byte {
+	//IMEI в BCD, 16 цифр с ведущим нулем
+	if len(name) < 16 {
+		name = strings.Repeat("0", 16-len(name)) + name
+	}
+	imei, _ := hex.DecodeString(name)
+	return g.frame(0x01, imei)
+}
+
+func (g *GT06) ChkLogin(r *bufio.Reader) error {
+	return g.ChkAck(r, 1)
+}
+
+func (g *GT06) Encode(data []models.GPSData) []byte {
+	var out []byte
+	b := make([]byte, 4)
+	for _, d := range data {
+		var buf bytes.Buffer
+		t := d.DateTime.UTC()
+		buf.Write([]byte{byte(t.Year() - 2000), byte(t.Month()), byte(t.Day()),
+			byte(t.Hour()), byte(t.Minute()), byte(t.Second())})
+		buf.WriteByte(0xC0 | byte(d.Sat&0x0F))
+
+		binary.BigEndian.PutUint32(b, uint32(math.Round(math.Abs(d.Lat)*1800000)))
+		buf.Write(b)
+		binary.BigEndian.PutUint32(b, uint32(math.Round(math.Abs(d.Lng)*1800000)))
+		buf.Write(b)
+		buf.WriteByte(byte(d.Speed))
+
+		cs := uint16(d.Angle)&0x03FF | 0x1000
+		if d.Lat >= 0 {
+			cs |= 0x0400
+		}
+		if d.Lng < 0 {
+			cs |= 0x0800
+		}
+		binary.BigEndian.PutUint16(b, cs)
+		buf.Write(b[:2])
+
+		//LBS: MCC, MNC, LAC, Cell ID; ACC, режим, реальное время, пробег
+		buf.Write([]byte{0x00, 0xFA, 0x01, 0x1D, 0xB0, 0x00, 0x31, 0x3C})
+		buf.Write([]byte{0x01, 0x00, 0x01})
+		binary.BigEndian.PutUint32(b, uint32(d.Dut1))
+		buf.Write(b)
+
+		out = append(out, g.frame(0x22, buf.Bytes())...)
+	}
+	return out
+}
+
+//ChkAck на каждый пакет приходит подтверждение с его серийным номером
+func (g *GT06) ChkAck(r *bufio.Reader, count int) error {
+	b := make([]byte, 10)
+	for i := 0; i < count; i++ {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		if b[0] != 0x78 || b[1] != 0x78 || b[2] != 0x05 {
+			return fmt.Errorf("unexpected answer %x", b)
+		}
+		if crc := hash.CheckSumCRCITU(b[2:6]); binary.BigEndian.Uint16(b[6:8]) != crc {
+			return fmt.Errorf("bad crc in answer %x", b)
+		}
+	}
+	return nil
+}
+
+func (g *GT06) frame(proto byte, content []byte) []byte {
+	g.serial++
+	b := []byte{0x78, 0x78, byte(len(content) + 5), proto}
+	b = append(b, content...)
+	b = append(b, byte(g.serial>>8), byte(g.serial))
+	crc := hash.CheckSumCRCITU(b[2:])
+	return append(b, byte(crc>>8), byte(crc), 0x0D, 0x0A)
+}
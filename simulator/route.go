@@ -0,0 +1,78 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gps_clients/server_gps_service/models"
+)
+
+//route синтетический маршрут устройства: движение по окружности вокруг точки
+type route struct {
+	lat, lng float64
+	heading  float64
+	speed    int64
+	sat      int64
+	odometer float64
+	last     time.Time
+}
+
+func newRoute(n int) *route {
+	return &route{
+		lat:     55.75 + float64(n%100)*0.01,
+		lng:     37.62 + float64(n/100%100)*0.01,
+		heading: float64(n * 37 % 360),
+		speed:   40 + int64(n%40),
+		sat:     8 + int64(n%5),
+	}
+}
+
+//next следующие count записей, интервал между записями step
+func (r *route) next(count int, step time.Duration) []models.GPSData {
+	now := time.Now().UTC().Truncate(time.Second)
+	if r.last.IsZero() {
+		r.last = now.Add(-time.Duration(count) * step)
+	}
+
+	data := make([]models.GPSData, 0, count)
+	for i := 0; i < count; i++ {
+		t := now.Add(-time.Duration(count-1-i) * step)
+		if t.Before(r.last) {
+			t = r.last
+		}
+		r.move(t.Sub(r.last))
+		r.last = t
+
+		data = append(data, models.GPSData{
+			DateTime: t,
+			Lat:      math.Round(r.lat*1e6) / 1e6,
+			Lng:      math.Round(r.lng*1e6) / 1e6,
+			Alt:      150,
+			Angle:    int64(r.heading),
+			Sat:      r.sat,
+			Speed:    r.speed,
+			AccV:     13.8,
+			BatV:     4.1,
+			Dut1:     int64(r.odometer) % 4096,
+			UseDut:   true,
+			OtherID: []string{
+				"id 239=1;",
+				"id 240=1;",
+				fmt.Sprintf("id 16=%d;", int64(r.odometer)),
+			},
+		})
+	}
+	return data
+}
+
+func (r *route) move(dt time.Duration) {
+	dist := float64(r.speed) / 3.6 * dt.Seconds() //м
+	r.odometer += dist
+
+	rad := r.heading * math.Pi / 180
+	r.lat += dist * math.Cos(rad) / 111320
+	r.lng += dist * math.Sin(rad) / (111320 * math.Cos(r.lat*math.Pi/180))
+
+	r.heading = math.Mod(r.heading+dt.Seconds()*2, 360)
+}
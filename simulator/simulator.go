@@ -0,0 +1,294 @@
+package simulator
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gps_clients/server_gps_service/retranslator"
+)
+
+//Options параметры имитации устройств
+type Options struct {
+	Addr     string
+	Protocol string        //teltonika, wialon, gryphonpro, gryphonm01, gt06
+	Codec    string        //8 или 8e для teltonika
+	Conns    int           //кол-во одновременных устройств
+	Rate     float64       //пакетов в секунду на устройство
+	Records  int           //записей в пакете
+	Count    int           //пакетов на устройство, 0 - до окончания Duration
+	Duration time.Duration //0 - до отправки Count пакетов
+	Timeout  time.Duration //ожидание подтверждения
+	IMEI     uint64        //номер первого устройства
+	Password string
+	TLS      *tls.Config //nil - обычное TCP соединение
+}
+
+//Result итоги имитации
+type Result struct {
+	Duration time.Duration
+	Conns    int
+	Packets  int //отправлено пакетов
+	Acked    int //подтверждено пакетов
+	Records  int //подтверждено записей
+	Errors   map[string]int
+	Latency  []time.Duration //задержки подтверждений по возрастанию
+}
+
+//Percentile задержка подтверждения для доли p (0..1)
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latency) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latency)-1) * p)
+	return r.Latency[i]
+}
+
+//Report печать итогов
+func (r *Result) Report(w io.Writer) {
+	sec := r.Duration.Seconds()
+	if sec == 0 {
+		sec = 1
+	}
+	fmt.Fprintf(w, "duration:    %v\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "connections: %d\n", r.Conns)
+	fmt.Fprintf(w, "packets:     %d sent, %d acked\n", r.Packets, r.Acked)
+	fmt.Fprintf(w, "records:     %d acked\n", r.Records)
+	fmt.Fprintf(w, "throughput:  %.1f packets/s, %.1f records/s\n", float64(r.Acked)/sec, float64(r.Records)/sec)
+
+	if len(r.Latency) > 0 {
+		var sum time.Duration
+		for _, v := range r.Latency {
+			sum += v
+		}
+		fmt.Fprintf(w, "ack latency: min %v, avg %v, p50 %v, p95 %v, p99 %v, max %v\n",
+			r.Latency[0],
+			sum/time.Duration(len(r.Latency)),
+			r.Percentile(0.5),
+			r.Percentile(0.95),
+			r.Percentile(0.99),
+			r.Latency[len(r.Latency)-1])
+	}
+
+	var errs int
+	var kinds []string
+	for k, v := range r.Errors {
+		errs += v
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	fmt.Fprintf(w, "errors:      %d\n", errs)
+	for _, k := range kinds {
+		fmt.Fprintf(w, "  %6d %s\n", r.Errors[k], k)
+	}
+}
+
+//newEncoder кодировщик устройства; кодировщики ретранслятора переиспользуются
+func newEncoder(opts Options) (retranslator.Encoder, error) {
+	switch strings.ToLower(opts.Protocol) {
+	case "teltonika":
+		switch strings.ToLower(opts.Codec) {
+		case "", "8":
+			return retranslator.NewTeltonika(nil)
+		case "8e":
+			return newTeltonika8E()
+		default:
+			return nil, fmt.Errorf("unknown teltonika codec %s", opts.Codec)
+		}
+	case "wialon", "wialonips":
+		if opts.Records > 1 {
+			return nil, errors.New("wialon ips: server accepts one record per packet")
+		}
+		return &retranslator.WialonIPS{}, nil
+	case "gryphonpro":
+		return &GryphonPro{}, nil
+	case "gryphonm01":
+		return &GryphonM01{}, nil
+	case "gt06":
+		return &GT06{}, nil
+	default:
+		return nil, fmt.Errorf("unknown simulator protocol %s", opts.Protocol)
+	}
+}
+
+type sim struct {
+	opts Options
+	stop <-chan struct{}
+
+	mu  sync.Mutex
+	res Result
+}
+
+//Run запускает opts.Conns устройств и ждет их завершения или закрытия stop
+func Run(opts Options, stop <-chan struct{}) (*Result, error) {
+	if opts.Addr == "" {
+		return nil, errors.New("empty server address")
+	}
+	if opts.Conns <= 0 {
+		opts.Conns = 1
+	}
+	if opts.Rate <= 0 {
+		opts.Rate = 1
+	}
+	if opts.Records <= 0 {
+		opts.Records = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Count <= 0 && opts.Duration <= 0 {
+		opts.Duration = time.Minute
+	}
+	if opts.IMEI == 0 {
+		opts.IMEI = 350000000000000
+	}
+
+	if _, err := newEncoder(opts); err != nil {
+		return nil, err
+	}
+
+	s := &sim{
+		opts: opts,
+		stop: stop,
+		res:  Result{Errors: make(map[string]int)},
+	}
+
+	done := make(chan struct{})
+	if opts.Duration > 0 {
+		timer := time.AfterFunc(opts.Duration, func() { close(done) })
+		defer timer.Stop()
+	}
+
+	interval := time.Duration(float64(time.Second) / opts.Rate)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Conns; i++ {
+		wg.Add(1)
+		//старт устройств равномерно в пределах одного интервала
+		delay := interval * time.Duration(i) / time.Duration(opts.Conns)
+		go func(n int) {
+			defer wg.Done()
+			s.device(n, delay, interval, done)
+		}(i)
+	}
+	wg.Wait()
+	s.res.Duration = time.Since(start)
+
+	sort.Slice(s.res.Latency, func(i, j int) bool { return s.res.Latency[i] < s.res.Latency[j] })
+	return &s.res, nil
+}
+
+func (s *sim) wait(d time.Duration, done <-chan struct{}) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-done:
+		return false
+	case <-s.stop:
+		return false
+	}
+}
+
+func (s *sim) fail(kind string, err error) {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		kind += ": timeout"
+	} else if errors.Is(err, retranslator.ErrRejected) {
+		kind += ": rejected"
+	} else if err == io.EOF {
+		kind += ": connection closed"
+	} else if err != nil {
+		kind += ": " + err.Error()
+	}
+
+	s.mu.Lock()
+	s.res.Errors[kind]++
+	s.mu.Unlock()
+}
+
+func (s *sim) device(n int, delay, interval time.Duration, done <-chan struct{}) {
+	if !s.wait(delay, done) {
+		return
+	}
+
+	enc, _ := newEncoder(s.opts)
+	name := strconv.FormatUint(s.opts.IMEI+uint64(n), 10)
+
+	var c net.Conn
+	var err error
+	if s.opts.TLS != nil {
+		c, err = tls.DialWithDialer(&net.Dialer{Timeout: s.opts.Timeout}, "tcp", s.opts.Addr, s.opts.TLS)
+	} else {
+		c, err = net.DialTimeout("tcp", s.opts.Addr, s.opts.Timeout)
+	}
+	if err != nil {
+		s.fail("connect", err)
+		return
+	}
+	defer c.Close()
+	r := bufio.NewReader(c)
+
+	s.mu.Lock()
+	s.res.Conns++
+	s.mu.Unlock()
+
+	if login := enc.Login(name, s.opts.Password); len(login) > 0 {
+		c.SetDeadline(time.Now().Add(s.opts.Timeout))
+		if _, err := c.Write(login); err != nil {
+			s.fail("login", err)
+			return
+		}
+		if err := enc.ChkLogin(r); err != nil {
+			s.fail("login", err)
+			return
+		}
+	}
+
+	rt := newRoute(n)
+	step := interval / time.Duration(s.opts.Records)
+
+	next := time.Now()
+	for i := 0; s.opts.Count <= 0 || i < s.opts.Count; i++ {
+		if i > 0 {
+			next = next.Add(interval)
+			if !s.wait(time.Until(next), done) {
+				return
+			}
+		}
+
+		data := rt.next(s.opts.Records, step)
+		packet := enc.Encode(data)
+
+		sent := time.Now()
+		c.SetDeadline(sent.Add(s.opts.Timeout))
+		if _, err := c.Write(packet); err != nil {
+			s.fail("write", err)
+			return
+		}
+		s.mu.Lock()
+		s.res.Packets++
+		s.mu.Unlock()
+
+		if err := enc.ChkAck(r, len(data)); err != nil {
+			//после ошибки подтверждения поток может быть рассинхронизирован
+			s.fail("ack", err)
+			return
+		}
+
+		s.mu.Lock()
+		s.res.Acked++
+		s.res.Records += len(data)
+		s.res.Latency = append(s.res.Latency, time.Since(sent))
+		s.mu.Unlock()
+	}
+}
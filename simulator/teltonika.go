@@ -0,0 +1,103 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"gps_clients/server_gps_service/hash"
+	"gps_clients/server_gps_service/models"
+	"gps_clients/server_gps_service/retranslator"
+)
+
+//teltonika8E кодирование Teltonika Codec 8 Extended: 2-байтовые IO ID и счетчики.
+//Вход и подтверждения те же, что у Codec 8 ретранслятора.
+type teltonika8E struct {
+	codec8 *retranslator.Teltonika
+}
+
+func newTeltonika8E() (*teltonika8E, error) {
+	T, err := retranslator.NewTeltonika(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &teltonika8E{codec8: T}, nil
+}
+
+func (T *teltonika8E) Login(name, password string) []byte {
+	return T.codec8.Login(name, password)
+}
+
+func (T *teltonika8E) ChkLogin(r *bufio.Reader) error {
+	return T.codec8.ChkLogin(r)
+}
+
+func (T *teltonika8E) ChkAck(r *bufio.Reader, count int) error {
+	return T.codec8.ChkAck(r, count)
+}
+
+func (T *teltonika8E) Encode(data []models.GPSData) []byte {
+	var body bytes.Buffer
+	body.WriteByte(0x8e)
+	body.WriteByte(byte(len(data)))
+	for _, d := range data {
+		T.writeRecord(&body, d)
+	}
+	body.WriteByte(byte(len(data)))
+
+	packet := make([]byte, 8, body.Len()+12)
+	binary.BigEndian.PutUint32(packet[4:], uint32(body.Len()))
+	packet = append(packet, body.Bytes()...)
+
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, uint32(hash.CheckSumCRC16(body.Bytes())))
+	return append(packet, crc...)
+}
+
+func (T *teltonika8E) writeRecord(buf *bytes.Buffer, d models.GPSData) {
+	b := make([]byte, 8)
+
+	binary.BigEndian.PutUint64(b, uint64(d.DateTime.UnixNano()/1e6))
+	buf.Write(b)
+	buf.WriteByte(0) //Prioritet
+
+	binary.BigEndian.PutUint32(b, uint32(int32(math.Round(d.Lng*10000000))))
+	buf.Write(b[:4])
+	binary.BigEndian.PutUint32(b, uint32(int32(math.Round(d.Lat*10000000))))
+	buf.Write(b[:4])
+	binary.BigEndian.PutUint16(b, uint16(d.Alt))
+	buf.Write(b[:2])
+	binary.BigEndian.PutUint16(b, uint16(d.Angle))
+	buf.Write(b[:2])
+	buf.WriteByte(byte(d.Sat))
+	binary.BigEndian.PutUint16(b, uint16(d.Speed))
+	buf.Write(b[:2])
+
+	//датчики маршрута по группам 1, 2, 4, 8 байт: зажигание и движение, напряжения, ДУТ
+	groups := [4][][2]uint64{
+		{{239, 1}, {240, 1}},
+		{{66, uint64(math.Round(d.AccV * 1000))}, {67, uint64(math.Round(d.BatV * 1000))}, {201, uint64(d.Dut1)}},
+	}
+	writeN := func(v uint64) {
+		binary.BigEndian.PutUint16(b, uint16(v))
+		buf.Write(b[:2])
+	}
+
+	total := 0
+	for _, g := range groups {
+		total += len(g)
+	}
+	writeN(0) //Event IO ID
+	writeN(uint64(total))
+	for i, g := range groups {
+		size := 1 << uint(i)
+		writeN(uint64(len(g)))
+		for _, v := range g {
+			writeN(v[0])
+			binary.BigEndian.PutUint64(b, v[1])
+			buf.Write(b[8-size:])
+		}
+	}
+	writeN(0) //датчики переменной длины
+}
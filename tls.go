@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+
+	"gps_clients/server_gps_service/config"
+)
+
+//certStore сертификаты TLS порта, перечитываются без перезапуска порта
+type certStore struct {
+	opts config.TLS
+
+	mu  sync.RWMutex
+	cfg *tls.Config
+}
+
+func newCertStore(opts config.TLS) (*certStore, error) {
+	s := &certStore{opts: opts}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+//Reload читает сертификат, ключ и корневые сертификаты устройств; при ошибке остаются прежние
+func (s *certStore) Reload() error {
+	cert, err := tls.LoadX509KeyPair(s.opts.CertFile, s.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tls: %v", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if s.opts.ClientCA != "" {
+		body, err := ioutil.ReadFile(s.opts.ClientCA)
+		if err != nil {
+			return fmt.Errorf("tls: %v", err)
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(body) {
+			return fmt.Errorf("tls: no certificates in %s", s.opts.ClientCA)
+		}
+	}
+
+	switch strings.ToLower(s.opts.ClientAuth) {
+	case "verify":
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+	return nil
+}
+
+//Set берет сертификаты, прочитанные в другом хранилище
+func (s *certStore) Set(from *certStore) {
+	cfg, _ := from.config(nil)
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+}
+
+func (s *certStore) config(*tls.ClientHelloInfo) (*tls.Config, error) {
+	defer s.mu.RUnlock()
+	s.mu.RLock()
+	return s.cfg, nil
+}
+
+//Listener порт TLS, каждое подключение получает сертификаты, действующие на момент рукопожатия
+func (s *certStore) Listener(ln net.Listener) net.Listener {
+	return tls.NewListener(ln, &tls.Config{GetConfigForClient: s.config})
+}
+
+//errCertMismatch сертификат устройства выдан на другой ID
+var errCertMismatch = errors.New("client certificate does not match device")
+
+//checkDevice проверка, что сертификат соединения выдан устройству id
+func (s *certStore) checkDevice(c net.Conn, id string) error {
+	if s == nil || !s.opts.MatchDevice {
+		return nil
+	}
+	tc, ok := c.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	certs := tc.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return fmt.Errorf("%w: no certificate", errCertMismatch)
+	}
+	if cn := certs[0].Subject.CommonName; cn != id {
+		return fmt.Errorf("%w: certificate %s", errCertMismatch, cn)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/models"
+)
+
+//testCert сертификат cn, подписанный ca (nil - корневой)
+func testCert(t *testing.T, cn string, ca *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parent, signer := tmpl, interface{}(key)
+	if ca == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		parent, signer = ca.Leaf, ca.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) string {
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+//dialTLS вход устройства с сертификатом cert
+func dialTLS(t *testing.T, addr string, ca *x509.CertPool, cert tls.Certificate) *device {
+	c, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: ca, Certificates: []tls.Certificate{cert}, ServerName: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return &device{t: t, c: c, rd: bufio.NewReader(c)}
+}
+
+//TestCertMismatchNotSaved устройство с чужим сертификатом отклоняется до сохранения записей
+//и до входа: сессия устройства с этим ID не перехватывается
+func TestCertMismatchNotSaved(t *testing.T) {
+	dir := testEnv(t, "")
+
+	ca := testCert(t, "test ca", nil)
+	srvCert := testCert(t, "localhost", &ca)
+	certDir := t.TempDir()
+	key, err := x509.MarshalECPrivateKey(srvCert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := newCertStore(config.TLS{
+		CertFile:    writePEM(t, filepath.Join(certDir, "srv.crt"), "CERTIFICATE", srvCert.Certificate[0]),
+		KeyFile:     writePEM(t, filepath.Join(certDir, "srv.key"), "EC PRIVATE KEY", key),
+		ClientCA:    writePEM(t, filepath.Join(certDir, "ca.crt"), "CERTIFICATE", ca.Certificate[0]),
+		ClientAuth:  "require",
+		MatchDevice: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &Server{Addr: "5000", Protocol: "wialon", IdleTimeout: 5 * time.Second, MaxReadBytes: 1024, tls: certs}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(serveCtx, certs.Listener(ln))
+	t.Cleanup(func() { srv.Shutdown(serveCtx) })
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	owner := dialTLS(t, ln.Addr().String(), pool, testCert(t, "dev040b", &ca))
+	owner.login("dev040b")
+
+	rogue := dialTLS(t, ln.Addr().String(), pool, testCert(t, "dev040a", &ca))
+	rogue.send("#L#dev040b;NA\r\n" + strings.Replace(wialonPoint, "102030", "102031", 1))
+	if a, _ := rogue.rd.ReadString('\n'); a != "#AL#0\r\n" || !rogue.closed(time.Second) {
+		t.Fatalf("answer %q, want #AL#0 and close", a)
+	}
+
+	if owner.closed(300 * time.Millisecond) {
+		t.Fatal("device connection closed by a foreign certificate")
+	}
+	if accepted, _, events := sink.counts("dev040b"); accepted != 1 || events[len(events)-1] != models.EventUnknown {
+		t.Fatalf("accepted %d, events %v", accepted, events)
+	}
+	if files := savedFiles(t, dir); len(files) != 1 {
+		t.Fatalf("saved %v", files)
+	}
+	for _, g := range srv.GetGPSList() {
+		if g.Name == "dev040b" && g.GpsD.DateTime.Second() != 30 {
+			t.Fatalf("session changed by a foreign certificate: %+v", g.GpsD)
+		}
+	}
+}
@@ -5,16 +5,19 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
+
+	"gps_clients/server_gps_service/logger"
 )
 
 func ChkErrFatal(err error) {
 	if err != nil {
-		AddToLog(GetProgramPath()+"-error.txt", err)
+		logger.Error("%v", err)
+		logger.Close()
 		os.Exit(1)
 	}
 }
@@ -31,18 +34,6 @@ func Exists(path string) (bool, error) {
 	return true, err
 }
 
-func AddToLog(name string, info interface{}) {
-	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0777)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-
-	date := time.Now().Local().Format("02.01.06 15:04:05 ")
-
-	fmt.Fprintln(f, date, info)
-}
-
 func GetPathWhereExe() string {
 	p, err := filepath.Abs(os.Args[0])
 	if err != nil {
@@ -75,6 +66,7 @@ func MakePortsFromSlice(ps []string) ([]string, error) {
 				return nil, err
 			}
 			res = append(res, r...)
+			continue
 		}
 		if strings.Contains(p, ":") {
 			r, err := makeSlicePort(strings.Split(p, ":"))
@@ -82,6 +74,7 @@ func MakePortsFromSlice(ps []string) ([]string, error) {
 				return nil, err
 			}
 			res = append(res, r...)
+			continue
 		}
 		port, err := strconv.Atoi(p)
 		if err != nil {
@@ -114,6 +107,24 @@ func makeSlicePort(s []string) ([]string, error) {
 	return nil, errors.New("bad slice")
 }
 
+//SafeFileName имя устройства, пригодное для имени файла (без путей и служебных символов)
+func SafeFileName(name string) string {
+	res := strings.Map(func(r rune) rune {
+		switch {
+		case r < 32 || r == 127:
+			return '_'
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	res = strings.Trim(res, ". ")
+	if res == "" {
+		return "_"
+	}
+	return res
+}
+
 func GetPortAdr(s string) string {
 	sl := strings.Split(s, ":")
 	if len(sl) != 2 {
@@ -122,6 +133,15 @@ func GetPortAdr(s string) string {
 	return sl[1]
 }
 
+//GetIPAdr адрес без порта, для IPv6 без скобок
+func GetIPAdr(s string) string {
+	host, _, err := net.SplitHostPort(s)
+	if err != nil {
+		return s
+	}
+	return host
+}
+
 func ToFixedFloat(num float64, precision int) float64 {
 	output := math.Pow(10, float64(precision))
 	return float64(roundFloat(num*output)) / output
@@ -142,6 +162,25 @@ func ConvertCoordToFloat(str string) float64 {
 	return converCoord(res)
 }
 
+//ConvertCoordHemi координата DDMM.MMMM (DDDMM.MMMM) с полушарием N/S/E/W: южная широта и западная долгота отрицательные.
+//Пустое или неразобранное поле (NA у Wialon) и неизвестное полушарие - ошибка, а не точка
+func ConvertCoordHemi(str, hemi string) (float64, error) {
+	res, err := strconv.ParseFloat(str, 64)
+	//NaN, Inf и больше 180 градусов тоже не координата
+	if err != nil || !(res >= 0 && res <= 18000) {
+		return 0, fmt.Errorf("bad coordinate %q", str)
+	}
+
+	res = converCoord(res)
+	switch strings.ToUpper(strings.TrimSpace(hemi)) {
+	case "N", "E":
+		return res, nil
+	case "S", "W":
+		return -res, nil
+	}
+	return 0, fmt.Errorf("bad hemisphere %q", hemi)
+}
+
 func converCoord(coord float64) float64 {
 	/*
 		temp := []rune(fmt.Sprintf("%f", coord/100))
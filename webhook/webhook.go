@@ -0,0 +1,324 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"time"
+
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/logger"
+	"gps_clients/server_gps_service/models"
+	"gps_clients/server_gps_service/queue"
+	"gps_clients/server_gps_service/utils"
+)
+
+//типы сообщений кроме событий models.Event*
+const (
+	TypeAccepted = "accepted"
+	TypeRejected = "rejected"
+)
+
+//SignatureHeader заголовок с HMAC-SHA256 подписью тела запроса
+const SignatureHeader = "X-Signature"
+
+const (
+	defaultTimeout   = 30 * time.Second
+	defaultBackoff   = 5 * time.Minute
+	defaultBatchSize = 100
+	defaultBatchWait = time.Second
+)
+
+//minBackoff первая пауза перед повтором, переменная для тестов
+var minBackoff = time.Second
+
+//errPermanent адрес отклонил сообщение, повторная отправка не поможет
+var errPermanent = errors.New("permanent error")
+
+//Record отклоненная запись с причиной
+type Record struct {
+	Error  string         `json:"error"`
+	Record models.GPSData `json:"record"`
+}
+
+//Message тело запроса
+type Message struct {
+	Type     string           `json:"type"`
+	Time     time.Time        `json:"time"`
+	Device   string           `json:"device"`
+	Port     string           `json:"port"`
+	Records  []models.GPSData `json:"records,omitempty"`
+	Rejected []Record         `json:"rejected,omitempty"`
+	Event    *models.Event    `json:"event,omitempty"`
+}
+
+//Manager отправка сообщений на все настроенные адреса
+type Manager struct {
+	endpoints []*endpoint
+}
+
+//New запускает отправку, очереди хранятся в path/Webhook
+func New(cfgs []config.Webhook, path string) (*Manager, error) {
+	if path == "" {
+		path = utils.GetPathWhereExe()
+	}
+
+	m := &Manager{}
+	for _, c := range cfgs {
+		if c.Name == "" || c.URL == "" {
+			m.Close()
+			return nil, errors.New("webhook: empty name or url")
+		}
+
+		e := &endpoint{
+			cfg:        c,
+			maxBackoff: defaultBackoff,
+			batchSize:  defaultBatchSize,
+			batchWait:  defaultBatchWait,
+			stop:       make(chan struct{}),
+			done:       make(chan struct{}),
+		}
+		if c.BatchSize > 0 {
+			e.batchSize = c.BatchSize
+		}
+		if c.BatchWait > 0 {
+			e.batchWait = time.Duration(c.BatchWait) * time.Millisecond
+		}
+		timeout := defaultTimeout
+		if c.Timeout > 0 {
+			timeout = time.Duration(c.Timeout) * time.Second
+		}
+		if c.MaxBackoff > 0 {
+			e.maxBackoff = time.Duration(c.MaxBackoff) * time.Second
+		}
+		e.client = &http.Client{Timeout: timeout}
+
+		q, err := queue.Open(filepath.Join(path, "Webhook", c.Name), c.MaxQueue)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		e.queue = q
+
+		go e.run()
+		m.endpoints = append(m.endpoints, e)
+	}
+	return m, nil
+}
+
+func (m *Manager) push(msg Message) {
+	for _, e := range m.endpoints {
+		if !e.match(msg) {
+			continue
+		}
+		if err := e.queue.Push(msg); err != nil {
+			logger.With(logger.Fields{Device: msg.Device, Port: msg.Port}).Error("webhook %s: %v", e.cfg.Name, err)
+		}
+	}
+}
+
+//Accepted отправка принятых записей
+func (m *Manager) Accepted(g models.GPSInfo, data []models.GPSData) {
+	m.push(Message{
+		Type:    TypeAccepted,
+		Time:    time.Now(),
+		Device:  g.Name,
+		Port:    g.Port,
+		Records: data,
+	})
+}
+
+//Rejected отправка отклоненных записей
+func (m *Manager) Rejected(g models.GPSInfo, list []models.GPSInfo) {
+	msg := Message{
+		Type:   TypeRejected,
+		Time:   time.Now(),
+		Device: g.Name,
+		Port:   g.Port,
+	}
+	for _, v := range list {
+		msg.Rejected = append(msg.Rejected, Record{Error: v.LastError, Record: v.GpsD})
+	}
+	m.push(msg)
+}
+
+//Event отправка события
+func (m *Manager) Event(e models.Event) {
+	m.push(Message{
+		Type:   e.Type,
+		Time:   e.Time,
+		Device: e.Name,
+		Port:   e.Port,
+		Event:  &e,
+	})
+}
+
+//Close останавливает отправку, неотправленные сообщения остаются на диске
+func (m *Manager) Close() {
+	for _, e := range m.endpoints {
+		close(e.stop)
+		<-e.done
+	}
+}
+
+type endpoint struct {
+	cfg        config.Webhook
+	client     *http.Client
+	queue      *queue.Queue
+	maxBackoff time.Duration
+	batchSize  int
+	batchWait  time.Duration
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+func matchList(list []string, name string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, p := range list {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *endpoint) match(msg Message) bool {
+	return matchList(e.cfg.Devices, msg.Device) &&
+		matchList(e.cfg.Ports, msg.Port) &&
+		matchList(e.cfg.Events, msg.Type)
+}
+
+//Sign подпись тела запроса секретом
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//run отправляет очередь пакетами до batchSize сообщений; неполный пакет ждет
+//новых сообщений до batchWait от появления первого из них
+func (e *endpoint) run() {
+	defer close(e.done)
+
+	backoff := minBackoff
+	var head uint64
+	var headSeen time.Time
+	for {
+		select {
+		case <-e.stop:
+			return
+		default:
+		}
+
+		ids, items, err := e.queue.PeekN(e.batchSize)
+		if err == queue.ErrEmpty {
+			select {
+			case <-e.queue.Wait():
+			case <-e.stop:
+				return
+			}
+			continue
+		}
+		if err != nil {
+			logger.Error("webhook %s: bad queue item %d: %v", e.cfg.Name, ids[0], err)
+			e.queue.Remove(ids[0])
+			continue
+		}
+
+		if ids[0] != head {
+			head, headSeen = ids[0], time.Now()
+		}
+		if wait := e.batchWait - time.Since(headSeen); len(ids) < e.batchSize && wait > 0 {
+			select {
+			case <-e.queue.Wait():
+			case <-time.After(wait):
+			case <-e.stop:
+				return
+			}
+			continue
+		}
+
+		msgs := make([]Message, 0, len(items))
+		for i, v := range items {
+			var msg Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				logger.Error("webhook %s: bad queue item %d: %v", e.cfg.Name, ids[i], err)
+				continue
+			}
+			msgs = append(msgs, msg)
+		}
+		if len(msgs) == 0 {
+			for _, id := range ids {
+				e.queue.Remove(id)
+			}
+			continue
+		}
+
+		err = e.send(msgs)
+		if err == nil || errors.Is(err, errPermanent) {
+			if err != nil {
+				logger.Error("webhook %s: %v, %d messages dropped", e.cfg.Name, err, len(msgs))
+			}
+			for _, id := range ids {
+				e.queue.Remove(id)
+			}
+			backoff = minBackoff
+			continue
+		}
+
+		logger.Error("webhook %s: %v, retry in %s", e.cfg.Name, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-e.stop:
+			return
+		}
+		backoff *= 2
+		if backoff > e.maxBackoff {
+			backoff = e.maxBackoff
+		}
+	}
+}
+
+//send POST пакета сообщений одним JSON массивом
+func (e *endpoint) send(msgs []Message) error {
+	body, err := json.Marshal(msgs)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(e.cfg.Secret, body))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s", errPermanent, resp.Status)
+	default:
+		return errors.New(resp.Status)
+	}
+}
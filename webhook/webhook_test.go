@@ -0,0 +1,221 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gps_clients/server_gps_service/config"
+	"gps_clients/server_gps_service/models"
+	"gps_clients/server_gps_service/queue"
+)
+
+//recorder тестовый адрес: запоминает пакеты, отвечает кодами из status по очереди (потом 200)
+type recorder struct {
+	t      *testing.T
+	secret string
+
+	mu      sync.Mutex
+	status  []int
+	batches [][]Message
+	times   []time.Time
+	got     chan struct{}
+}
+
+func newRecorder(t *testing.T, secret string, status ...int) (*recorder, *httptest.Server) {
+	r := &recorder{t: t, secret: secret, status: status, got: make(chan struct{}, 100)}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	if r.secret != "" {
+		if sig := req.Header.Get(SignatureHeader); sig != Sign(r.secret, body) {
+			r.t.Errorf("bad signature %q", sig)
+		}
+	}
+	var msgs []Message
+	if err := json.Unmarshal(body, &msgs); err != nil {
+		r.t.Errorf("bad body %s: %v", body, err)
+	}
+
+	r.mu.Lock()
+	code := http.StatusOK
+	if len(r.status) > 0 {
+		code, r.status = r.status[0], r.status[1:]
+	}
+	r.times = append(r.times, time.Now())
+	if code == http.StatusOK {
+		r.batches = append(r.batches, msgs)
+	}
+	r.mu.Unlock()
+
+	w.WriteHeader(code)
+	r.got <- struct{}{}
+}
+
+//wait ждет n запросов
+func (r *recorder) wait(n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.got:
+		case <-time.After(5 * time.Second):
+			r.t.Fatalf("no request %d", i+1)
+		}
+	}
+}
+
+func (r *recorder) sizes() []int {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	var res []int
+	for _, b := range r.batches {
+		res = append(res, len(b))
+	}
+	return res
+}
+
+func records(n int) []models.GPSData {
+	var res []models.GPSData
+	tm := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		res = append(res, models.GPSData{DateTime: tm.Add(time.Duration(i) * time.Second), Lat: 55.7, Lng: 37.6})
+	}
+	return res
+}
+
+func TestBatchSigned(t *testing.T) {
+	r, srv := newRecorder(t, "s3cret")
+	m, err := New([]config.Webhook{{Name: "hook", URL: srv.URL, Secret: "s3cret", BatchSize: 2, BatchWait: 200}}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	for i := 0; i < 5; i++ {
+		m.Accepted(models.GPSInfo{Name: "dev1", Port: "5000"}, records(1))
+	}
+	r.wait(3)
+
+	sizes := r.sizes()
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[1] != 2 || sizes[2] != 1 {
+		t.Fatalf("batch sizes %v, want [2 2 1]", sizes)
+	}
+	if msg := r.batches[0][0]; msg.Type != TypeAccepted || msg.Device != "dev1" || msg.Port != "5000" || len(msg.Records) != 1 {
+		t.Fatalf("bad message %+v", msg)
+	}
+}
+
+//TestBatchWait неполный пакет уходит одним запросом после ожидания
+func TestBatchWait(t *testing.T) {
+	r, srv := newRecorder(t, "")
+	m, err := New([]config.Webhook{{Name: "hook", URL: srv.URL, BatchSize: 10, BatchWait: 300}}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	start := time.Now()
+	m.Accepted(models.GPSInfo{Name: "dev1"}, records(2))
+	m.Event(models.Event{Type: models.EventLogin, Name: "dev1"})
+	m.Rejected(models.GPSInfo{Name: "dev1"}, []models.GPSInfo{{LastError: "no gps fix"}})
+	r.wait(1)
+
+	if d := time.Since(start); d < 250*time.Millisecond {
+		t.Fatalf("batch sent after %v, before batchWait", d)
+	}
+	if sizes := r.sizes(); len(sizes) != 1 || sizes[0] != 3 {
+		t.Fatalf("batch sizes %v, want [3]", sizes)
+	}
+	b := r.batches[0]
+	if b[0].Type != TypeAccepted || b[1].Type != models.EventLogin || b[2].Type != TypeRejected || b[2].Rejected[0].Error != "no gps fix" {
+		t.Fatalf("bad batch %+v", b)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	defer func(d time.Duration) { minBackoff = d }(minBackoff)
+	minBackoff = 100 * time.Millisecond
+
+	r, srv := newRecorder(t, "", http.StatusInternalServerError, http.StatusServiceUnavailable)
+	m, err := New([]config.Webhook{{Name: "hook", URL: srv.URL, BatchWait: 1}}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	m.Accepted(models.GPSInfo{Name: "dev1"}, records(3))
+	r.wait(3)
+
+	if sizes := r.sizes(); len(sizes) != 1 || sizes[0] != 1 || len(r.batches[0][0].Records) != 3 {
+		t.Fatalf("delivered %v", sizes)
+	}
+	//паузы между попытками удваиваются
+	d1, d2 := r.times[1].Sub(r.times[0]), r.times[2].Sub(r.times[1])
+	if d1 < minBackoff || d2 < 2*minBackoff {
+		t.Fatalf("retry delays %v, %v", d1, d2)
+	}
+}
+
+func TestPermanentErrorDropped(t *testing.T) {
+	r, srv := newRecorder(t, "", http.StatusBadRequest)
+	dir := t.TempDir()
+	m, err := New([]config.Webhook{{Name: "hook", URL: srv.URL, BatchWait: 1}}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Accepted(models.GPSInfo{Name: "dev1"}, records(1))
+	r.wait(1)
+	m.Close()
+
+	q, err := queue.Open(filepath.Join(dir, "Webhook", "hook"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("queue len %d after 4xx", q.Len())
+	}
+}
+
+//TestReplayAfterRestart сообщения, не доставленные из-за 5xx, остаются на диске и уходят после перезапуска
+func TestReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	down, srv := newRecorder(t, "", http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	m, err := New([]config.Webhook{{Name: "hook", URL: srv.URL, BatchWait: 1}}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Accepted(models.GPSInfo{Name: "dev1"}, records(2))
+	m.Event(models.Event{Type: models.EventDisconnect, Name: "dev1"})
+	down.wait(1)
+	m.Close()
+
+	q, err := queue.Open(filepath.Join(dir, "Webhook", "hook"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 2 {
+		t.Fatalf("queue len %d on disk, want 2", q.Len())
+	}
+
+	up, srv := newRecorder(t, "")
+	m, err = New([]config.Webhook{{Name: "hook", URL: srv.URL, BatchWait: 1}}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	up.wait(1)
+
+	b := up.batches[0]
+	if len(b) != 2 || b[0].Type != TypeAccepted || len(b[0].Records) != 2 || b[1].Type != models.EventDisconnect {
+		t.Fatalf("replayed %+v", b)
+	}
+}